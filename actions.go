@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// inGitHubActions is set when running in a GitHub Actions workflow, where we
+// structure the log using workflow commands.
+var inGitHubActions = os.Getenv("GITHUB_ACTIONS") == "true"
+
+var (
+	sectionOpen bool
+	sectionSpan *span
+	stepSpan    *span
+
+	// currentStep is the last step printed in the current section.
+	currentStep string
+
+	// progress is the position of the repo being worked on in the run, set
+	// by forEachRepo.
+	progress struct {
+		current, total int
+		repo           string
+	}
+)
+
+// stdoutIsTerminal is set when stdout is an interactive terminal.
+var stdoutIsTerminal = func() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}()
+
+// setProgress records that the current'th of total repos is next and, in a
+// terminal, shows it in the window title.
+func setProgress(current, total int, repoPath string) {
+	progress.current, progress.total, progress.repo = current, total, repoPath
+	if stdoutIsTerminal && !inGitHubActions {
+		fmt.Printf("\033]0;mygithelper [%d/%d] %s\007", current, total, repoPath)
+	}
+}
+
+// clearProgress resets the progress and the terminal window title.
+func clearProgress() {
+	if progress.total > 0 && stdoutIsTerminal && !inGitHubActions {
+		fmt.Print("\033]0;\007")
+	}
+	progress.current, progress.total, progress.repo = 0, 0, ""
+}
+
+// progressPrefix returns e.g. "[42/150] " while working through the repos.
+func progressPrefix() string {
+	if progress.total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%d/%d] ", progress.current, progress.total)
+}
+
+// printSection starts the output section for a repo, prefixed with the
+// progress through the repos. In GitHub Actions it's a collapsible group that
+// lasts until the next section or endSection. When tracing, the section is a
+// span.
+func printSection(title string) {
+	endSection()
+	endStepTiming()
+	currentStep = ""
+	sectionSpan = startSpan(title)
+	if !inGitHubActions {
+		fmt.Printf("\n=== %s%s ===\n", progressPrefix(), title)
+		return
+	}
+	fmt.Printf("::group::%s\n", escapeWorkflowCommand(progressPrefix()+title))
+	sectionOpen = true
+}
+
+// endSection closes the current GitHub Actions group, if any.
+func endSection() {
+	sectionSpan.finish(nil)
+	if sectionOpen {
+		fmt.Println("::endgroup::")
+		sectionOpen = false
+	}
+}
+
+// printStep prints msg and, when tracing, starts a span for the step that
+// lasts until the next step or section. The step is timed for --timings.
+func printStep(msg string) {
+	fmt.Println(msg)
+	currentStep = strings.TrimSuffix(msg, "...")
+	stepSpan.finish(nil)
+	stepSpan = startSpan(currentStep)
+	startStepTiming(currentStep)
+}
+
+var stepSummaryStarted bool
+
+// addStepSummary appends a Markdown line to the job summary in GitHub Actions.
+func addStepSummary(line string) {
+	filename := os.Getenv("GITHUB_STEP_SUMMARY")
+	if !inGitHubActions || filename == "" {
+		return
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if !stepSummaryStarted {
+		stepSummaryStarted = true
+		fmt.Fprintf(f, "### mygithelper %s\n\n", strings.Join(os.Args[1:], " "))
+	}
+	fmt.Fprintln(f, line)
+}
+
+// escapeWorkflowCommand escapes s for use as a workflow command value.
+func escapeWorkflowCommand(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
@@ -0,0 +1,47 @@
+package main
+
+import "fmt"
+
+// checkArchived returns a skip error if repo is archived, as flagged in its
+// gitjoin.txt or on GitHub. Newly found archived repos are commented out or
+// flagged in their gitjoin.txt if archived_repos says so.
+func (cfg *config) checkArchived(repo repo, try bool) error {
+	if cfg.repo(repo.Path).Archived {
+		fmt.Println("Flagged as archived, skipping")
+		return skipRepo("archived")
+	}
+
+	var r githubRepo
+	if err := githubAPI("repos/"+repo.Path, &r); err != nil || !r.Archived {
+		// Let the commands fail on their own if GitHub can't be reached.
+		return nil
+	}
+	fmt.Println("Archived on GitHub, skipping")
+
+	pos, ok := cfg.listPositions[repo.Path]
+	if !ok {
+		return skipRepo("archived on GitHub")
+	}
+	var edit func(line string) string
+	var what string
+	switch cfg.ArchivedRepos {
+	case "comment":
+		what = "Commented out"
+		edit = func(line string) string { return "# " + line + " # archived" }
+	case "flag":
+		what = "Flagged"
+		edit = func(line string) string { return addListOption(line, "archived", "true") }
+	default:
+		return skipRepo("archived on GitHub")
+	}
+
+	if try {
+		fmt.Printf("[dry-run] Would update %s\n", pos)
+	} else if err := editListLine(pos, edit); err != nil {
+		fmt.Printf("Failed to update %s: %v\n", pos, err)
+	} else {
+		fmt.Printf("%s at %s\n", what, pos)
+		cfg.commitBaseChanges(fmt.Sprintf("Mark %s as archived", repo.Path), pos.Filename)
+	}
+	return skipRepo("archived on GitHub")
+}
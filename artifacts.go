@@ -0,0 +1,151 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// The records and diffs of past runs, their SBOMs, worktrees left behind by
+// runs that were killed and the rotated command log pile up in .mygithelper
+// over years of scheduled runs. They are removed once older than
+// artifacts_max_days, and the oldest first while they take more than
+// artifacts_max_mb (but not those of the last day, which may belong to a run
+// in progress), before each run and with clean --artifacts. Transactions,
+// the quarantine and the state are kept.
+
+const (
+	defaultArtifactsMaxDays = 180
+	defaultArtifactsMaxMB   = 200
+)
+
+// artifact is a file or directory of a past run in the state dir.
+type artifact struct {
+	Path    string
+	ModTime time.Time
+	Size    int64
+}
+
+func (cfg *config) artifactsMaxAge() time.Duration {
+	return time.Duration(cmp.Or(cfg.ArtifactsMaxDays, defaultArtifactsMaxDays)) * 24 * time.Hour
+}
+
+func (cfg *config) artifactsMaxSize() int64 {
+	return int64(cmp.Or(cfg.ArtifactsMaxMB, defaultArtifactsMaxMB)) << 20
+}
+
+// listArtifacts returns the artifacts in baseDir, oldest first.
+func listArtifacts(baseDir string) ([]artifact, error) {
+	stateDir := filepath.Join(baseDir, stateDirName)
+	var paths []string
+	for _, pattern := range []string{"runs/*.json", "runs/*.diff", "sbom/*", "work/*", commandLogName + ".1"} {
+		matches, err := filepath.Glob(filepath.Join(stateDir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+
+	var artifacts []artifact
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		a := artifact{Path: p, ModTime: info.ModTime(), Size: info.Size()}
+		if info.IsDir() {
+			// A directory is as old as the newest file in it.
+			filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return nil
+				}
+				if info, err := d.Info(); err == nil {
+					a.Size += info.Size()
+					if info.ModTime().After(a.ModTime) {
+						a.ModTime = info.ModTime()
+					}
+				}
+				return nil
+			})
+		}
+		artifacts = append(artifacts, a)
+	}
+	slices.SortFunc(artifacts, func(a, b artifact) int { return a.ModTime.Compare(b.ModTime) })
+	return artifacts, nil
+}
+
+// expiredArtifacts returns the artifacts in baseDir that are older than the
+// max age, and the oldest of the rest while they're over the max size.
+func (cfg *config) expiredArtifacts(baseDir string, now time.Time) ([]artifact, error) {
+	artifacts, err := listArtifacts(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, a := range artifacts {
+		total += a.Size
+	}
+	var expired []artifact
+	for _, a := range artifacts {
+		age := now.Sub(a.ModTime)
+		if age <= cfg.artifactsMaxAge() && (total <= cfg.artifactsMaxSize() || age < 24*time.Hour) {
+			break
+		}
+		expired = append(expired, a)
+		total -= a.Size
+	}
+	return expired, nil
+}
+
+// pruneArtifacts removes the expired artifacts in baseDir.
+func (cfg *config) pruneArtifacts(baseDir string) {
+	expired, err := cfg.expiredArtifacts(baseDir, time.Now())
+	if err != nil || len(expired) == 0 {
+		return
+	}
+	var errs []error
+	for _, a := range expired {
+		errs = append(errs, os.RemoveAll(a.Path))
+	}
+	if err := errors.Join(errs...); err != nil {
+		fmt.Printf("Failed to remove old files in %s: %v\n", stateDirName, err)
+		return
+	}
+	fmt.Printf("Removed %d old file(s) of past runs from %s\n", len(expired), stateDirName)
+}
+
+// cleanArtifacts lists the expired artifacts in baseDir, or removes them
+// with force.
+func (cfg *config) cleanArtifacts(baseDir string, force bool) error {
+	expired, err := cfg.expiredArtifacts(baseDir, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		fmt.Printf("No files of past runs in %s to remove\n", stateDirName)
+		return nil
+	}
+	var size int64
+	for _, a := range expired {
+		rel, _ := filepath.Rel(baseDir, a.Path)
+		size += a.Size
+		if !force {
+			fmt.Printf("Would remove %s (%s)\n", filepath.ToSlash(rel), a.ModTime.Format(time.DateOnly))
+			continue
+		}
+		if err := os.RemoveAll(a.Path); err != nil {
+			return err
+		}
+	}
+	if !force {
+		fmt.Printf("Would remove %d path(s), %.1f MB; run with --force to remove them\n", len(expired), float64(size)/(1<<20))
+		return nil
+	}
+	fmt.Printf("Removed %d path(s), %.1f MB\n", len(expired), float64(size)/(1<<20))
+	return nil
+}
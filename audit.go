@@ -0,0 +1,201 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// --- Audit command ---
+
+// ciStaleAfter is how old the last CI run on the default branch may be
+// before audit reports it as stale.
+const ciStaleAfter = 60 * 24 * time.Hour
+
+var (
+	licenseRe = regexp.MustCompile(`(?i)^(LICEN[CS]E|COPYING)(\.|$)`)
+	readmeRe  = regexp.MustCompile(`(?i)^README(\.|$)`)
+)
+
+// auditCmd checks the repos for the basics of a healthy project and prints a
+// scorecard per repo.
+type auditCmd struct {
+	BaseDir   string
+	Config    *config
+	KeepGoing bool
+	Pick      bool
+
+	scores  []auditScore
+	summary runSummary
+}
+
+type auditScore struct {
+	Repo   string
+	Passed int
+	Total  int
+	Failed []string // Names of the failed checks
+}
+
+func (cmd *auditCmd) Run() error {
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	if err := forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.auditRepo); err != nil {
+		return err
+	}
+
+	printSection("Scorecard")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	var failing int
+	for _, s := range cmd.scores {
+		fmt.Fprintf(w, "%s\t%d/%d\t%s\n", s.Repo, s.Passed, s.Total, strings.Join(s.Failed, ", "))
+		if len(s.Failed) > 0 {
+			failing++
+		}
+	}
+	w.Flush()
+	if failing > 0 {
+		return fmt.Errorf("%d of %d repos failed checks", failing, len(cmd.scores))
+	}
+	return nil
+}
+
+func (cmd *auditCmd) auditRepo(repo repo) error {
+	printSection("Auditing " + repo.Path)
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	branch, err := cmd.Config.defaultBranch(repo)
+	if err != nil {
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	}
+
+	// Look at the default branch as last fetched, not the checkout.
+	var files []string
+	for _, args := range [][]string{{"origin/" + branch}, {"-r", "origin/" + branch, "--", ".github"}} {
+		output, err := gitOutput(repo.Dir, append([]string{"ls-tree", "-z", "--name-only"}, args...)...)
+		if err != nil {
+			return fmt.Errorf("%s: failed to list files: %w", repo.Path, err)
+		}
+		for f := range strings.SplitSeq(output, "\x00") {
+			if f != "" {
+				files = append(files, f)
+			}
+		}
+	}
+	findFile := func(match func(string) bool) string {
+		for _, f := range files {
+			if match(f) {
+				return f
+			}
+		}
+		return ""
+	}
+
+	score := auditScore{Repo: repo.Path}
+	check := func(name string, fn func() (string, error)) {
+		score.Total++
+		detail, err := fn()
+		if err != nil {
+			score.Failed = append(score.Failed, name)
+			fmt.Printf("FAIL  %s: %v\n", name, err)
+			return
+		}
+		score.Passed++
+		fmt.Printf("OK    %s: %s\n", name, detail)
+	}
+	fileCheck := func(match func(string) bool) func() (string, error) {
+		return func() (string, error) {
+			if f := findFile(match); f != "" {
+				return f, nil
+			}
+			return "", errors.New("missing")
+		}
+	}
+
+	check("license", fileCheck(func(f string) bool { return !strings.Contains(f, "/") && licenseRe.MatchString(f) }))
+	check("readme", fileCheck(func(f string) bool { return !strings.Contains(f, "/") && readmeRe.MatchString(f) }))
+	check("ci", fileCheck(func(f string) bool {
+		return path.Dir(f) == ".github/workflows" && isWorkflowFile(path.Base(f))
+	}))
+	check("dependabot", fileCheck(func(f string) bool { return f == ".github/dependabot.yml" || f == ".github/dependabot.yaml" }))
+	check("security alerts", func() (string, error) {
+		// 204 if enabled, 404 if not.
+		if err := githubAPI("repos/"+repo.Path+"/vulnerability-alerts", nil); err != nil {
+			if isNotFound(err) {
+				return "", errors.New("Dependabot alerts are disabled")
+			}
+			return "", err
+		}
+		return "Dependabot alerts are enabled", nil
+	})
+	check("branch protection", func() (string, error) {
+		var b struct {
+			Protected bool `json:"protected"`
+		}
+		if err := githubAPI("repos/"+repo.Path+"/branches/"+branch, &b); err != nil {
+			return "", err
+		}
+		if !b.Protected {
+			return "", fmt.Errorf("%s is not protected", branch)
+		}
+		return branch + " is protected", nil
+	})
+	check("ci status", func() (string, error) {
+		return lastCIRun(repo.Path, branch)
+	})
+
+	fmt.Printf("Score: %d/%d\n", score.Passed, score.Total)
+	cmd.scores = append(cmd.scores, score)
+	return nil
+}
+
+// lastCIRun describes the last workflow run on branch, failing if it failed
+// or is older than ciStaleAfter.
+func lastCIRun(repoPath, branch string) (string, error) {
+	var runs struct {
+		WorkflowRuns []struct {
+			Name       string    `json:"name"`
+			Status     string    `json:"status"`
+			Conclusion string    `json:"conclusion"`
+			CreatedAt  time.Time `json:"created_at"`
+			HTMLURL    string    `json:"html_url"`
+		} `json:"workflow_runs"`
+	}
+	if err := githubAPI(fmt.Sprintf("repos/%s/actions/runs?branch=%s&per_page=1", repoPath, branch), &runs); err != nil {
+		return "", err
+	}
+	if len(runs.WorkflowRuns) == 0 {
+		return "", fmt.Errorf("no workflow runs on %s", branch)
+	}
+	run := runs.WorkflowRuns[0]
+	date := run.CreatedAt.Format(time.DateOnly)
+	switch {
+	case run.Status == "completed" && run.Conclusion != "success":
+		return "", fmt.Errorf("%s %s on %s: %s", run.Name, run.Conclusion, date, run.HTMLURL)
+	case time.Since(run.CreatedAt) > ciStaleAfter:
+		return "", fmt.Errorf("stale, last run on %s", date)
+	}
+	return fmt.Sprintf("%s %s on %s", run.Name, cmp.Or(run.Conclusion, run.Status), date), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// baseRepo is the git repo the base dir is in, if any, usually one holding
+// the gitjoin.txt files and the config. Git commands run in a directory that
+// isn't a clone of its own end up in it, so it's kept out of the commands.
+var baseRepo struct {
+	Dir  string // The top level directory
+	Path string // The GitHub path from its origin, e.g. "bep/workspace", if any
+}
+
+// initBaseRepo finds the repo baseDir is in.
+func initBaseRepo(baseDir string) {
+	top, err := gitOutput(baseDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return
+	}
+	baseRepo.Dir = filepath.Clean(strings.TrimSpace(top))
+	if url, err := gitOutput(baseRepo.Dir, "config", "--get", "remote.origin.url"); err == nil {
+		baseRepo.Path = repoPathFromRemoteURL(strings.TrimSpace(url))
+	}
+}
+
+// isBaseRepo reports whether repoPath is the repo the base dir is in.
+func isBaseRepo(repoPath string) bool {
+	return baseRepo.Path != "" && strings.EqualFold(repoPath, baseRepo.Path)
+}
+
+// isCheckout reports whether dir is the top of a clone or worktree, and not
+// just a directory git would find the base repo from.
+func isCheckout(dir string) bool {
+	return dirExists(filepath.Join(dir, ".git")) || fileExists(filepath.Join(dir, ".git"))
+}
+
+// commitBaseChanges commits files, changed by the command, to the base repo
+// if commit_base_changes is set, and pushes the commit with push_base_changes.
+// Files outside it are left alone.
+func (cfg *config) commitBaseChanges(message string, files ...string) {
+	if !cfg.CommitBaseChanges && !cfg.PushBaseChanges || baseRepo.Dir == "" {
+		return
+	}
+	var paths []string
+	for _, f := range files {
+		if rel, err := filepath.Rel(baseRepo.Dir, f); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			paths = append(paths, rel)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	if err := gitRun(baseRepo.Dir, append([]string{"add", "--"}, paths...)...); err != nil {
+		fmt.Printf("Failed to commit %s to the base repo: %v\n", strings.Join(paths, ", "), err)
+		return
+	}
+	if status, err := gitOutput(baseRepo.Dir, append([]string{"status", "--porcelain", "--"}, paths...)...); err != nil || strings.TrimSpace(status) == "" {
+		return
+	}
+	// Only these files, whatever else is staged.
+	if err := gitRun(baseRepo.Dir, cfg.gitCommitArgs("commit", append([]string{"--quiet", "-m", message, "--"}, paths...)...)...); err != nil {
+		fmt.Printf("Failed to commit %s to the base repo: %v\n", strings.Join(paths, ", "), err)
+		return
+	}
+	fmt.Printf("Committed %s to the base repo\n", strings.Join(paths, ", "))
+
+	if !cfg.PushBaseChanges {
+		return
+	}
+	if _, err := gitOutput(baseRepo.Dir, "rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+		fmt.Println("Not pushing the base repo: the current branch has no upstream")
+		return
+	}
+	if err := gitRun(baseRepo.Dir, "push", "--quiet"); err != nil {
+		fmt.Printf("Failed to push the base repo: %v\nPull (e.g. git pull --rebase) and push it in %s\n", err, baseRepo.Dir)
+		return
+	}
+	fmt.Println("Pushed the base repo")
+}
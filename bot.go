@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// --- Bot mode ---
+
+// botMode is set with --bot or MYGITHELPER_BOT=true for unattended runs, e.g.
+// in the scheduled workflow in .github/workflows/bot.yml. There is no
+// terminal to ask questions on, so prompting is an error, and git and gh
+// authenticate with the GitHub token.
+var botMode = os.Getenv("MYGITHELPER_BOT") == "true"
+
+// The identity of the GitHub Actions bot, used for commits in bot mode unless
+// one is set in the environment.
+const (
+	botName  = "github-actions[bot]"
+	botEmail = "41898282+github-actions[bot]@users.noreply.github.com"
+)
+
+// setupBot prepares the environment of the git and gh commands for bot mode.
+func setupBot() error {
+	token := githubToken()
+	if token == "" {
+		return errors.New("bot mode needs a GH_TOKEN or GITHUB_TOKEN")
+	}
+	// gh only reads GH_TOKEN.
+	os.Setenv("GH_TOKEN", token)
+
+	for key, value := range map[string]string{
+		"GIT_AUTHOR_NAME":     botName,
+		"GIT_AUTHOR_EMAIL":    botEmail,
+		"GIT_COMMITTER_NAME":  botName,
+		"GIT_COMMITTER_EMAIL": botEmail,
+	} {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+
+	// Fail instead of asking for credentials.
+	os.Setenv("GIT_TERMINAL_PROMPT", "0")
+
+	// Use HTTPS with the token for all GitHub remotes, the same way
+	// actions/checkout does, so the token never shows up in a URL.
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return addGitConfigEnv(
+		"http.https://github.com/.extraheader", "AUTHORIZATION: basic "+auth,
+		"url.https://github.com/.insteadOf", "git@github.com:",
+		"url.https://github.com/.insteadOf", "ssh://git@github.com/",
+	)
+}
+
+// addGitConfigEnv adds git config key/value pairs for all git commands we run
+// through the GIT_CONFIG_* environment variables.
+func addGitConfigEnv(keyValues ...string) error {
+	count := 0
+	if s := os.Getenv("GIT_CONFIG_COUNT"); s != "" {
+		var err error
+		if count, err = strconv.Atoi(s); err != nil {
+			return fmt.Errorf("invalid GIT_CONFIG_COUNT %q", s)
+		}
+	}
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		os.Setenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", count), keyValues[i])
+		os.Setenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", count), keyValues[i+1])
+		count++
+	}
+	if count > 0 {
+		os.Setenv("GIT_CONFIG_COUNT", strconv.Itoa(count))
+	}
+	return nil
+}
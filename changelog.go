@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// changelogGroups are the sections of the release notes, in order.
+var changelogGroups = []string{"Breaking changes", "Features", "Bug fixes", "Performance", "Documentation", "Dependencies", "Other changes"}
+
+// Labels and conventional commit types mapped to the changelog groups.
+var (
+	changelogLabelGroups = map[string]string{
+		"breaking":         "Breaking changes",
+		"breaking-change":  "Breaking changes",
+		"enhancement":      "Features",
+		"feature":          "Features",
+		"bug":              "Bug fixes",
+		"bugfix":           "Bug fixes",
+		"performance":      "Performance",
+		"documentation":    "Documentation",
+		"dependencies":     "Dependencies",
+		"skip-changelog":   "",
+		"ignore-changelog": "",
+	}
+	changelogTypeGroups = map[string]string{
+		"feat": "Features",
+		"fix":  "Bug fixes",
+		"perf": "Performance",
+		"docs": "Documentation",
+		"deps": "Dependencies",
+	}
+)
+
+var (
+	// conventionalRe matches a conventional commit subject, e.g.
+	// "fix(parser)!: handle empty input".
+	conventionalRe = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+
+	// prNumberRe matches the PR number GitHub appends to squash merges.
+	prNumberRe = regexp.MustCompile(`\(#(\d+)\)$`)
+
+	// mergePRRe matches the subject of a GitHub merge commit.
+	mergePRRe = regexp.MustCompile(`^Merge pull request #(\d+) from `)
+)
+
+type changelogEntry struct {
+	Title string
+	PR    int // 0 if unknown
+	Group string
+}
+
+// releaseNotes returns the release notes for the commits on the first-parent
+// history from..to (all of to if from is empty) in repo, grouped by the PR
+// labels when GitHub can be reached and by conventional commit type
+// otherwise.
+func releaseNotes(repo repo, from, to string) (string, error) {
+	rev := to
+	if from != "" {
+		rev = from + ".." + to
+	}
+	out, err := gitOutput(repo.Dir, "log", "--first-parent", "--format=%s%x00%b%x1e", rev)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to list commits: %w", repo.Path, err)
+	}
+
+	useLabels := requireGitHub() == nil
+	groups := map[string][]changelogEntry{}
+	for record := range strings.SplitSeq(out, "\x1e") {
+		subject, body, _ := strings.Cut(strings.TrimSpace(record), "\x00")
+		if subject == "" {
+			continue
+		}
+		entry := parseChangelogEntry(subject, body)
+		if useLabels && entry.PR > 0 {
+			labels, err := prLabels(repo.Path, entry.PR)
+			if err != nil {
+				fmt.Printf("Could not get the labels of #%d, grouping without them: %v\n", entry.PR, err)
+				useLabels = false
+			}
+			if group, ok := labelGroup(labels); ok {
+				entry.Group = group
+			}
+		}
+		if entry.Group == "" {
+			continue
+		}
+		groups[entry.Group] = append(groups[entry.Group], entry)
+	}
+
+	var b strings.Builder
+	for _, group := range changelogGroups {
+		entries := groups[group]
+		if len(entries) == 0 {
+			continue
+		}
+		// Oldest first.
+		fmt.Fprintf(&b, "## %s\n\n", group)
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if e.PR > 0 {
+				fmt.Fprintf(&b, "- %s (#%d)\n", e.Title, e.PR)
+			} else {
+				fmt.Fprintf(&b, "- %s\n", e.Title)
+			}
+		}
+		b.WriteString("\n")
+	}
+	if from != "" {
+		fmt.Fprintf(&b, "**Full changelog:** %s\n", githubWebURL(fmt.Sprintf("%s/compare/%s...%s", repo.Path, from, strings.TrimPrefix(to, "origin/"))))
+	}
+	return b.String(), nil
+}
+
+// parseChangelogEntry returns the entry for a commit, grouped by its
+// conventional commit type.
+func parseChangelogEntry(subject, body string) changelogEntry {
+	var entry changelogEntry
+	if m := mergePRRe.FindStringSubmatch(subject); m != nil {
+		// The PR title is the first line of the body.
+		entry.PR, _ = strconv.Atoi(m[1])
+		subject, _, _ = strings.Cut(strings.TrimSpace(body), "\n")
+		subject = strings.TrimSpace(subject)
+	} else if m := prNumberRe.FindStringSubmatch(subject); m != nil {
+		entry.PR, _ = strconv.Atoi(m[1])
+		subject = strings.TrimSpace(strings.TrimSuffix(subject, m[0]))
+	}
+
+	entry.Title = subject
+	entry.Group = "Other changes"
+	if m := conventionalRe.FindStringSubmatch(subject); m != nil {
+		typ, scope, breaking, title := strings.ToLower(m[1]), m[2], m[3] == "!", m[4]
+		if group, ok := changelogTypeGroups[typ]; ok {
+			entry.Group = group
+		}
+		if scope == "deps" {
+			entry.Group = "Dependencies"
+		}
+		if breaking || strings.Contains(body, "BREAKING CHANGE:") {
+			entry.Group = "Breaking changes"
+		}
+		if scope != "" && scope != "deps" {
+			title = scope + ": " + title
+		}
+		entry.Title = title
+	} else if strings.HasPrefix(subject, "Bump ") {
+		// Dependabot and mygithelper update.
+		entry.Group = "Dependencies"
+	}
+	return entry
+}
+
+// labelGroup returns the changelog group of the first label that has one,
+// "" if the PR should be left out.
+func labelGroup(labels []string) (string, bool) {
+	for _, label := range labels {
+		if group, ok := changelogLabelGroups[strings.ToLower(label)]; ok {
+			return group, true
+		}
+	}
+	return "", false
+}
+
+func prLabels(repoPath string, number int) ([]string, error) {
+	var pr struct {
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+	}
+	if err := githubAPI(fmt.Sprintf("repos/%s/pulls/%d", repoPath, number), &pr); err != nil {
+		return nil, err
+	}
+	var labels []string
+	for _, l := range pr.Labels {
+		labels = append(labels, l.Name)
+	}
+	return labels, nil
+}
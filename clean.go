@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --- Clean command ---
+
+// cleanCmd removes the untracked files in the repos, or with Artifacts the
+// files of past runs in the state dir past their retention. It only lists
+// them unless Force is set.
+type cleanCmd struct {
+	BaseDir   string
+	Config    *config
+	Force     bool // Delete the files instead of listing them
+	Ignored   bool // Include ignored files, e.g. build output (git clean -x)
+	Artifacts bool // Clean the state dir instead of the repos
+	KeepGoing bool
+	Pick      bool
+
+	files   int
+	summary runSummary
+}
+
+func (cmd *cleanCmd) Run() error {
+	if cmd.Artifacts {
+		return cmd.Config.cleanArtifacts(cmd.BaseDir, cmd.Force)
+	}
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	if err := forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.cleanRepo); err != nil {
+		return err
+	}
+	if !cmd.Force && cmd.files > 0 {
+		fmt.Printf("Would remove %d untracked path(s); run with --force to remove them\n", cmd.files)
+	}
+	return nil
+}
+
+func (cmd *cleanCmd) cleanRepo(repo repo) error {
+	args := []string{"clean", "-d"}
+	if cmd.Ignored {
+		args = append(args, "-x")
+	}
+
+	output, err := gitOutput(repo.Dir, append(args, "-n")...)
+	if err != nil {
+		return fmt.Errorf("%s: git clean failed: %w", repo.Path, err)
+	}
+	var files []string
+	for line := range strings.Lines(output) {
+		if file, ok := strings.CutPrefix(strings.TrimSpace(line), "Would remove "); ok {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	cmd.files += len(files)
+
+	printSection("Cleaning " + repo.Path)
+	if !cmd.Force {
+		for _, file := range files {
+			fmt.Printf("Would remove %s\n", file)
+		}
+		return nil
+	}
+	if err := gitRun(repo.Dir, append(args, "-f")...); err != nil {
+		return fmt.Errorf("%s: git clean failed: %w", repo.Path, err)
+	}
+	return nil
+}
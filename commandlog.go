@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every external command we run is appended to .mygithelper/commands.log
+// with its directory, duration and exit code, and echoed to stderr with
+// --trace-exec. Tokens are redacted and long arguments (e.g. PR bodies)
+// shortened. The log is rotated to commands.log.1 when it reaches
+// maxCommandLogSize.
+
+const (
+	commandLogName    = "commands.log"
+	maxCommandLogSize = 10 << 20
+	maxLoggedArgLen   = 200
+)
+
+var commandLog struct {
+	sync.Mutex
+	filename string
+	echo     bool // --trace-exec
+}
+
+// initCommandLog starts logging the commands to the state dir in baseDir.
+func initCommandLog(baseDir string, echo bool) {
+	commandLog.filename = filepath.Join(baseDir, stateDirName, commandLogName)
+	commandLog.echo = echo
+}
+
+// execRecord is a running external command, traced and logged when done.
+type execRecord struct {
+	cmd   *exec.Cmd
+	start time.Time
+	span  *span
+}
+
+// startExec starts the span and log record for running cmd.
+func startExec(cmd *exec.Cmd) *execRecord {
+	if commandLog.echo {
+		fmt.Fprintf(os.Stderr, "+ %s%s\n", formatCommand(cmd), dirSuffix(cmd.Dir))
+	}
+	return &execRecord{
+		cmd:   cmd,
+		start: time.Now(),
+		span:  startSpan(strings.Join(redactArgs(cmd.Args), " "), "dir", cmd.Dir),
+	}
+}
+
+// finish ends the span and logs the command with err's exit code.
+func (r *execRecord) finish(err error) {
+	r.span.finish(err)
+
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	duration := time.Since(r.start).Round(time.Millisecond)
+	if commandLog.echo && err != nil {
+		fmt.Fprintf(os.Stderr, "+ exit %d after %s\n", exitCode, duration)
+	}
+	logCommand(fmt.Sprintf("%s exit=%d %s dir=%s %s\n", r.start.Format(time.RFC3339), exitCode, duration, r.cmd.Dir, formatCommand(r.cmd)))
+}
+
+func logCommand(line string) {
+	commandLog.Lock()
+	defer commandLog.Unlock()
+	if commandLog.filename == "" {
+		return
+	}
+
+	if fi, err := os.Stat(commandLog.filename); err == nil && fi.Size() >= maxCommandLogSize {
+		os.Rename(commandLog.filename, commandLog.filename+".1")
+	}
+	if err := os.MkdirAll(filepath.Dir(commandLog.filename), 0o755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(commandLog.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.WriteString(line)
+}
+
+func formatCommand(cmd *exec.Cmd) string {
+	args := redactArgs(cmd.Args)
+	for i, arg := range args {
+		if len(arg) > maxLoggedArgLen {
+			arg = arg[:maxLoggedArgLen] + "..."
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'$") {
+			arg = shellQuote(arg)
+		}
+		args[i] = arg
+	}
+	return strings.Join(args, " ")
+}
+
+func dirSuffix(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return " (in " + dir + ")"
+}
+
+var (
+	// tokenRe matches GitHub tokens.
+	tokenRe = regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,}`)
+
+	// credentialRe matches credentials in URLs and HTTP headers (as set in
+	// bot mode), keeping the part before them.
+	credentialRe = regexp.MustCompile(`(x-access-token:|(?i:authorization:\s*\w+\s+))[^@\s]+`)
+)
+
+// redactArgs returns a copy of args with the tokens replaced.
+func redactArgs(args []string) []string {
+	tokens := []string{os.Getenv("GH_TOKEN"), os.Getenv("GITHUB_TOKEN")}
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		for _, token := range tokens {
+			if len(token) >= 8 {
+				arg = strings.ReplaceAll(arg, token, "***")
+			}
+		}
+		arg = tokenRe.ReplaceAllString(arg, "***")
+		redacted[i] = credentialRe.ReplaceAllString(arg, "${1}***")
+	}
+	return redacted
+}
@@ -0,0 +1,941 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// configFilename is the optional config file read from the base dir.
+const configFilename = "mygithelper.json"
+
+type config struct {
+	// PruneProtect holds branch name patterns (path.Match syntax) that
+	// prune-remote never deletes. Defaults to defaultPruneProtect.
+	PruneProtect []string `json:"prune_protect,omitempty"`
+
+	// Protocol is the protocol used when cloning, "ssh" (default) or "https".
+	// With https and a GitHub token (GH_TOKEN, GITHUB_TOKEN or the token_env
+	// of an identity), git gets the token from mygithelper as a credential
+	// helper instead of from the helpers it's configured with.
+	Protocol string `json:"protocol,omitempty"`
+
+	// PullStrategy is used when a fast-forward pull of the default branch
+	// fails: "ff-only" (default, fail), "rebase" or "merge".
+	PullStrategy string `json:"pull_strategy,omitempty"`
+
+	// LocalBranch is what becomes of the local branch of a PR once it's
+	// pushed: "track" (default) keeps it with the pushed branch as its
+	// upstream, "keep" keeps it without, "delete" deletes it.
+	LocalBranch string `json:"local_branch,omitempty"`
+
+	// CloneDepth and CloneFilter are the defaults for get's --depth and --filter.
+	CloneDepth  int    `json:"clone_depth,omitempty"`
+	CloneFilter string `json:"clone_filter,omitempty"`
+
+	// GoVersions is the Go version matrix update writes to the workflows, oldest
+	// first (e.g. ["1.24", "1.25", "1.26", "tip"]). The oldest released version
+	// is set in go.mod. Defaults to the running Go version and the one before.
+	GoVersions []string `json:"go_versions,omitempty"`
+
+	// RunnerLabels renames the runner labels and groups in the runs-on of
+	// the workflows on update, old to new, e.g. {"linux-x64": "linux-x64-v2"},
+	// to follow a renamed pool of self-hosted runners.
+	RunnerLabels map[string]string `json:"runner_labels,omitempty"`
+
+	// Govulncheck makes update run govulncheck before and after updating
+	// dependencies and list the fixed and remaining vulnerabilities in the PR.
+	Govulncheck bool `json:"govulncheck,omitempty"`
+
+	// SBOM makes update write an SBOM of the modules of each repo whose
+	// dependencies it updated, "spdx" or "cyclonedx", to
+	// .mygithelper/sbom/<run-id>.
+	SBOM string `json:"sbom,omitempty"`
+
+	// Verify is what update runs to check a repo before creating a PR: "build"
+	// (default, go build ./...), "test" (go build and go test ./...) or "none".
+	Verify string `json:"verify,omitempty"`
+
+	// VerifyTimeout limits how long verification may take (default 10m).
+	VerifyTimeout string `json:"verify_timeout,omitempty"`
+
+	// Worktree makes update and fix work in temporary worktrees, as with --worktree.
+	Worktree bool `json:"worktree,omitempty"`
+
+	// Draft makes update open its PRs as drafts, as with --draft.
+	Draft bool `json:"draft,omitempty"`
+
+	// AutoMerge enables auto-merge (squash) on the PRs we create, as with
+	// --auto-merge.
+	AutoMerge bool `json:"auto_merge,omitempty"`
+
+	// PRLabels, PRReviewers (users or org/team), PRAssignees and PRMilestone
+	// (by title) are applied to the PRs we create.
+	PRLabels    []string `json:"pr_labels,omitempty"`
+	PRReviewers []string `json:"pr_reviewers,omitempty"`
+	PRAssignees []string `json:"pr_assignees,omitempty"`
+	PRMilestone string   `json:"pr_milestone,omitempty"`
+
+	// SignCommits signs the commits we create: "gpg" or "ssh". SigningKey
+	// overrides git's user.signingkey (a key ID, or for ssh a key file).
+	SignCommits string `json:"sign_commits,omitempty"`
+	SigningKey  string `json:"signing_key,omitempty"`
+
+	// ArchivedRepos says what to do with the gitjoin.txt line of a repo that
+	// is archived on GitHub, besides skipping it: "skip" (default, leave the
+	// line alone), "comment" (comment it out) or "flag" (add archived=true).
+	ArchivedRepos string `json:"archived_repos,omitempty"`
+
+	// TrackingRepo (owner/name) gets an open issue per command listing the
+	// PRs of each run as a checklist, to follow the rollout in one place.
+	TrackingRepo string `json:"tracking_repo,omitempty"`
+
+	// NotifySlack (a Slack incoming webhook URL) and NotifyWebhook get the
+	// summary of each update, fix and sync-files run when it finishes, the
+	// latter as JSON with the PRs, skipped and failed repos. $VAR in them is
+	// expanded, to keep the URLs out of the config. NotifyDesktop shows it as
+	// a desktop notification.
+	NotifySlack   string `json:"notify_slack,omitempty"`
+	NotifyWebhook string `json:"notify_webhook,omitempty"`
+	NotifyDesktop bool   `json:"notify_desktop,omitempty"`
+
+	// Hosts are the machines --host can run mygithelper on over SSH, by name.
+	Hosts map[string]hostConfig `json:"hosts,omitempty"`
+
+	// Exclude lists globs of repos (e.g. "bep/experimental-*") to leave out
+	// of all commands, like ! lines in the gitjoin.txt files.
+	Exclude []string `json:"exclude,omitempty"`
+
+	// CommitBaseChanges makes setup, discover and the archived_repos edits
+	// commit the gitjoin.txt files and config they change to the git repo
+	// the base dir is in.
+	CommitBaseChanges bool `json:"commit_base_changes,omitempty"`
+
+	// PushBaseChanges also pushes these commits, keeping the gitjoin.txt
+	// files and config in sync across machines. Implies commit_base_changes.
+	PushBaseChanges bool `json:"push_base_changes,omitempty"`
+
+	// ArtifactsMaxDays is how many days the records, SBOMs and leftover
+	// worktrees of past runs in .mygithelper are kept (default 180), and
+	// ArtifactsMaxMB how many MB they may take (default 200).
+	ArtifactsMaxDays int `json:"artifacts_max_days,omitempty"`
+	ArtifactsMaxMB   int `json:"artifacts_max_mb,omitempty"`
+
+	// WorkflowFiles lists globs (e.g. "*.yml", "ci-*.yaml") of the files in
+	// .github/workflows that update, audit and the other commands read and
+	// edit, matched ignoring case. Defaults to all .yml and .yaml files.
+	WorkflowFiles []string `json:"workflow_files,omitempty"`
+
+	// GitBackend is how the read-only git queries asked for every repo
+	// (current branch, default branch, whether a ref exists, whether the
+	// checkout is clean) are answered: "cli" (default) runs git, "native"
+	// reads the .git directory directly.
+	GitBackend string `json:"git_backend,omitempty"`
+
+	// Timeouts limit how long a git, gh, go or shell command may run before
+	// it's killed, by operation ("git fetch", "go test"), program ("gh") or
+	// "default", e.g. {"git fetch": "5m", "go": "30m"}. git clone, fetch,
+	// pull, push and ls-remote and gh have limits of their own by default.
+	Timeouts map[string]string `json:"timeouts,omitempty"`
+
+	// QuarantineAfter is the number of update, fix or sync-files runs in a
+	// row a repo may fail before it's skipped until unquarantined (default 3,
+	// negative to turn quarantining off).
+	QuarantineAfter int `json:"quarantine_after,omitempty"`
+
+	// LargeUpdateModules is the number of modules an update may change before
+	// its PR is opened as a draft and flagged for manual review, as it is
+	// when a module gets a new major version (default 40, negative for no
+	// limit).
+	LargeUpdateModules int `json:"large_update_modules,omitempty"`
+
+	// BranchTemplate is the text/template for the names of the branches we
+	// create, with .Prefix ("mygithelper"), .Command (e.g. "update"), .Date
+	// (YYYYMMDD) and .Hash (of the changes). Defaults to
+	// defaultBranchTemplate. An existing branch with the same name makes us
+	// skip the repo, so with .Date the same changes may be proposed again on
+	// another day.
+	BranchTemplate string `json:"branch_template,omitempty"`
+
+	// CommitTemplate and PRBodyTemplate are text/templates for the commit
+	// message (also the PR title) and the PR body of update, fix and
+	// sync-files, with the ones we made up in .Message and .Body, e.g.
+	// "{{.Message}} ({{.Module}}, latest release {{.LatestTag}})". All three
+	// templates also get the facts about the repo in templateData, e.g.
+	// .Path, .Module, .LatestTag, .HasDockerfile and .Workflows.
+	CommitTemplate string `json:"commit_template,omitempty"`
+	PRBodyTemplate string `json:"pr_body_template,omitempty"`
+
+	// Groups names selections of groups (directories of gitjoin.txt files
+	// relative to the base dir) for --group, as aliases or meta-groups, e.g.
+	// {"libs": ["work/libraries"], "all-work": ["libs", "work/services"]}.
+	// Members can be other names. A name wins over a directory of the same
+	// name.
+	Groups map[string][]string `json:"groups,omitempty"`
+
+	// Identities holds the GitHub account to use for the repos of a group
+	// (the directory of a gitjoin.txt relative to the base dir), for when the
+	// repos span several accounts.
+	Identities map[string]identity `json:"identities,omitempty"`
+
+	// TemplatesDir holds the templates for sync-files, relative to the base
+	// dir (default "templates").
+	TemplatesDir string `json:"templates_dir,omitempty"`
+
+	// HooksDir holds the git hooks hooks install sets up in the repos,
+	// relative to the base dir (default "hooks"). HooksMode is how: "symlink"
+	// (default, into .git/hooks), "copy" or "hooks_path" (set core.hooksPath
+	// to the shared directory).
+	HooksDir  string `json:"hooks_dir,omitempty"`
+	HooksMode string `json:"hooks_mode,omitempty"`
+
+	// SyncFiles maps groups (the directory of a gitjoin.txt relative to the
+	// base dir, or "*" for all groups) to the files sync-files keeps in their
+	// repos, keyed by path in the repo with the template name as value, e.g.
+	// {"*": {"LICENSE": "LICENSE.tmpl"}}. Group entries win over "*" entries.
+	SyncFiles map[string]map[string]string `json:"sync_files,omitempty"`
+
+	// URLRewrites rewrite remote URLs the same way as git's url.<base>.insteadOf.
+	URLRewrites []urlRewrite `json:"url_rewrites,omitempty"`
+
+	// Repos holds per-repo overrides keyed by GitHub path (e.g. "bep/firstupdotenv").
+	Repos map[string]repoConfig `json:"repos,omitempty"`
+
+	// listOptions holds the key=value options from the gitjoin.txt files,
+	// which take precedence over Repos.
+	listOptions map[string][]listOption
+
+	// listPositions holds where the repos are listed.
+	listPositions map[string]listPos
+}
+
+type repoConfig struct {
+	// SkipUpdate makes update leave the repo alone.
+	SkipUpdate bool `json:"skip_update,omitempty"`
+
+	// SkipTidy turns off the go mod tidy step of update.
+	SkipTidy bool `json:"skip_tidy,omitempty"`
+
+	// HoldGo holds the repo at a Go version (e.g. "1.25"): while the Go
+	// versions update rolls out are newer, it leaves the Go versions in the
+	// workflows and the go directive alone, e.g. until the repo passes a new
+	// vet check.
+	HoldGo string `json:"hold_go,omitempty"`
+
+	// SkipSteps turns off update steps (see updateSteps) until a date
+	// (YYYY-MM-DD) or until the Go version update rolls out reaches a version
+	// (e.g. "1.27"). An empty value turns the step off for good. In
+	// gitjoin.txt: skip_steps=actions:2026-12-01,dependencies:1.27.
+	SkipSteps map[string]string `json:"skip_steps,omitempty"`
+
+	// Generate makes update run go generate ./... after updating dependencies
+	// and include the regenerated files in the PR.
+	Generate bool `json:"generate,omitempty"`
+
+	// Branch is used instead of the remote's default branch.
+	Branch string `json:"branch,omitempty"`
+
+	// Ref pins the checkout to a branch, tag or commit, which get checks
+	// out; update leaves the repo alone and fix and sync-files warn. In
+	// gitjoin.txt: github.com/gohugoio/hugo@v0.140.0 or ref=v0.140.0.
+	Ref string `json:"ref,omitempty"`
+
+	// Dir is the directory to clone into instead of one named after the repo,
+	// relative to the gitjoin.txt, e.g. for repos whose names only differ in
+	// case, or a nested path like "tools/foo" to mirror an org's structure.
+	// As it decides where the repo is, it's only read from gitjoin.txt.
+	Dir string `json:"-"`
+
+	// Host is the GitHub Enterprise Server hostname of the repo, e.g.
+	// "github.example.com", overriding the host of the group's identity.
+	Host string `json:"host,omitempty"`
+
+	// URL is cloned from instead of the URL derived from the protocol.
+	URL string `json:"url,omitempty"`
+
+	// SparseCheckout limits the checkout to these directories (cone mode).
+	SparseCheckout []string `json:"sparse_checkout,omitempty"`
+
+	// Verify and VerifyTimeout override the global settings.
+	Verify        string `json:"verify,omitempty"`
+	VerifyTimeout string `json:"verify_timeout,omitempty"`
+
+	// Archived makes update, fix and sync-files skip the repo without asking
+	// GitHub. See archived_repos.
+	Archived bool `json:"archived,omitempty"`
+
+	// Fork makes update, fix and sync-files push their branches to our fork
+	// of the repo (forking it if needed) and open cross-fork PRs, which they
+	// also do on their own when we lack push access.
+	Fork bool `json:"fork,omitempty"`
+
+	// LocalBranch overrides the global setting.
+	LocalBranch string `json:"local_branch,omitempty"`
+
+	// ReviewWeb makes update and fix open the pushed branch in the browser to
+	// create the PR by hand instead of creating it, as with --review-web.
+	ReviewWeb bool `json:"review_web,omitempty"`
+
+	// The PR metadata settings replace the global ones.
+	PRLabels    []string `json:"pr_labels,omitempty"`
+	PRReviewers []string `json:"pr_reviewers,omitempty"`
+	PRAssignees []string `json:"pr_assignees,omitempty"`
+	PRMilestone string   `json:"pr_milestone,omitempty"`
+}
+
+// urlRewrite rewrites remote URLs starting with From to start with To.
+type urlRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// PushOnly applies the rewrite to pushes only (url.<base>.pushInsteadOf).
+	PushOnly bool `json:"push_only,omitempty"`
+
+	// Network restricts the rule to when this network is selected with
+	// --network or MYGITHELPER_NETWORK. Rules without one always apply.
+	Network string `json:"network,omitempty"`
+}
+
+const defaultBranchTemplate = "{{.Prefix}}/{{.Command}}-{{.Hash}}"
+
+var defaultPruneProtect = []string{"main", "master", "develop", "release-*", "release/*", "gh-pages"}
+
+func loadConfig(baseDir string) (*config, error) {
+	cfg := &config{}
+
+	b, err := os.ReadFile(filepath.Join(baseDir, configFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", configFilename, err)
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", configFilename, err)
+		}
+	}
+
+	switch cfg.PullStrategy {
+	case "", "ff-only", "rebase", "merge":
+	default:
+		return nil, fmt.Errorf("%s: invalid pull_strategy %q, must be ff-only, rebase or merge", configFilename, cfg.PullStrategy)
+	}
+
+	switch cfg.ArchivedRepos {
+	case "", "skip", "comment", "flag":
+	default:
+		return nil, fmt.Errorf("%s: invalid archived_repos %q, must be skip, comment or flag", configFilename, cfg.ArchivedRepos)
+	}
+
+	switch cfg.HooksMode {
+	case "", "symlink", "copy", "hooks_path":
+	default:
+		return nil, fmt.Errorf("%s: invalid hooks_mode %q, must be symlink, copy or hooks_path", configFilename, cfg.HooksMode)
+	}
+
+	switch cfg.SignCommits {
+	case "", "gpg", "ssh":
+	default:
+		return nil, fmt.Errorf("%s: invalid sign_commits %q, must be gpg or ssh", configFilename, cfg.SignCommits)
+	}
+
+	if !validLocalBranch(cfg.LocalBranch) {
+		return nil, fmt.Errorf("%s: invalid local_branch %q, must be track, keep or delete", configFilename, cfg.LocalBranch)
+	}
+	if err := validateVerify("", cfg.Verify, cfg.VerifyTimeout); err != nil {
+		return nil, err
+	}
+	for repoPath, rc := range cfg.Repos {
+		if err := validateVerify("repos."+repoPath+".", rc.Verify, rc.VerifyTimeout); err != nil {
+			return nil, err
+		}
+		if rc.HoldGo != "" && !goVersionRe.MatchString(rc.HoldGo) {
+			return nil, fmt.Errorf("%s: invalid repos.%s.hold_go %q", configFilename, repoPath, rc.HoldGo)
+		}
+		if err := validateSkipSteps(rc.SkipSteps); err != nil {
+			return nil, fmt.Errorf("%s: repos.%s.skip_steps: %w", configFilename, repoPath, err)
+		}
+		if rc.Host != "" && !validHost(rc.Host) {
+			return nil, fmt.Errorf("%s: invalid repos.%s.host %q", configFilename, repoPath, rc.Host)
+		}
+		if !validLocalBranch(rc.LocalBranch) {
+			return nil, fmt.Errorf("%s: invalid repos.%s.local_branch %q", configFilename, repoPath, rc.LocalBranch)
+		}
+		if rc.Ref != "" && !validRef(rc.Ref) {
+			return nil, fmt.Errorf("%s: invalid repos.%s.ref %q", configFilename, repoPath, rc.Ref)
+		}
+	}
+	for name, members := range cfg.Groups {
+		if name == "" || strings.Contains(name, ",") || len(members) == 0 {
+			return nil, fmt.Errorf("%s: invalid groups entry %q, expected a name without commas and a list of groups", configFilename, name)
+		}
+		if _, err := cfg.resolveGroups(name); err != nil {
+			return nil, fmt.Errorf("%s: groups: %w", configFilename, err)
+		}
+	}
+	for group, id := range cfg.Identities {
+		if id.Host != "" && !validHost(id.Host) {
+			return nil, fmt.Errorf("%s: invalid identities.%s.host %q", configFilename, group, id.Host)
+		}
+	}
+
+	for i, v := range cfg.GoVersions {
+		cfg.GoVersions[i] = strings.TrimSuffix(v, ".x")
+	}
+	if len(cfg.GoVersions) > 0 {
+		if err := validateGoMatrix(cfg.GoVersions); err != nil {
+			return nil, fmt.Errorf("%s: invalid go_versions: %w", configFilename, err)
+		}
+	}
+
+	if cfg.BranchTemplate != "" {
+		if _, err := cfg.branchName("update", 0, templateData{}); err != nil {
+			return nil, fmt.Errorf("%s: invalid branch_template: %w", configFilename, err)
+		}
+	}
+	if _, _, err := cfg.prMessage("update", templateData{}, "message", "body"); err != nil {
+		return nil, fmt.Errorf("%s: %w", configFilename, err)
+	}
+
+	for group, files := range cfg.SyncFiles {
+		for target := range files {
+			if target == "" || path.IsAbs(target) || strings.HasPrefix(path.Clean(target), "..") {
+				return nil, fmt.Errorf("%s: sync_files.%s: invalid path %q", configFilename, group, target)
+			}
+		}
+	}
+
+	if cfg.TrackingRepo != "" && repoNameFromPath(cfg.TrackingRepo) == "" {
+		return nil, fmt.Errorf("%s: invalid tracking_repo %q, expected owner/name", configFilename, cfg.TrackingRepo)
+	}
+
+	for key, u := range map[string]string{"notify_slack": cfg.NotifySlack, "notify_webhook": cfg.NotifyWebhook} {
+		if u == "" || strings.HasPrefix(u, "$") {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" && parsed.Scheme != "http" || parsed.Host == "" {
+			return nil, fmt.Errorf("%s: invalid %s, expected an http(s) URL", configFilename, key)
+		}
+	}
+	for _, pattern := range cfg.Exclude {
+		if err := validExclude(pattern); err != nil {
+			return nil, fmt.Errorf("%s: exclude: %w", configFilename, err)
+		}
+	}
+	if cfg.ArtifactsMaxDays < 0 || cfg.ArtifactsMaxMB < 0 {
+		return nil, fmt.Errorf("%s: artifacts_max_days and artifacts_max_mb must not be negative", configFilename)
+	}
+	for from, to := range cfg.RunnerLabels {
+		if from == "" || to == "" || strings.Contains(from+to, "${{") {
+			return nil, fmt.Errorf("%s: invalid runner_labels entry %q: %q", configFilename, from, to)
+		}
+	}
+	for _, pattern := range cfg.WorkflowFiles {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" || strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("%s: workflow_files: invalid pattern %q, expected a file name glob like *.yml", configFilename, pattern)
+		}
+	}
+	if _, ok := gitReaders[cfg.GitBackend]; cfg.GitBackend != "" && !ok {
+		return nil, fmt.Errorf("%s: invalid git_backend %q, must be cli or native", configFilename, cfg.GitBackend)
+	}
+
+	switch cfg.SBOM {
+	case "", "spdx", "cyclonedx":
+	default:
+		return nil, fmt.Errorf("%s: invalid sbom %q, must be spdx or cyclonedx", configFilename, cfg.SBOM)
+	}
+
+	for op, timeout := range cfg.Timeouts {
+		if _, err := time.ParseDuration(timeout); err != nil {
+			return nil, fmt.Errorf("%s: invalid timeouts.%s: %w", configFilename, op, err)
+		}
+	}
+
+	for i, r := range cfg.URLRewrites {
+		if r.From == "" || r.To == "" {
+			return nil, fmt.Errorf("%s: url_rewrites[%d] needs both from and to", configFilename, i)
+		}
+	}
+
+	return cfg, nil
+}
+
+// loadListOptions reads the per-repo options from the gitjoin.txt files.
+func (cfg *config) loadListOptions(baseDir string) error {
+	files, err := findGitjoinFiles(baseDir)
+	if err != nil {
+		return err
+	}
+
+	cfg.listOptions = map[string][]listOption{}
+	cfg.listPositions = map[string]listPos{}
+	for _, filename := range files {
+		entries, err := parseListFile(filename)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Exclude || e.IncludeGroup {
+				continue
+			}
+			if repoPath := repoPathFromGitjoinLine(e.Text); repoPath != "" {
+				cfg.listOptions[repoPath] = append(cfg.listOptions[repoPath], e.Options...)
+				cfg.listPositions[repoPath] = e.Pos
+			}
+		}
+	}
+	return nil
+}
+
+func validateVerify(prefix, mode, timeout string) error {
+	switch mode {
+	case "", "build", "test", "none":
+	default:
+		return fmt.Errorf("%s: invalid %sverify %q, must be build, test or none", configFilename, prefix, mode)
+	}
+	if timeout != "" {
+		if _, err := time.ParseDuration(timeout); err != nil {
+			return fmt.Errorf("%s: invalid %sverify_timeout: %w", configFilename, prefix, err)
+		}
+	}
+	return nil
+}
+
+// updateSteps are the update steps that skip_steps can turn off.
+var updateSteps = []string{"go_versions", "actions", "runner_labels", "go_directive", "dependencies", "tidy", "generate", "govulncheck"}
+
+// validateSkipSteps checks the steps and their until dates or Go versions.
+func validateSkipSteps(steps map[string]string) error {
+	for step, until := range steps {
+		if !slices.Contains(updateSteps, step) {
+			return fmt.Errorf("unknown step %q, must be one of %s", step, strings.Join(updateSteps, ", "))
+		}
+		if until == "" || goVersionRe.MatchString(until) {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, until); err != nil {
+			return fmt.Errorf("invalid until %q for %s, expected YYYY-MM-DD or a Go version", until, step)
+		}
+	}
+	return nil
+}
+
+func saveConfig(baseDir string, cfg *config) error {
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(baseDir, configFilename), append(b, '\n'), 0o644)
+}
+
+func (cfg *config) pruneProtect() []string {
+	if len(cfg.PruneProtect) > 0 {
+		return cfg.PruneProtect
+	}
+	return defaultPruneProtect
+}
+
+// toolBranchPatterns returns path.Match patterns for the branches created by
+// mygithelper: those from the branch template, revert-run and transactions.
+func (cfg *config) toolBranchPatterns() []string {
+	patterns := []string{"mygithelper/*"}
+	tmpl, err := template.New("branch").Parse(cmp.Or(cfg.BranchTemplate, defaultBranchTemplate))
+	if err != nil {
+		return patterns
+	}
+	// Match any repo facts used in the template as well.
+	wild := templateData{Path: "*", Owner: "*", Name: "*", Group: "*", repoFacts: repoFacts{Module: "*", LatestTag: "*"}}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, messageData{templateData: wild, Prefix: "mygithelper", Command: "*", Date: "*", Hash: "*"}); err != nil {
+		return patterns
+	}
+	if pattern := strings.TrimSpace(b.String()); !slices.Contains(patterns, pattern) {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// messageData is what the branch, commit and PR body templates are rendered
+// with.
+type messageData struct {
+	templateData
+	Prefix  string // "mygithelper"
+	Command string // e.g. "update"
+	Date    string // YYYYMMDD
+	Hash    string // Of the changes
+	Message string // The commit message we made up
+	Body    string // The PR body we made up
+}
+
+// branchName returns the name of the branch for changes made by command in
+// the repo described by data, identified by hash.
+func (cfg *config) branchName(command string, hash uint64, data templateData) (string, error) {
+	name, err := renderMessage("branch", cmp.Or(cfg.BranchTemplate, defaultBranchTemplate), messageData{
+		templateData: data,
+		Prefix:       "mygithelper",
+		Command:      command,
+		Date:         time.Now().Format("20060102"),
+		Hash:         fmt.Sprintf("%x", hash),
+	})
+	if err != nil {
+		return "", err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, " ~^:?*[\\") || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid branch name %q", name)
+	}
+	return name, nil
+}
+
+// prMessage returns the commit message and PR body for the changes made by
+// command in the repo described by data, from commit_template and
+// pr_body_template if set.
+func (cfg *config) prMessage(command string, data templateData, message, body string) (string, string, error) {
+	md := messageData{templateData: data, Prefix: "mygithelper", Command: command, Message: message, Body: body}
+	if cfg.CommitTemplate != "" {
+		var err error
+		if message, err = renderMessage("commit_template", cfg.CommitTemplate, md); err != nil {
+			return "", "", fmt.Errorf("invalid commit_template: %w", err)
+		}
+		message = strings.TrimSpace(message)
+	}
+	if cfg.PRBodyTemplate != "" {
+		var err error
+		if body, err = renderMessage("pr_body_template", cfg.PRBodyTemplate, md); err != nil {
+			return "", "", fmt.Errorf("invalid pr_body_template: %w", err)
+		}
+	}
+	return message, body, nil
+}
+
+func renderMessage(name, text string, data messageData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// gitCommitArgs returns the arguments for a git command creating a commit,
+// e.g. commit or revert, signing it if configured.
+func (cfg *config) gitCommitArgs(command string, args ...string) []string {
+	var gitArgs []string
+	if cfg.SignCommits == "ssh" {
+		gitArgs = append(gitArgs, "-c", "gpg.format=ssh")
+	}
+	gitArgs = append(gitArgs, command)
+	if cfg.SignCommits != "" {
+		sign := "--gpg-sign"
+		if cfg.SigningKey != "" {
+			sign += "=" + cfg.SigningKey
+		}
+		gitArgs = append(gitArgs, sign)
+	}
+	return append(gitArgs, args...)
+}
+
+// checkSigning checks that commits can be signed as configured, so we don't
+// fail halfway through a run.
+func (cfg *config) checkSigning(baseDir string) error {
+	if cfg.SignCommits == "" {
+		return nil
+	}
+
+	key := cfg.SigningKey
+	if key == "" {
+		out, _ := gitOutput(baseDir, "config", "--get", "user.signingkey")
+		key = strings.TrimSpace(out)
+	}
+	if key == "" {
+		return fmt.Errorf("sign_commits is %s, but no signing key is set (signing_key in %s or git's user.signingkey)", cfg.SignCommits, configFilename)
+	}
+
+	switch cfg.SignCommits {
+	case "gpg":
+		program, _ := gitOutput(baseDir, "config", "--get", "gpg.program")
+		program = cmp.Or(strings.TrimSpace(program), "gpg")
+		if _, err := exec.LookPath(program); err != nil {
+			return fmt.Errorf("sign_commits is gpg, but %s is not installed", program)
+		}
+		cmd, done := newCommand(context.Background(), program, "--list-secret-keys", key)
+		if err := done(runTraced(cmd)); err != nil {
+			return fmt.Errorf("no secret GPG key %q found", key)
+		}
+	case "ssh":
+		if _, err := exec.LookPath("ssh-keygen"); err != nil {
+			return fmt.Errorf("sign_commits is ssh, but ssh-keygen is not installed")
+		}
+		if !strings.HasPrefix(key, "key::") && !strings.HasPrefix(key, "ssh-") && !fileExists(expandHome(key)) {
+			return fmt.Errorf("SSH signing key %s not found", key)
+		}
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~/ in filename with the home dir.
+func expandHome(filename string) string {
+	if rest, ok := strings.CutPrefix(filename, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return filename
+}
+
+// syncFiles returns the files sync-files keeps in the repos of group, keyed by
+// path in the repo with the template name as value.
+func (cfg *config) syncFiles(group string) map[string]string {
+	files := map[string]string{}
+	maps.Copy(files, cfg.SyncFiles["*"])
+	maps.Copy(files, cfg.SyncFiles[group])
+	return files
+}
+
+func (cfg *config) templatesDir(baseDir string) string {
+	if cfg.TemplatesDir == "" {
+		return filepath.Join(baseDir, "templates")
+	}
+	return filepath.Join(baseDir, cfg.TemplatesDir)
+}
+
+func (cfg *config) hooksDir(baseDir string) string {
+	if cfg.HooksDir == "" {
+		return filepath.Join(baseDir, "hooks")
+	}
+	return filepath.Join(baseDir, cfg.HooksDir)
+}
+
+func (cfg *config) cloneOptions() cloneOptions {
+	return cloneOptions{Depth: cfg.CloneDepth, Filter: cfg.CloneFilter}
+}
+
+// repo returns the overrides for the repo at repoPath, if any.
+func (cfg *config) repo(repoPath string) repoConfig {
+	rc := cfg.Repos[repoPath]
+	for _, o := range cfg.listOptions[repoPath] {
+		// Validated when parsed.
+		rc.setOption(o.Key, o.Value)
+	}
+	return rc
+}
+
+// setOption sets the field for a key=value option in a gitjoin.txt file.
+// The keys are the same as in the config file.
+func (rc *repoConfig) setOption(key, value string) error {
+	parseBool := func() (bool, error) {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid boolean %q for %s", value, key)
+		}
+		return b, nil
+	}
+
+	var err error
+	switch key {
+	case "skip_update":
+		rc.SkipUpdate, err = parseBool()
+	case "skip_tidy":
+		rc.SkipTidy, err = parseBool()
+	case "generate":
+		rc.Generate, err = parseBool()
+	case "hold_go":
+		if !goVersionRe.MatchString(value) {
+			return fmt.Errorf("invalid hold_go %q", value)
+		}
+		rc.HoldGo = value
+	case "skip_steps":
+		rc.SkipSteps = map[string]string{}
+		for entry := range strings.SplitSeq(value, ",") {
+			step, until, _ := strings.Cut(entry, ":")
+			rc.SkipSteps[step] = until
+		}
+		err = validateSkipSteps(rc.SkipSteps)
+	case "branch":
+		rc.Branch = value
+	case "ref":
+		if !validRef(value) {
+			return fmt.Errorf("invalid ref %q, must be a branch, tag or commit", value)
+		}
+		rc.Ref = value
+	case "dir":
+		if value == "" || path.IsAbs(value) || strings.Contains(value, `\`) || path.Clean(value) != value || slices.Contains(strings.Split(value, "/"), "..") || value == "." {
+			return fmt.Errorf("invalid dir %q, must be a relative path like foo or tools/foo", value)
+		}
+		rc.Dir = value
+	case "host":
+		if !validHost(value) {
+			return fmt.Errorf("invalid host %q, must be a hostname like github.example.com", value)
+		}
+		rc.Host = value
+	case "url":
+		rc.URL = value
+	case "local_branch":
+		if value == "" || !validLocalBranch(value) {
+			return fmt.Errorf("invalid local_branch %q, must be track, keep or delete", value)
+		}
+		rc.LocalBranch = value
+	case "sparse_checkout":
+		rc.SparseCheckout = strings.Split(value, ",")
+	case "verify":
+		if value != "build" && value != "test" && value != "none" {
+			return fmt.Errorf("invalid verify %q, must be build, test or none", value)
+		}
+		rc.Verify = value
+	case "archived":
+		rc.Archived, err = parseBool()
+	case "fork":
+		rc.Fork, err = parseBool()
+	case "review_web":
+		rc.ReviewWeb, err = parseBool()
+	case "pr_labels":
+		rc.PRLabels = strings.Split(value, ",")
+	case "pr_reviewers":
+		rc.PRReviewers = strings.Split(value, ",")
+	case "pr_assignees":
+		rc.PRAssignees = strings.Split(value, ",")
+	case "pr_milestone":
+		rc.PRMilestone = value
+	case "verify_timeout":
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid verify_timeout: %w", err)
+		}
+		rc.VerifyTimeout = value
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return err
+}
+
+func validLocalBranch(s string) bool {
+	return s == "" || s == "track" || s == "keep" || s == "delete"
+}
+
+// localBranch returns the local_branch setting for the repo at repoPath.
+func (cfg *config) localBranch(repoPath string) string {
+	return cmp.Or(cfg.repo(repoPath).LocalBranch, cfg.LocalBranch, "track")
+}
+
+// warnPinned warns that r is pinned to a ref when a command is about to
+// check out branch in it instead.
+func (cfg *config) warnPinned(r repo, branch string) {
+	if ref := cfg.repo(r.Path).Ref; ref != "" {
+		fmt.Printf("Warning: %s is pinned to %s, switching to %s; run get to check out %s again\n", r.Path, ref, branch, ref)
+	}
+}
+
+// validRef reports whether s can be a ref to pin a repo to.
+func validRef(s string) bool {
+	return s != "" && !strings.HasPrefix(s, "-") && !strings.ContainsAny(s, " \t~^:?*[\\") && !strings.Contains(s, "..")
+}
+
+// defaultBranch returns the branch to work against in r, the configured
+// branch if set and the remote's default branch otherwise.
+func (cfg *config) defaultBranch(r repo) (string, error) {
+	if branch := cfg.repo(r.Path).Branch; branch != "" {
+		return branch, nil
+	}
+	return getDefaultBranch(r.Dir)
+}
+
+// prOptions returns the metadata for the PRs we create in the repo at repoPath.
+func (cfg *config) prOptions(repoPath string) prOptions {
+	rc := cfg.repo(repoPath)
+	opts := prOptions{
+		Labels:    cfg.PRLabels,
+		Reviewers: cfg.PRReviewers,
+		Assignees: cfg.PRAssignees,
+		Milestone: cmp.Or(rc.PRMilestone, cfg.PRMilestone),
+		AutoMerge: cfg.AutoMerge,
+	}
+	if rc.PRLabels != nil {
+		opts.Labels = rc.PRLabels
+	}
+	if rc.PRReviewers != nil {
+		opts.Reviewers = rc.PRReviewers
+	}
+	if rc.PRAssignees != nil {
+		opts.Assignees = rc.PRAssignees
+	}
+	return opts
+}
+
+// verify returns the verification mode and timeout for the repo at repoPath.
+func (cfg *config) verify(repoPath string) (mode string, timeout time.Duration) {
+	mode, timeoutStr := cfg.Verify, cfg.VerifyTimeout
+	rc := cfg.repo(repoPath)
+	if rc.Verify != "" {
+		mode = rc.Verify
+	}
+	if rc.VerifyTimeout != "" {
+		timeoutStr = rc.VerifyTimeout
+	}
+	if mode == "" {
+		mode = "build"
+	}
+	timeout = 10 * time.Minute
+	if timeoutStr != "" {
+		// Validated in loadConfig.
+		timeout, _ = time.ParseDuration(timeoutStr)
+	}
+	return mode, timeout
+}
+
+// cloneURL returns the URL to clone the GitHub repo at repoPath (e.g.
+// "bep/firstupdotenv") from, on the GitHub host of the current identity.
+func (cfg *config) cloneURL(repoPath string) string {
+	if url := cfg.repo(repoPath).URL; url != "" {
+		return url
+	}
+	host := githubHost()
+	if cfg.Protocol == "https" {
+		return "https://" + host + "/" + repoPath + ".git"
+	}
+	return "git@" + host + ":" + repoPath + ".git"
+}
+
+// githubHosts returns the GitHub hosts the repos may be on: the default one
+// and those of the identities and repos.
+func (cfg *config) githubHosts() []string {
+	hosts := []string{githubHost()}
+	for _, id := range cfg.Identities {
+		hosts = append(hosts, id.Host)
+	}
+	for _, rc := range cfg.Repos {
+		hosts = append(hosts, rc.Host)
+	}
+	slices.Sort(hosts)
+	return slices.DeleteFunc(slices.Compact(hosts), func(h string) bool { return h == "" })
+}
+
+// applyURLRewrites passes the URL rewrites active for network on to every git
+// process we start (including those started by go and gh) through the
+// GIT_CONFIG_COUNT environment, so clone, push and ls-remote all agree.
+func (cfg *config) applyURLRewrites(network string) error {
+	var keyValues []string
+	for _, r := range cfg.URLRewrites {
+		if r.Network != "" && r.Network != network {
+			continue
+		}
+		key := "url." + r.To + ".insteadOf"
+		if r.PushOnly {
+			key = "url." + r.To + ".pushInsteadOf"
+		}
+		keyValues = append(keyValues, key, r.From)
+	}
+	return addGitConfigEnv(keyValues...)
+}
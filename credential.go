@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// --- Git credential helper ---
+
+// With protocol https and a GitHub token, git gets the credentials for the
+// GitHub hosts from mygithelper credential, a git credential helper answering
+// with the token of the current identity, instead of from the user's helpers,
+// which may hold another account. The token stays in the environment: it's
+// never written to a remote URL or .git/config, nor passed as an argument.
+
+// credentialUsername is the user name GitHub expects with a token.
+const credentialUsername = "x-access-token"
+
+// setupCredentialHelper makes the git commands we run ask mygithelper for the
+// credentials of the GitHub hosts in HTTPS mode. Bot mode sends the token in
+// a header instead, and without a token the user's helpers are left alone.
+func (cfg *config) setupCredentialHelper() error {
+	if cfg.Protocol != "https" || botMode || !cfg.hasGitHubToken() {
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to set up the git credential helper: %w", err)
+	}
+	helper := "!" + shellQuote(self) + " credential"
+	var keyValues []string
+	for _, host := range cfg.githubHosts() {
+		// The empty value drops the helpers configured for the host so far.
+		key := "credential.https://" + host + ".helper"
+		keyValues = append(keyValues, key, "", key, helper)
+	}
+	return addGitConfigEnv(keyValues...)
+}
+
+// hasGitHubToken reports whether there is a GitHub token in the environment
+// or for one of the identities.
+func (cfg *config) hasGitHubToken() bool {
+	if githubToken() != "" {
+		return true
+	}
+	for _, id := range cfg.Identities {
+		if id.TokenEnv != "" && os.Getenv(id.TokenEnv) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// credentialHelper answers git for mygithelper credential <operation>, with
+// the credential description on in and the answer to get written to out.
+// Only requests for the current GitHub host are answered; store is a no-op,
+// and erase, sent when the token was rejected, says so.
+func credentialHelper(args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: mygithelper credential get|store|erase (run by git)")
+	}
+	request := map[string]string{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			request[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	host := githubHost()
+	if request["protocol"] != "https" || !strings.EqualFold(request["host"], host) {
+		return nil
+	}
+	token := githubToken()
+	if token == "" {
+		return nil
+	}
+	switch args[0] {
+	case "get":
+		_, err := fmt.Fprintf(out, "username=%s\npassword=%s\n", credentialUsername, token)
+		return err
+	case "erase":
+		fmt.Fprintf(os.Stderr, "mygithelper: %s rejected the token; check GH_TOKEN/GITHUB_TOKEN or the token_env of the identity\n", host)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --- Diff command ---
+
+// diffCmd prints the uncommitted changes in each repo, or with Update, the
+// changes update would make, to review a fleet-wide change before anything
+// is committed or pushed.
+type diffCmd struct {
+	BaseDir   string
+	Config    *config
+	Update    bool // Preview the update steps in temporary worktrees
+	Stat      bool // Print diffstats instead of the full diffs
+	KeepGoing bool
+	Pick      bool
+
+	// Go versions for Update, as for the update command.
+	GoVersions []string
+	Go         string
+	PrevGo     string
+
+	update  *updateCmd
+	runID   string
+	changed int
+	summary runSummary
+}
+
+func (cmd *diffCmd) Run() error {
+	if cmd.Update {
+		cmd.update = &updateCmd{BaseDir: cmd.BaseDir, Config: cmd.Config, GoVersions: cmd.GoVersions, Go: cmd.Go, PrevGo: cmd.PrevGo, Try: true}
+		if err := cmd.update.resolveGoVersions(); err != nil {
+			return err
+		}
+		cmd.update.actions = newActionResolver()
+		cmd.runID = newRunID()
+		defer removeRunWorkDir(cmd.BaseDir, cmd.runID)
+	}
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	err = forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.diffRepo)
+	fmt.Printf("%d of %d repos have changes\n", cmd.changed, len(repos))
+	return err
+}
+
+func (cmd *diffCmd) diffRepo(repo repo) error {
+	dir := repo.Dir
+	if cmd.Update {
+		ws, err := cmd.previewUpdate(repo)
+		if err != nil {
+			return err
+		}
+		defer ws.Close()
+		dir = ws.Dir
+	}
+
+	status, err := gitOutput(dir, "status", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("%s: failed to get status: %w", repo.Path, err)
+	}
+	if strings.TrimSpace(status) == "" {
+		return nil
+	}
+	cmd.changed++
+
+	printSection("Diff of " + repo.Path)
+	args := []string{"--no-pager", "diff", "HEAD"}
+	if cmd.Stat {
+		args = append(args, "--stat")
+	}
+	if err := gitRun(dir, args...); err != nil {
+		return fmt.Errorf("%s: git diff failed: %w", repo.Path, err)
+	}
+
+	untracked, err := gitOutput(dir, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return fmt.Errorf("%s: failed to list untracked files: %w", repo.Path, err)
+	}
+	for file := range strings.Lines(untracked) {
+		fmt.Printf("Untracked: %s", file)
+	}
+	return nil
+}
+
+// previewUpdate runs the update steps for repo in a worktree at the tip of
+// its default branch, to be closed by the caller.
+func (cmd *diffCmd) previewUpdate(repo repo) (*workspace, error) {
+	rc := cmd.Config.repo(repo.Path)
+	if rc.SkipUpdate || rc.Archived {
+		return nil, skipRepo("not updated")
+	}
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return nil, fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	defaultBranch, err := cmd.Config.defaultBranch(repo)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	}
+
+	printSection("Previewing update of " + repo.Path)
+	ws, err := newWorkspace(cmd.BaseDir, cmd.runID, repo, defaultBranch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	if _, err := cmd.update.runUpdateSteps(ws.Dir, rc, cmd.update.heldSteps(rc)); err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	return ws, nil
+}
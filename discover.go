@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// --- Discover command ---
+
+type discoverCmd struct {
+	BaseDir  string
+	Config   *config
+	Org      string // GitHub organization to list repos from
+	User     string // GitHub user to list repos from
+	Group    string // Directory below BaseDir holding the gitjoin.txt, defaults to the org/user name
+	Language string // Only include repos with this primary language
+	Archived bool   // Include archived repos
+	Forks    bool   // Include forks
+	Try      bool
+}
+
+func (cmd *discoverCmd) Run() error {
+	if (cmd.Org == "") == (cmd.User == "") {
+		return fmt.Errorf("discover requires exactly one of --org or --user")
+	}
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+
+	owner, apiPath := cmd.Org, "orgs/"+cmd.Org+"/repos?per_page=100"
+	if cmd.User != "" {
+		owner, apiPath = cmd.User, "users/"+cmd.User+"/repos?per_page=100"
+	}
+	group := cmd.Group
+	if group == "" {
+		group = owner
+	}
+
+	fmt.Printf("Listing repos for %s...\n", owner)
+	ghRepos, err := githubAPIList[githubRepo](apiPath)
+	if err != nil {
+		return fmt.Errorf("failed to list repos for %s: %w", owner, err)
+	}
+
+	var repoPaths []string
+	for _, r := range ghRepos {
+		if r.Archived && !cmd.Archived {
+			continue
+		}
+		if r.Fork && !cmd.Forks {
+			continue
+		}
+		if cmd.Language != "" && !strings.EqualFold(r.Language, cmd.Language) {
+			continue
+		}
+		repoPaths = append(repoPaths, r.FullName)
+	}
+	slices.Sort(repoPaths)
+
+	fmt.Printf("Found %d matching repos (of %d)\n", len(repoPaths), len(ghRepos))
+
+	filename, section := groupListFile(cmd.BaseDir, group)
+	listName := listFileName(cmd.BaseDir, filename, section)
+
+	// Report entries that no longer match, but leave it to the user to remove them.
+	if fileExists(filename) {
+		entries, err := parseListFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		for _, e := range withoutExcluded(entries) {
+			repoPath := repoPathFromGitjoinLine(e.Text)
+			if e.Section == section && strings.HasPrefix(strings.ToLower(repoPath), strings.ToLower(owner)+"/") && !slices.Contains(repoPaths, repoPath) {
+				fmt.Printf("Note: %s is listed in %s but was not discovered\n", repoPath, listName)
+			}
+		}
+	}
+
+	if cmd.Try {
+		for _, repoPath := range repoPaths {
+			fmt.Printf("[dry-run] Would add %s\n", repoPath)
+		}
+		return nil
+	}
+
+	added, err := addToGitjoin(filename, section, repoPaths)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %d repo(s) to %s\n", added, listName)
+	if added > 0 {
+		cmd.Config.commitBaseChanges(fmt.Sprintf("Add %d repo(s) from %s to %s", added, owner, listName), filename)
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// --- Doctor command ---
+
+// minGitVersion is the oldest git with everything we use (fetch --refetch).
+var minGitVersion = [2]int{2, 36}
+
+// doctorCmd checks the environment before a run, so problems don't surface
+// halfway through an update.
+type doctorCmd struct {
+	BaseDir string
+}
+
+func (cmd *doctorCmd) Run() error {
+	var failed int
+	check := func(name string, fix string, fn func() (string, error)) {
+		detail, err := fn()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", name, err)
+			if fix != "" {
+				fmt.Printf("      Fix: %s\n", fix)
+			}
+			return
+		}
+		fmt.Printf("OK    %s: %s\n", name, detail)
+	}
+
+	check("git", fmt.Sprintf("Install git %d.%d or later: https://git-scm.com/downloads", minGitVersion[0], minGitVersion[1]), checkGitVersion)
+	check("go", "Install Go: https://go.dev/dl/", func() (string, error) {
+		cmd, done := newCommand(context.Background(), "go", "version")
+		rec := startExec(cmd)
+		out, err := cmd.Output()
+		rec.finish(err)
+		if err := done(err); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	})
+
+	cfg, cfgErr := loadConfig(cmd.BaseDir)
+	check(configFilename, "Fix the error in "+configFilename, func() (string, error) {
+		if cfgErr != nil {
+			return "", cfgErr
+		}
+		if !fileExists(filepath.Join(cmd.BaseDir, configFilename)) {
+			return "not found, using the defaults", nil
+		}
+		return "parses", nil
+	})
+	if cfgErr != nil {
+		cfg = &config{}
+	}
+
+	check("gitjoin.txt", "Run mygithelper validate for the details", func() (string, error) {
+		files, err := findGitjoinFiles(cmd.BaseDir)
+		if err != nil {
+			return "", err
+		}
+		if len(files) == 0 {
+			return "", errors.New("no gitjoin.txt files below " + cmd.BaseDir)
+		}
+		repos, err := listRepos(cmd.BaseDir)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d repos in %d files", len(repos), len(files)), nil
+	})
+
+	check("GitHub", "Install gh and run gh auth login (https://cli.github.com/), or set GH_TOKEN", func() (string, error) {
+		if err := requireGitHub(); err != nil {
+			return "", errors.New("no gh (GitHub CLI) and no GH_TOKEN/GITHUB_TOKEN")
+		}
+		if hasGh() {
+			if _, err := ghOutput("auth", "status"); err != nil {
+				return "", fmt.Errorf("gh auth status: %w", err)
+			}
+		}
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err := githubAPI("user", &user); err != nil {
+			return "", err
+		}
+		via := "GH_TOKEN"
+		if hasGh() {
+			via = "gh"
+		}
+		return fmt.Sprintf("authenticated as %s via %s", user.Login, via), nil
+	})
+
+	// Pinning actions resolves tags and releases through the API; a token
+	// without quota fails in the middle of update.
+	check("GitHub API quota", "Wait for the rate limit to reset, or use a token with a higher limit", func() (string, error) {
+		var limits struct {
+			Resources struct {
+				Core struct {
+					Limit     int `json:"limit"`
+					Remaining int `json:"remaining"`
+				} `json:"core"`
+			} `json:"resources"`
+		}
+		if err := githubAPI("rate_limit", &limits); err != nil {
+			return "", err
+		}
+		core := limits.Resources.Core
+		if core.Remaining < 100 {
+			return "", fmt.Errorf("only %d of %d requests left", core.Remaining, core.Limit)
+		}
+		return fmt.Sprintf("%d of %d requests left", core.Remaining, core.Limit), nil
+	})
+
+	if cfg.Protocol != "https" {
+		for _, host := range cfg.githubHosts() {
+			check("SSH to "+host, "Add your SSH key at https://"+host+`/settings/keys, or set "protocol": "https" in `+configFilename, func() (string, error) {
+				return checkGitHubSSH(host, "")
+			})
+		}
+	}
+	for group, id := range cfg.Identities {
+		if id.SSHKey == "" {
+			continue
+		}
+		check("SSH for "+group, "Check the ssh_key of identities."+group+" in "+configFilename, func() (string, error) {
+			return checkGitHubSSH(cmp.Or(id.Host, githubHost()), expandHome(id.SSHKey))
+		})
+	}
+
+	if cfg.SignCommits != "" {
+		check("commit signing", "Set signing_key in "+configFilename+" or git's user.signingkey", func() (string, error) {
+			if err := cfg.checkSigning(cmd.BaseDir); err != nil {
+				return "", err
+			}
+			return cfg.SignCommits, nil
+		})
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	fmt.Println("All checks passed")
+	return nil
+}
+
+var gitVersionRe = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+func checkGitVersion() (string, error) {
+	cmd, done := newCommand(context.Background(), "git", "version")
+	rec := startExec(cmd)
+	out, err := cmd.Output()
+	rec.finish(err)
+	if err := done(err); err != nil {
+		return "", err
+	}
+	version := strings.TrimSpace(string(out))
+	m := gitVersionRe.FindStringSubmatch(version)
+	if m == nil {
+		return "", fmt.Errorf("can't parse %q", version)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	if major < minGitVersion[0] || major == minGitVersion[0] && minor < minGitVersion[1] {
+		return "", fmt.Errorf("%s is too old", version)
+	}
+	return version, nil
+}
+
+// checkGitHubSSH checks that ssh -T authenticates with the GitHub host, with
+// the given key if set. GitHub always exits with 1 since there's no shell.
+func checkGitHubSSH(host, key string) (string, error) {
+	args := []string{"-T", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if key != "" {
+		if !fileExists(key) {
+			return "", fmt.Errorf("key %s not found", key)
+		}
+		args = append(args, "-i", key, "-o", "IdentitiesOnly=yes")
+	}
+	args = append(args, "git@"+host)
+
+	cmd, done := newCommand(context.Background(), "ssh", args...)
+	rec := startExec(cmd)
+	out, err := cmd.CombinedOutput()
+	rec.finish(err)
+	err = done(err)
+	output := strings.TrimSpace(string(out))
+	if strings.Contains(output, "successfully authenticated") {
+		return strings.TrimSuffix(output, " but GitHub does not provide shell access."), nil
+	}
+	if output == "" {
+		if err != nil {
+			return "", err
+		}
+		output = "no response"
+	}
+	return "", errors.New(output)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// --- Editor workspace command ---
+
+// editorWorkspaceCmd writes a VS Code workspace, and optionally a JetBrains
+// project with one module per repo, listing the cloned repos by group.
+type editorWorkspaceCmd struct {
+	BaseDir   string
+	JetBrains bool
+	Try       bool
+}
+
+// codeWorkspaceFilename returns the VS Code workspace file for baseDir, named
+// after the directory.
+func codeWorkspaceFilename(baseDir string) string {
+	return filepath.Join(baseDir, filepath.Base(baseDir)+".code-workspace")
+}
+
+// jetBrainsModulesFilename returns the module list of the JetBrains project in
+// baseDir.
+func jetBrainsModulesFilename(baseDir string) string {
+	return filepath.Join(baseDir, ".idea", "modules.xml")
+}
+
+func (cmd *editorWorkspaceCmd) Run() error {
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if err := cmd.writeCodeWorkspace(repos); err != nil {
+		return err
+	}
+	if cmd.JetBrains {
+		return cmd.writeJetBrainsProject(repos)
+	}
+	return nil
+}
+
+// refreshEditorWorkspaces regenerates the editor workspaces that were written
+// before, so they keep up with the repos being cloned.
+func refreshEditorWorkspaces(baseDir string, try bool) error {
+	cmd := &editorWorkspaceCmd{BaseDir: baseDir, Try: try}
+	hasCode := fileExists(codeWorkspaceFilename(baseDir))
+	cmd.JetBrains = fileExists(jetBrainsModulesFilename(baseDir))
+	if !hasCode && !cmd.JetBrains {
+		return nil
+	}
+
+	repos, err := findRepos(baseDir)
+	if err != nil {
+		return err
+	}
+	if hasCode {
+		if err := cmd.writeCodeWorkspace(repos); err != nil {
+			return err
+		}
+	}
+	if cmd.JetBrains {
+		return cmd.writeJetBrainsProject(repos)
+	}
+	return nil
+}
+
+// workspaceFolder returns the path of r relative to the base dir and the name
+// to show for it, prefixed with its group.
+func (cmd *editorWorkspaceCmd) workspaceFolder(r repo) (rel, name string) {
+	rel, err := filepath.Rel(cmd.BaseDir, r.Dir)
+	if err != nil {
+		rel = r.Dir
+	}
+	name, err = filepath.Rel(r.ListDir, r.Dir)
+	if err != nil {
+		name = filepath.Base(r.Dir)
+	}
+	name = filepath.ToSlash(name)
+	if group := repoGroup(cmd.BaseDir, r); group != "." && group != "" {
+		name = group + "/" + name
+	}
+	return filepath.ToSlash(rel), name
+}
+
+func (cmd *editorWorkspaceCmd) writeCodeWorkspace(repos []repo) error {
+	filename := codeWorkspaceFilename(cmd.BaseDir)
+
+	// Keep the settings, extensions etc. from an existing workspace.
+	workspace := map[string]any{}
+	if b, err := os.ReadFile(filename); err == nil {
+		if err := json.Unmarshal(b, &workspace); err != nil {
+			return fmt.Errorf("failed to parse %s (comments aren't supported): %w", filename, err)
+		}
+	}
+
+	type folder struct {
+		Name string `json:"name"`
+		Path string `json:"path"`
+	}
+	var folders []folder
+	for _, r := range repos {
+		rel, name := cmd.workspaceFolder(r)
+		folders = append(folders, folder{Name: name, Path: rel})
+	}
+	slices.SortFunc(folders, func(a, b folder) int { return strings.Compare(a.Name, b.Name) })
+	workspace["folders"] = folders
+
+	b, err := json.MarshalIndent(workspace, "", "\t")
+	if err != nil {
+		return err
+	}
+	return cmd.writeFile(filename, append(b, '\n'), len(folders))
+}
+
+type jetBrainsModule struct {
+	FileURL  string `xml:"fileurl,attr"`
+	FilePath string `xml:"filepath,attr"`
+	Group    string `xml:"group,attr,omitempty"`
+}
+
+// writeJetBrainsProject writes a .idea project with a module per repo, grouped
+// by gitjoin.txt group. The .iml files live in .idea/modules so the repos
+// themselves aren't touched.
+func (cmd *editorWorkspaceCmd) writeJetBrainsProject(repos []repo) error {
+	ideaDir := filepath.Join(cmd.BaseDir, ".idea")
+
+	var modules []jetBrainsModule
+	for _, r := range repos {
+		rel, name := cmd.workspaceFolder(r)
+		imlName := strings.ReplaceAll(name, "/", ".") + ".iml"
+		imlFilename := filepath.Join(ideaDir, "modules", imlName)
+
+		// $MODULE_DIR$ is .idea/modules.
+		iml := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<module type="WEB_MODULE" version="4">
+  <component name="NewModuleRootManager" inherit-compiler-output="true">
+    <exclude-output />
+    <content url="file://$MODULE_DIR$/../../%s" />
+    <orderEntry type="inheritedJdk" />
+    <orderEntry type="sourceFolder" forTests="false" />
+  </component>
+</module>
+`, xmlEscape(rel))
+		if err := cmd.writeFile(imlFilename, []byte(iml), -1); err != nil {
+			return err
+		}
+
+		group := repoGroup(cmd.BaseDir, r)
+		if group == "." {
+			group = ""
+		}
+		modules = append(modules, jetBrainsModule{
+			FileURL:  "file://$PROJECT_DIR$/.idea/modules/" + imlName,
+			FilePath: "$PROJECT_DIR$/.idea/modules/" + imlName,
+			Group:    group,
+		})
+	}
+	slices.SortFunc(modules, func(a, b jetBrainsModule) int { return strings.Compare(a.FilePath, b.FilePath) })
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<project version="4">` + "\n")
+	b.WriteString(`  <component name="ProjectModuleManager">` + "\n")
+	b.WriteString(`    <modules>` + "\n")
+	for _, m := range modules {
+		line, err := xml.Marshal(struct {
+			XMLName xml.Name `xml:"module"`
+			jetBrainsModule
+		}{jetBrainsModule: m})
+		if err != nil {
+			return err
+		}
+		b.WriteString("      " + string(line) + "\n")
+	}
+	b.WriteString(`    </modules>` + "\n")
+	b.WriteString(`  </component>` + "\n")
+	b.WriteString(`</project>` + "\n")
+
+	return cmd.writeFile(jetBrainsModulesFilename(cmd.BaseDir), b.Bytes(), len(modules))
+}
+
+// writeFile writes content to filename if it changed, reporting the number of
+// repos in it unless repos is negative.
+func (cmd *editorWorkspaceCmd) writeFile(filename string, content []byte, repos int) error {
+	if old, err := os.ReadFile(filename); err == nil && bytes.Equal(old, content) {
+		return nil
+	}
+	rel, _ := filepath.Rel(cmd.BaseDir, filename)
+	if cmd.Try {
+		if repos >= 0 {
+			fmt.Printf("[dry-run] Would write %s with %d repos\n", rel, repos)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename, content, 0o644); err != nil {
+		return err
+	}
+	if repos >= 0 {
+		fmt.Printf("Wrote %s with %d repos\n", rel, repos)
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
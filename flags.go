@@ -0,0 +1,302 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Every command has its own flag set with the flags it takes (see commands)
+// and the global ones; the flags can come before, between and after the
+// positional arguments. mygithelper help <command> and <command> --help
+// describe them.
+
+// options are the values of the flags of all commands.
+type options struct {
+	force, try, yes, worktree, pick, draft, sinceTag, autoMerge, keepGoing, reviewWeb     bool
+	revertMerged, jetBrains, traceExec, preview, diffUpdate, diffStat, ignored, artifacts bool
+	skipPreflight, retryFailed                                                            bool
+
+	title, bump, releaseTag, goCurrent, goPrev, hooksMode, mirrorDest, repoDir string
+	timeout, host, network                                                     string
+
+	goVersions []string
+	excludes   []string
+	discover   discoverCmd
+	clone      cloneOptions
+}
+
+// flagDef is a flag, defined in the flag sets of the commands that take it.
+type flagDef struct {
+	Name  string
+	Arg   string // The value in the help, e.g. "<dir>", "" for a bool flag
+	Usage string
+
+	boolVar func(o *options) *bool
+	set     func(o *options, value string) error
+}
+
+func boolFlag(name, usage string, field func(o *options) *bool) flagDef {
+	return flagDef{Name: name, Usage: usage, boolVar: field}
+}
+
+func stringFlag(name, arg, usage string, field func(o *options) *string) flagDef {
+	return flagDef{Name: name, Arg: arg, Usage: usage, set: func(o *options, value string) error {
+		*field(o) = value
+		return nil
+	}}
+}
+
+func funcFlag(name, arg, usage string, set func(o *options, value string) error) flagDef {
+	return flagDef{Name: name, Arg: arg, Usage: usage, set: set}
+}
+
+var flagDefs = []flagDef{
+	boolFlag("try", "Dry-run: show what would change without creating branches or PRs", func(o *options) *bool { return &o.try }),
+	boolFlag("yes", "Don't ask for confirmation before deleting anything", func(o *options) *bool { return &o.yes }),
+	boolFlag("force", "Go ahead where the command would stop", func(o *options) *bool { return &o.force }),
+	boolFlag("draft", "Open the update PRs as drafts", func(o *options) *bool { return &o.draft }),
+	boolFlag("keep-going", "Go on with the other repos when one fails and summarize at the end", func(o *options) *bool { return &o.keepGoing }),
+	boolFlag("review-web", "Push the branches and open the PR form in the browser instead of creating the PRs;\nthe review_web repo option does this for single repos", func(o *options) *bool { return &o.reviewWeb }),
+	stringFlag("bump", "patch|minor|major", "Which part of the latest vMAJOR.MINOR.PATCH tag release bumps (default patch)", func(o *options) *string { return &o.bump }),
+	stringFlag("tag", "<version>", "Release this version (e.g. v1.2.0) instead of bumping the latest tag", func(o *options) *string { return &o.releaseTag }),
+	boolFlag("preview", "Print the release notes without tagging anything", func(o *options) *bool { return &o.preview }),
+	boolFlag("auto-merge", "Enable auto-merge (squash) on the PRs created, so they merge when the checks pass", func(o *options) *bool { return &o.autoMerge }),
+	boolFlag("since-tag", "Before updating a repo, check its dependencies on repos in the gitjoin.txt\nfiles for commits after their latest tag, so they can be released first", func(o *options) *bool { return &o.sinceTag }),
+	boolFlag("worktree", "Work in temporary git worktrees below .mygithelper/work instead of the checkouts", func(o *options) *bool { return &o.worktree }),
+	funcFlag("go-version", "<version>[,<version>...]", "Go version matrix for workflows, oldest first (e.g. 1.25,1.26,tip).\nA single version is paired with the previous one.", func(o *options, value string) error {
+		var err error
+		o.goVersions, err = parseGoVersions(value)
+		return err
+	}),
+	funcFlag("go", "<version>", "Override the current Go version for this run instead of using the running Go,\ne.g. --go 1.27rc1", func(o *options, value string) error {
+		o.goCurrent = strings.TrimSuffix(value, ".x")
+		return nil
+	}),
+	funcFlag("prev-go", "<version>", "Override the previous Go version (default the one before --go)", func(o *options, value string) error {
+		o.goPrev = strings.TrimSuffix(value, ".x")
+		return nil
+	}),
+	stringFlag("path", "<dir>", "Only work on the repo cloned in <dir>, listed in a gitjoin.txt or not", func(o *options) *string { return &o.repoDir }),
+	boolFlag("skip-preflight", "Don't check that the remotes can be reached and the GitHub token works before\nstarting, e.g. when only some hosts are reachable", func(o *options) *bool { return &o.skipPreflight }),
+	boolFlag("retry-failed", "Only work on the repos that failed in the last update, as part of that run", func(o *options) *bool { return &o.retryFailed }),
+	boolFlag("pick", "Interactively pick the repos to work on (uses fzf if installed)", func(o *options) *bool { return &o.pick }),
+	funcFlag("depth", "<n>", "Clone with this much history, 0 for all (see clone_depth in the config)", func(o *options, value string) error {
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 0 {
+			return fmt.Errorf("invalid depth %q", value)
+		}
+		o.clone.Depth = depth
+		return nil
+	}),
+	stringFlag("filter", "<spec>", "Make partial clones, e.g. blob:none (see clone_filter in the config)", func(o *options) *string { return &o.clone.Filter }),
+	stringFlag("dest", "<dir>", "The directory to keep the mirrors in", func(o *options) *string { return &o.mirrorDest }),
+	stringFlag("org", "<name>", "The GitHub organization to add the repos of", func(o *options) *string { return &o.discover.Org }),
+	stringFlag("user", "<name>", "The GitHub user to add the repos of", func(o *options) *string { return &o.discover.User }),
+	stringFlag("language", "<lang>", "Only add repos with this primary language", func(o *options) *string { return &o.discover.Language }),
+	boolFlag("archived", "Also add archived repos", func(o *options) *bool { return &o.discover.Archived }),
+	boolFlag("forks", "Also add forks", func(o *options) *bool { return &o.discover.Forks }),
+	boolFlag("revert-merged", "Open revert PRs for the merged PRs", func(o *options) *bool { return &o.revertMerged }),
+	boolFlag("jetbrains", "Also write a .idea project", func(o *options) *bool { return &o.jetBrains }),
+	stringFlag("title", "<title>", "The title of the PRs", func(o *options) *string { return &o.title }),
+	boolFlag("ignored", "Include the ignored files, e.g. build output", func(o *options) *bool { return &o.ignored }),
+	boolFlag("artifacts", "Clean the files of past runs in .mygithelper beyond artifacts_max_days and\nartifacts_max_mb instead of the repos", func(o *options) *bool { return &o.artifacts }),
+	boolFlag("update", "Show the changes update would make, in temporary worktrees", func(o *options) *bool { return &o.diffUpdate }),
+	boolFlag("stat", "Show a diffstat instead of the diff", func(o *options) *bool { return &o.diffStat }),
+	stringFlag("mode", "symlink|copy|hooks_path", "How to install the hooks (see hooks_mode in the config)", func(o *options) *string { return &o.hooksMode }),
+
+	// Global flags.
+	boolFlag("bot", "Run unattended, e.g. in a scheduled GitHub Actions workflow (also MYGITHELPER_BOT=true):\ngit and gh use GH_TOKEN/GITHUB_TOKEN, commits are by github-actions[bot] unless\nGIT_AUTHOR_*/GIT_COMMITTER_* are set, and anything that would prompt fails", func(o *options) *bool { return &botMode }),
+	boolFlag("trace-exec", "Print the external commands as they run; they are always logged to\n.mygithelper/commands.log with their duration and exit code", func(o *options) *bool { return &o.traceExec }),
+	boolFlag("timings", "Print the slowest repos and steps at the end of the run", func(o *options) *bool { return &showTimings }),
+	stringFlag("network", "<name>", "Select the url_rewrites for this network (default $MYGITHELPER_NETWORK)", func(o *options) *string { return &o.network }),
+	stringFlag("host", "<name>", "Run the command on another machine over SSH, in the same directory below the home\ndirectory there or as set in hosts in the config, e.g. to update on a build server", func(o *options) *string { return &o.host }),
+	stringFlag("timeout", "<duration>", "Kill git, gh, go and shell commands that run longer, e.g. 15m\n(default none, except for network operations; see timeouts in the config)", func(o *options) *string { return &o.timeout }),
+	funcFlag("exclude", "<glob>[,<glob>...]", "Leave out the repos matching the globs (e.g. bep/experimental-*) for this run, like\n! lines in gitjoin.txt files and exclude in the config; may be repeated", func(o *options, value string) error {
+		for pattern := range strings.SplitSeq(value, ",") {
+			if err := validExclude(pattern); err != nil {
+				return err
+			}
+			o.excludes = append(o.excludes, pattern)
+		}
+		return nil
+	}),
+	stringFlag("group", "<dir|name>[,...]", "Only work on the repos of the groups (directories below the base dir with a gitjoin.txt\nor [section], or names in groups in the config), the groups below them and the groups\nthey include with include-group; with discover, the group to add the repos to\n(default the org or user name)", func(o *options) *string { return &o.discover.Group }),
+}
+
+// globalFlags are taken by all commands.
+var globalFlags = []string{"bot", "trace-exec", "timings", "network", "host", "timeout", "exclude", "group"}
+
+// command is a mygithelper command.
+type command struct {
+	Name  string
+	Args  string // The positional arguments, e.g. "<run-id>"
+	Usage string
+	Flags []string
+
+	// FlagUsage overrides the usage of flags that mean something of their
+	// own to the command.
+	FlagUsage map[string]string
+}
+
+var commands = []command{
+	{Name: "update", Usage: "Update Go versions, GitHub Actions, and dependencies", Flags: []string{"force", "try", "yes", "draft", "auto-merge", "since-tag", "worktree", "go-version", "go", "prev-go", "path", "skip-preflight", "retry-failed", "review-web", "keep-going", "pick"}, FlagUsage: map[string]string{
+		"force": "Open a PR also for a single update",
+	}},
+	{Name: "fix", Usage: "Run modernize -fix on all repos", Flags: []string{"try", "auto-merge", "worktree", "review-web", "keep-going", "pick"}},
+	{Name: "sync-files", Usage: "Render the sync_files templates into the repos and open PRs", Flags: []string{"try", "auto-merge", "worktree", "keep-going", "pick"}},
+	{Name: "prune-remote", Usage: "Delete remote branches merged into the default branch", Flags: []string{"try", "yes", "keep-going", "pick"}},
+	{Name: "prune-branches", Usage: "Delete the local and origin branches created by mygithelper once merged, also when\nsquash merged", Flags: []string{"try", "yes", "keep-going", "pick"}},
+	{Name: "sync-forks", Usage: "Point an upstream remote at the parent of forked repos and fast-forward their\ndefault branch to it, locally and on GitHub", Flags: []string{"try", "keep-going", "pick"}},
+	{Name: "revert-run", Args: "<run-id>", Usage: "Close the PRs of an update/fix run and delete their branches; with --revert-merged,\nopen revert PRs for merged ones", Flags: []string{"revert-merged", "try", "yes"}},
+	{Name: "pr", Args: "comment <run-id> <comment>", Usage: "Post the comment on the open PRs of an update/fix run", Flags: []string{"try"}},
+	{Name: "transaction", Args: "open|status|merge <name>", Usage: "open commits the uncommitted changes in the repos to a branch each and opens PRs\nlinking to each other (--title is required); status shows the state of the PRs, and\nmerge merges them in dependency order once all of them are green", Flags: []string{"title", "try", "pick"}},
+	{Name: "clean", Usage: "List the untracked files in the repos (with --ignored also the ignored ones, e.g.\nbuild output), or with --artifacts the files of past runs in .mygithelper beyond\nartifacts_max_days/_mb (removed before update, fix and sync-files too); --force\nremoves them", Flags: []string{"ignored", "artifacts", "force", "keep-going", "pick"}, FlagUsage: map[string]string{
+		"force": "Remove the files instead of listing them",
+	}},
+	{Name: "diff", Usage: "Show the uncommitted changes in the repos, or with --update the changes update would\nmake (in temporary worktrees)", Flags: []string{"update", "stat", "go-version", "go", "prev-go", "keep-going", "pick"}},
+	{Name: "unquarantine", Args: "[<repo>...]", Usage: "Let quarantined repos (failed quarantine_after runs in a row) be updated again;\nwithout repos, list the quarantined ones"},
+	{Name: "report", Usage: "Show which files the PRs change and which repos and steps fail most often, from the\nrecorded runs"},
+	{Name: "setup", Usage: "Interactively create groups and write the config"},
+	{Name: "get", Usage: "Clone the repos in gitjoin.txt files that are missing", Flags: []string{"depth", "filter", "skip-preflight", "try", "keep-going", "pick"}},
+	{Name: "mirror", Usage: "Keep bare mirror clones of all the repos in <dir>/<owner>/<name>.git as a backup,\ncloning the missing ones and updating the others", Flags: []string{"dest", "try", "keep-going", "pick"}},
+	{Name: "unshallow", Usage: "Convert shallow and partial clones to full clones", Flags: []string{"try", "keep-going", "pick"}},
+	{Name: "validate", Usage: "Check the gitjoin.txt files for problems and find stale clones"},
+	{Name: "go-versions", Usage: "Show the go and toolchain directives in go.mod next to the Go versions the CI\nworkflows test, flagging versions below the go directive", Flags: []string{"keep-going", "pick"}},
+	{Name: "audit", Usage: "Score the repos on license, README, CI, Dependabot, security alerts, branch\nprotection and the last CI run on the default branch", Flags: []string{"keep-going", "pick"}},
+	{Name: "release", Usage: "Tag the default branches with the next version, push the tags and create GitHub\nreleases with notes from the commits and PRs since the previous tag, grouped by\nlabel or commit type", Flags: []string{"bump", "tag", "preview", "try", "yes", "keep-going", "pick"}},
+	{Name: "hooks", Args: "install", Usage: "Install the git hooks in the hooks directory (hooks_dir) into the repos, by\nsymlink, copy, or by setting core.hooksPath", Flags: []string{"mode", "force", "try", "keep-going", "pick"}, FlagUsage: map[string]string{
+		"force": "Replace existing hooks that differ",
+	}},
+	{Name: "self-update", Usage: "Update mygithelper to the latest release", Flags: []string{"try"}},
+	{Name: "doctor", Usage: "Check git, Go, GitHub and SSH access and the config before a run"},
+	{Name: "verify-actions", Usage: "Check that the actions used in the workflows still resolve, flagging deleted or\nmoved pins and archived actions", Flags: []string{"pick"}},
+	{Name: "editor-workspace", Usage: "Write a VS Code workspace (and with --jetbrains a .idea project) with the cloned\nrepos by group; get keeps them up to date", Flags: []string{"jetbrains", "try"}},
+	{Name: "discover", Usage: "Add the repos of a GitHub org or user (--org or --user) to <group>/gitjoin.txt", Flags: []string{"org", "user", "language", "archived", "forks", "try"}},
+}
+
+func findCommand(name string) (command, bool) {
+	i := slices.IndexFunc(commands, func(c command) bool { return c.Name == name })
+	if i < 0 {
+		return command{}, false
+	}
+	return commands[i], true
+}
+
+func findFlag(name string) flagDef {
+	i := slices.IndexFunc(flagDefs, func(d flagDef) bool { return d.Name == name })
+	if i < 0 {
+		panic("unknown flag " + name)
+	}
+	return flagDefs[i]
+}
+
+// parseArgs parses the flags and positional arguments of cmd into o. It
+// returns flag.ErrHelp for -h and --help, and an error for positional
+// arguments to a command that takes none.
+func parseArgs(cmd command, args []string, o *options) (positional []string, err error) {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	for _, name := range slices.Concat(cmd.Flags, globalFlags) {
+		d := findFlag(name)
+		if d.boolVar != nil {
+			fs.BoolVar(d.boolVar(o), d.Name, *d.boolVar(o), d.Usage)
+		} else {
+			fs.Func(d.Name, d.Usage, func(value string) error { return d.set(o, value) })
+		}
+	}
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			// Everything after -- is positional.
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if cmd.Args == "" && len(positional) > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", positional[0])
+	}
+	return positional, nil
+}
+
+// printUsage prints the commands and the global flags.
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, "Usage: mygithelper <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		synopsis := strings.TrimSpace(c.Name + " " + c.Args)
+		fmt.Fprintf(w, "  %s\n%s\n", synopsis, indent(c.Usage, "        "))
+	}
+	fmt.Fprint(w, "\nGlobal flags:\n")
+	printFlags(w, globalFlags, nil)
+	fmt.Fprint(w, "\nRun mygithelper help <command> for the flags of a command.\n\nEnvironment:\n  OTEL_EXPORTER_OTLP_ENDPOINT  Send traces of the run (OTLP/HTTP JSON) to this collector\n")
+}
+
+// printCommandUsage prints the usage of cmd with its flags.
+func printCommandUsage(w io.Writer, cmd command) {
+	fmt.Fprintf(w, "Usage: mygithelper %s [flags]\n\n%s\n", strings.TrimSpace(cmd.Name+" "+cmd.Args), cmd.Usage)
+	if len(cmd.Flags) > 0 {
+		fmt.Fprint(w, "\nFlags:\n")
+		printFlags(w, cmd.Flags, cmd.FlagUsage)
+	}
+	fmt.Fprint(w, "\nGlobal flags:\n")
+	printFlags(w, globalFlags, nil)
+}
+
+func printFlags(w io.Writer, names []string, overrides map[string]string) {
+	for _, name := range names {
+		d := findFlag(name)
+		fmt.Fprintf(w, "  %s\n%s\n", strings.TrimSpace("--"+d.Name+" "+d.Arg), indent(cmp.Or(overrides[name], d.Usage), "        "))
+	}
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+// helpCommand runs mygithelper help [<command>], printing to w.
+func helpCommand(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		printUsage(w)
+		return nil
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		return fmt.Errorf("Unknown command: %s", args[0])
+	}
+	printCommandUsage(w, cmd)
+	return nil
+}
+
+// usageErrorf exits with the error and a pointer to the usage of cmd.
+func usageErrorf(cmd command, format string, args ...any) {
+	fatalf("mygithelper %s: %s\nUsage: mygithelper %s [flags]\nRun mygithelper help %s for more.", cmd.Name, fmt.Sprintf(format, args...), strings.TrimSpace(cmd.Name+" "+cmd.Args), cmd.Name)
+}
+
+// parseCommandArgs parses the arguments of the command in os.Args, exiting
+// with the usage on errors and printing the help for --help.
+func parseCommandArgs(cmd command, o *options) []string {
+	positional, err := parseArgs(cmd, os.Args[2:], o)
+	if errors.Is(err, flag.ErrHelp) {
+		printCommandUsage(os.Stdout, cmd)
+		os.Exit(0)
+	}
+	if err != nil {
+		usageErrorf(cmd, "%v", err)
+	}
+	return positional
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		cmd        string
+		args       []string
+		positional []string
+		want       func(o *options) any // The option to check.
+		wantValue  any
+		err        string
+	}{
+		{
+			name:      "bool flag",
+			cmd:       "update",
+			args:      []string{"--try"},
+			want:      func(o *options) any { return o.try },
+			wantValue: true,
+		},
+		{
+			name:      "single dash bool flag",
+			cmd:       "update",
+			args:      []string{"-draft"},
+			want:      func(o *options) any { return o.draft },
+			wantValue: true,
+		},
+		{
+			name:      "bool flag set false",
+			cmd:       "update",
+			args:      []string{"--try=false"},
+			want:      func(o *options) any { return o.try },
+			wantValue: false,
+		},
+		{
+			name:      "flag=value",
+			cmd:       "release",
+			args:      []string{"--bump=minor"},
+			want:      func(o *options) any { return o.bump },
+			wantValue: "minor",
+		},
+		{
+			name:      "flag value",
+			cmd:       "release",
+			args:      []string{"-tag", "v1.2.0"},
+			want:      func(o *options) any { return o.releaseTag },
+			wantValue: "v1.2.0",
+		},
+		{
+			name:      "func flag",
+			cmd:       "update",
+			args:      []string{"--go-version", "1.25.x,1.26"},
+			want:      func(o *options) any { return o.goVersions },
+			wantValue: []string{"1.25", "1.26"},
+		},
+		{
+			name:      "repeated flag",
+			cmd:       "update",
+			args:      []string{"--exclude", "bep/a", "--exclude=bep/b-*,bep/c"},
+			want:      func(o *options) any { return o.excludes },
+			wantValue: []string{"bep/a", "bep/b-*", "bep/c"},
+		},
+		{
+			name:      "global flag",
+			cmd:       "doctor",
+			args:      []string{"--timeout", "15m"},
+			want:      func(o *options) any { return o.timeout },
+			wantValue: "15m",
+		},
+		{
+			name:       "flags between positional arguments",
+			cmd:        "pr",
+			args:       []string{"comment", "--try", "123", "LGTM"},
+			positional: []string{"comment", "123", "LGTM"},
+			want:       func(o *options) any { return o.try },
+			wantValue:  true,
+		},
+		{
+			name:       "after --",
+			cmd:        "pr",
+			args:       []string{"comment", "123", "--", "--try"},
+			positional: []string{"comment", "123", "--try"},
+			want:       func(o *options) any { return o.try },
+			wantValue:  false,
+		},
+		{
+			name: "positional argument to a command taking none",
+			cmd:  "update",
+			args: []string{"--try", "extra"},
+			err:  `unexpected argument "extra"`,
+		},
+		{
+			name: "unknown flag",
+			cmd:  "update",
+			args: []string{"--nope"},
+			err:  "flag provided but not defined: -nope",
+		},
+		{
+			name: "flag of another command",
+			cmd:  "doctor",
+			args: []string{"--try"},
+			err:  "flag provided but not defined: -try",
+		},
+		{
+			name: "missing value",
+			cmd:  "release",
+			args: []string{"--bump"},
+			err:  "flag needs an argument: -bump",
+		},
+		{
+			name: "invalid value",
+			cmd:  "get",
+			args: []string{"--depth=-1"},
+			err:  `invalid value "-1" for flag -depth: invalid depth "-1"`,
+		},
+		{
+			name: "invalid bool",
+			cmd:  "update",
+			args: []string{"--try=maybe"},
+			err:  `invalid boolean value "maybe" for -try: parse error`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cmd, ok := findCommand(test.cmd)
+			if !ok {
+				t.Fatalf("no command %s", test.cmd)
+			}
+			var o options
+			positional, err := parseArgs(cmd, test.args, &o)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(positional, test.positional) {
+				t.Errorf("got positional %q, want %q", positional, test.positional)
+			}
+			if got := test.want(&o); !reflect.DeepEqual(got, test.wantValue) {
+				t.Errorf("got %v, want %v", got, test.wantValue)
+			}
+		})
+	}
+}
+
+func TestParseArgsHelp(t *testing.T) {
+	cmd, _ := findCommand("update")
+	for _, args := range [][]string{{"-h"}, {"--help"}, {"--try", "-help"}} {
+		if _, err := parseArgs(cmd, args, &options{}); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("%q: got %v, want flag.ErrHelp", args, err)
+		}
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	var b strings.Builder
+	if err := helpCommand(&b, []string{"release"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Usage: mygithelper release [flags]", "--bump patch|minor|major", "\nGlobal flags:\n", "--timeout <duration>"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in\n%s", want, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "--go-version") {
+		t.Errorf("flags of other commands in\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := helpCommand(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range commands {
+		if !strings.Contains(b.String(), "\n  "+c.Name) {
+			t.Errorf("missing command %s in the usage", c.Name)
+		}
+	}
+
+	if err := helpCommand(&b, []string{"nope"}); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// forkRemote is the remote for our fork of a repo we can't push to.
+const forkRemote = "fork"
+
+// pushTarget returns the remote to push the branches for repo to and the
+// prefix of the PR head: origin and "" if we can push to the repo, and
+// otherwise (or with the fork option) our fork of it, created if needed, and
+// "<owner>:" for a cross-fork PR.
+func (cfg *config) pushTarget(repo repo) (remote, headPrefix string, err error) {
+	if !cfg.repo(repo.Path).Fork {
+		var r githubRepo
+		if err := githubAPI("repos/"+repo.Path, &r); err != nil || r.Permissions.Push {
+			// If we can't tell, the push will.
+			return "origin", "", nil
+		}
+		fmt.Printf("No push access to %s, using a fork\n", repo.Path)
+	}
+
+	fork, err := ensureFork(repo.Path)
+	if err != nil {
+		return "", "", err
+	}
+	if err := setRemote(repo.Dir, forkRemote, cfg.cloneURL(fork)); err != nil {
+		return "", "", err
+	}
+
+	owner, _, _ := strings.Cut(fork, "/")
+	return forkRemote, owner + ":", nil
+}
+
+// setRemote adds the named remote, or points it to url if it exists.
+func setRemote(repoDir, name, url string) error {
+	var err error
+	if current, e := gitOutput(repoDir, "remote", "get-url", name); e != nil {
+		err = gitRun(repoDir, "remote", "add", name, url)
+	} else if strings.TrimSpace(current) != url {
+		err = gitRun(repoDir, "remote", "set-url", name, url)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up the %s remote: %w", name, err)
+	}
+	return nil
+}
+
+// ensureFork returns our fork of repoPath, e.g. "me/hugo", forking it first
+// if we haven't yet. GitHub returns the existing fork if there is one.
+func ensureFork(repoPath string) (string, error) {
+	var fork githubRepo
+	if err := githubRequest("POST", "repos/"+repoPath+"/forks", map[string]any{"default_branch_only": true}, &fork); err != nil {
+		return "", fmt.Errorf("failed to fork %s: %w", repoPath, err)
+	}
+
+	// Forking happens in the background; wait for the branches to show up
+	// before pushing.
+	for range 30 {
+		var branches []struct {
+			Name string `json:"name"`
+		}
+		if err := githubAPI("repos/"+fork.FullName+"/branches?per_page=1", &branches); err == nil && len(branches) > 0 {
+			return fork.FullName, nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return "", fmt.Errorf("timed out waiting for the fork %s", fork.FullName)
+}
+
+// pushBranch pushes branch for repo to origin or, without push access, to
+// our fork, and returns the head to open the PR from.
+func (cfg *config) pushBranch(repo repo, branch string) (head string, err error) {
+	remote, headPrefix, err := cfg.pushTarget(repo)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Pushing branch %s to %s...\n", branch, remote)
+	args := []string{"push", remote, branch}
+	if cfg.localBranch(repo.Path) == "track" {
+		args = []string{"push", "-u", remote, branch}
+	}
+	if err := gitRun(repo.Dir, args...); err != nil {
+		return "", fmt.Errorf("failed to push: %w", err)
+	}
+	return headPrefix + branch, nil
+}
+
+// leaveBranch leaves the local branch of a pushed PR behind in repo.Dir,
+// checking out defaultBranch unless it's a worktree of the run, and deletes
+// it if local_branch says so.
+func (cfg *config) leaveBranch(repo repo, branch, defaultBranch string, worktree bool) error {
+	if worktree {
+		if cfg.localBranch(repo.Path) != "delete" {
+			return nil
+		}
+		if err := gitRun(repo.Dir, "checkout", "--detach"); err != nil {
+			return fmt.Errorf("failed to detach HEAD: %w", err)
+		}
+	} else if err := gitRun(repo.Dir, "checkout", defaultBranch); err != nil {
+		return fmt.Errorf("failed to checkout %s: %w", defaultBranch, err)
+	}
+	if cfg.localBranch(repo.Path) == "delete" {
+		if err := gitRun(repo.Dir, "branch", "-D", branch); err != nil {
+			return fmt.Errorf("failed to delete branch %s: %w", branch, err)
+		}
+	}
+	return nil
+}
+
+// --- Sync forks command ---
+
+// upstreamRemote is the remote for the parent of a forked repo.
+const upstreamRemote = "upstream"
+
+// syncForksCmd fast-forwards the default branch of the repos that are forks
+// to the default branch of their parent, locally and on GitHub.
+type syncForksCmd struct {
+	BaseDir   string
+	Config    *config
+	Try       bool
+	KeepGoing bool
+	Pick      bool
+
+	summary runSummary
+}
+
+func (cmd *syncForksCmd) Run() error {
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	return forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.syncFork)
+}
+
+func (cmd *syncForksCmd) syncFork(repo repo) error {
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+
+	var r githubRepo
+	if err := githubAPI("repos/"+repo.Path, &r); err != nil {
+		return fmt.Errorf("%s: failed to get repo: %w", repo.Path, err)
+	}
+	if !r.Fork || r.Parent == nil {
+		return skipRepo("not a fork")
+	}
+	parent := r.Parent
+	printSection(fmt.Sprintf("Syncing %s with %s", repo.Path, parent.FullName))
+
+	if err := setRemote(repo.Dir, upstreamRemote, cmd.Config.cloneURL(parent.FullName)); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	if err := gitRun(repo.Dir, "fetch", "origin"); err != nil {
+		return fmt.Errorf("%s: failed to fetch origin: %w", repo.Path, err)
+	}
+	if err := gitRun(repo.Dir, "fetch", upstreamRemote); err != nil {
+		return fmt.Errorf("%s: failed to fetch %s: %w", repo.Path, upstreamRemote, err)
+	}
+
+	branch, err := cmd.Config.defaultBranch(repo)
+	if err != nil {
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	}
+	upstreamBranch := upstreamRemote + "/" + cmp.Or(parent.DefaultBranch, branch)
+
+	behind, err := gitOutput(repo.Dir, "rev-list", "--count", "origin/"+branch+".."+upstreamBranch)
+	if err != nil {
+		return fmt.Errorf("%s: failed to compare with %s: %w", repo.Path, upstreamBranch, err)
+	}
+	behind = strings.TrimSpace(behind)
+	if behind == "0" {
+		fmt.Printf("%s is up to date with %s\n", branch, upstreamBranch)
+	} else {
+		if err := gitRun(repo.Dir, "merge-base", "--is-ancestor", "origin/"+branch, upstreamBranch); err != nil {
+			return fmt.Errorf("%s: %s has diverged from %s, sync it by hand", repo.Path, branch, upstreamBranch)
+		}
+		if cmd.Try {
+			fmt.Printf("[dry-run] Would fast-forward %s by %s commit(s) from %s\n", branch, behind, upstreamBranch)
+			return nil
+		}
+		fmt.Printf("Fast-forwarding %s on origin by %s commit(s) from %s\n", branch, behind, upstreamBranch)
+		if err := gitRun(repo.Dir, "push", "origin", upstreamBranch+":refs/heads/"+branch); err != nil {
+			return fmt.Errorf("%s: failed to push: %w", repo.Path, err)
+		}
+		if err := gitRun(repo.Dir, "fetch", "origin", branch); err != nil {
+			return fmt.Errorf("%s: failed to fetch origin: %w", repo.Path, err)
+		}
+	}
+
+	return cmd.fastForwardLocal(repo, branch)
+}
+
+// fastForwardLocal fast-forwards the local branch to origin, if it exists
+// and hasn't diverged.
+func (cmd *syncForksCmd) fastForwardLocal(repo repo, branch string) error {
+	if !gitRead.refExists(repo.Dir, "refs/heads/"+branch) {
+		return nil
+	}
+	if err := gitRun(repo.Dir, "merge-base", "--is-ancestor", branch, "origin/"+branch); err != nil {
+		fmt.Printf("Local %s has commits not on origin, leaving it\n", branch)
+		return nil
+	}
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would fast-forward local %s to origin/%s\n", branch, branch)
+		return nil
+	}
+
+	current, _ := gitRead.currentBranch(repo.Dir)
+	var err error
+	if current == branch {
+		err = gitRun(repo.Dir, "merge", "--ff-only", "origin/"+branch)
+	} else {
+		err = gitRun(repo.Dir, "fetch", ".", "origin/"+branch+":"+branch)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: failed to fast-forward local %s: %w", repo.Path, branch, err)
+	}
+	return nil
+}
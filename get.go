@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// --- Get command ---
+
+type getCmd struct {
+	BaseDir   string
+	Config    *config
+	Clone     cloneOptions // Overrides the clone options from the config
+	Try       bool
+	KeepGoing bool // Go on with the other repos when one fails
+	Pick      bool // Interactively pick the repos to work on
+
+	NoPreflight bool // Skip the access checks before cloning
+
+	summary runSummary
+}
+
+func (cmd *getCmd) Run() error {
+	repos, err := listRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if err := checkDirCollisions(repos); err != nil {
+		return err
+	}
+
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+
+	if !cmd.NoPreflight && !cmd.Try {
+		missing := slices.DeleteFunc(slices.Clone(repos), func(r repo) bool { return dirExists(r.Dir) })
+		if len(missing) > 0 {
+			if err := cmd.Config.preflight(cmd.BaseDir, missing, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	opts := cmd.Config.cloneOptions()
+	if cmd.Clone.Depth > 0 {
+		opts.Depth = cmd.Clone.Depth
+	}
+	if cmd.Clone.Filter != "" {
+		opts.Filter = cmd.Clone.Filter
+	}
+
+	err = forEachRepo(repos, cmd.KeepGoing, &cmd.summary, func(repo repo) error {
+		if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		}
+		rc := cmd.Config.repo(repo.Path)
+		if dirExists(repo.Dir) {
+			if !isCheckout(repo.Dir) {
+				return fmt.Errorf("%s: %s exists but is not a git clone; move it away to clone the repo there", repo.Path, repo.Dir)
+			}
+			if err := cmd.syncSparseCheckout(repo, rc.SparseCheckout); err != nil {
+				return fmt.Errorf("%s: %w", repo.Path, err)
+			}
+			if rc.Ref != "" {
+				return cmd.checkoutRef(repo, rc.Ref)
+			}
+			return nil
+		}
+		if cmd.Try {
+			fmt.Printf("[dry-run] Would clone %s into %s\n", repo.Path, repo.Dir)
+			return nil
+		}
+		fmt.Printf("%sCloning %s...\n", progressPrefix(), repo.Path)
+		repoOpts := opts
+		repoOpts.Branch = rc.Branch
+		if rc.Ref != "" && !commitHashRe.MatchString(rc.Ref) {
+			// Branches and tags can be cloned directly, also shallow.
+			repoOpts.Branch = rc.Ref
+		}
+		repoOpts.Sparse = rc.SparseCheckout
+		if err := cloneRepo(repo, cmd.Config.cloneURL(repo.Path), repoOpts); err != nil {
+			return fmt.Errorf("%s: failed to clone: %w\nCheck that you have access to the repo and that your SSH key or credentials are set up", repo.Path, err)
+		}
+		cmd.summary.Cloned = append(cmd.summary.Cloned, repo.Path)
+		if rc.Ref != "" && repoOpts.Branch != rc.Ref {
+			return cmd.checkoutRef(repo, rc.Ref)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+	return refreshEditorWorkspaces(cmd.BaseDir, cmd.Try)
+}
+
+type cloneOptions struct {
+	Depth  int      // --depth, 0 for full history
+	Filter string   // --filter, e.g. "blob:none" for a partial clone
+	Branch string   // --branch, empty for the remote's default branch
+	Sparse []string // Directories for a cone mode sparse checkout, empty for all
+}
+
+// syncSparseCheckout makes the sparse checkout of an existing clone match the
+// configured paths.
+func (cmd *getCmd) syncSparseCheckout(repo repo, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	current, _ := gitOutput(repo.Dir, "sparse-checkout", "list")
+	if slices.Equal(strings.Fields(current), paths) {
+		return nil
+	}
+
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would set sparse checkout of %s to %s\n", repo.Path, strings.Join(paths, " "))
+		return nil
+	}
+
+	fmt.Printf("Setting sparse checkout of %s to %s...\n", repo.Path, strings.Join(paths, " "))
+	if err := gitRun(repo.Dir, append([]string{"sparse-checkout", "set", "--cone"}, paths...)...); err != nil {
+		return fmt.Errorf("failed to set sparse checkout: %w", err)
+	}
+	cmd.summary.CheckedOut = append(cmd.summary.CheckedOut, repo.Path)
+	return nil
+}
+
+// commitHashRe matches an abbreviated or full commit hash.
+var commitHashRe = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// checkoutRef checks out the ref the repo is pinned to, unless the checkout
+// is already there or has uncommitted changes.
+func (cmd *getCmd) checkoutRef(repo repo, ref string) error {
+	if atRef(repo.Dir, ref) {
+		return nil
+	}
+	if dirty, _, err := checkUncommitted(repo.Dir); err != nil {
+		return err
+	} else if dirty {
+		fmt.Printf("Warning: %s is pinned to %s but has uncommitted changes, leaving it as is\n", repo.Path, ref)
+		return nil
+	}
+
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would check out %s in %s\n", ref, repo.Path)
+		return nil
+	}
+	fmt.Printf("Checking out %s in %s...\n", ref, repo.Path)
+	if err := gitRun(repo.Dir, "checkout", "--quiet", ref); err != nil {
+		// The ref may be newer than the last fetch.
+		if err := gitRun(repo.Dir, "fetch", "--tags", "origin"); err != nil {
+			return fmt.Errorf("%s: failed to fetch: %w", repo.Path, err)
+		}
+		if err := gitRun(repo.Dir, "checkout", "--quiet", ref); err != nil {
+			return fmt.Errorf("%s: failed to check out %s: %w", repo.Path, ref, err)
+		}
+	}
+	cmd.summary.CheckedOut = append(cmd.summary.CheckedOut, repo.Path)
+	return nil
+}
+
+// atRef reports whether the checkout in dir is on the branch ref or at the
+// commit ref points to.
+func atRef(dir, ref string) bool {
+	if branch, err := gitRead.currentBranch(dir); err == nil && branch == ref {
+		return true
+	}
+	head, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return false
+	}
+	want, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil && head == want
+}
+
+func cloneRepo(repo repo, url string, opts cloneOptions) error {
+	args := []string{"clone"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.Filter != "" {
+		args = append(args, "--filter="+opts.Filter)
+	}
+	if opts.Branch != "" {
+		args = append(args, "--branch", opts.Branch)
+	}
+	if len(opts.Sparse) > 0 {
+		args = append(args, "--sparse")
+	}
+	args = append(args, url, filepath.Base(repo.Dir))
+
+	parent := filepath.Dir(repo.Dir)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return err
+	}
+	if err := gitRun(parent, args...); err != nil {
+		return err
+	}
+
+	if len(opts.Sparse) > 0 {
+		if err := gitRun(repo.Dir, append([]string{"sparse-checkout", "set", "--cone"}, opts.Sparse...)...); err != nil {
+			return fmt.Errorf("failed to set sparse checkout: %w", err)
+		}
+	}
+	return nil
+}
+
+// --- Unshallow command ---
+
+type unshallowCmd struct {
+	BaseDir   string
+	Config    *config
+	Try       bool
+	KeepGoing bool // Go on with the other repos when one fails
+	Pick      bool // Interactively pick the repos to work on
+
+	summary runSummary
+}
+
+func (cmd *unshallowCmd) Run() error {
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+
+	return forEachRepo(repos, cmd.KeepGoing, &cmd.summary, func(repo repo) error {
+		if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		}
+		shallow, _ := gitOutput(repo.Dir, "rev-parse", "--is-shallow-repository")
+		filter, _ := gitOutput(repo.Dir, "config", "--get", "remote.origin.partialclonefilter")
+		isShallow := strings.TrimSpace(shallow) == "true"
+		isPartial := strings.TrimSpace(filter) != ""
+
+		if !isShallow && !isPartial {
+			return nil
+		}
+
+		if cmd.Try {
+			fmt.Printf("[dry-run] Would convert %s to a full clone\n", repo.Path)
+			return nil
+		}
+
+		fmt.Printf("Converting %s to a full clone...\n", repo.Path)
+		if isShallow {
+			if err := gitRun(repo.Dir, "fetch", "--unshallow", "origin"); err != nil {
+				return fmt.Errorf("%s: failed to unshallow: %w", repo.Path, err)
+			}
+		}
+		if isPartial {
+			if err := gitRun(repo.Dir, "config", "--unset", "remote.origin.partialclonefilter"); err != nil {
+				return fmt.Errorf("%s: failed to remove partial clone filter: %w", repo.Path, err)
+			}
+			if err := gitRun(repo.Dir, "fetch", "--refetch", "origin"); err != nil {
+				return fmt.Errorf("%s: failed to refetch: %w", repo.Path, err)
+			}
+			if err := gitRun(repo.Dir, "config", "--unset", "remote.origin.promisor"); err != nil {
+				return fmt.Errorf("%s: failed to remove promisor remote: %w", repo.Path, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// githubHost returns the GitHub host we're talking to: github.com, or the
+// GitHub Enterprise Server in GH_HOST, set per repo by useIdentity.
+func githubHost() string {
+	return cmp.Or(os.Getenv("GH_HOST"), "github.com")
+}
+
+// githubAPIURL returns the base URL of the REST API of githubHost.
+func githubAPIURL() string {
+	if host := githubHost(); host != "github.com" {
+		return "https://" + host + "/api/v3/"
+	}
+	return "https://api.github.com/"
+}
+
+// githubWebURL returns the URL of path (e.g. "bep/firstupdotenv") on the
+// website of githubHost.
+func githubWebURL(path string) string {
+	return "https://" + githubHost() + "/" + path
+}
+
+// githubRepo is the subset of the GitHub API repository object we use.
+type githubRepo struct {
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+	Archived      bool   `json:"archived"`
+	Fork          bool   `json:"fork"`
+	Private       bool   `json:"private"`
+	Language      string `json:"language"`
+
+	// Parent is the repo a fork was forked from, only in responses for a
+	// single repo.
+	Parent *githubRepo `json:"parent"`
+
+	// Permissions of the authenticated user, only in responses for a single
+	// repo.
+	Permissions struct {
+		Push bool `json:"push"`
+	} `json:"permissions"`
+}
+
+// hasGh reports whether gh (GitHub CLI) is installed (use shell to resolve
+// aliases).
+var hasGh = sync.OnceValue(func() bool {
+	return shellCommandExists("gh") == nil
+})
+
+// githubToken returns the token used for the REST API when gh isn't installed.
+func githubToken() string {
+	// Like gh, prefer the enterprise tokens for GitHub Enterprise Server.
+	if githubHost() != "github.com" {
+		if token := cmp.Or(os.Getenv("GH_ENTERPRISE_TOKEN"), os.Getenv("GITHUB_ENTERPRISE_TOKEN")); token != "" {
+			return token
+		}
+	}
+	return cmp.Or(os.Getenv("GH_TOKEN"), os.Getenv("GITHUB_TOKEN"))
+}
+
+// validHost reports whether host looks like a hostname, e.g.
+// github.example.com.
+func validHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, "/:@ \t")
+}
+
+// requireGitHub returns an error if there is no way to talk to GitHub.
+func requireGitHub() error {
+	if hasGh() || githubToken() != "" {
+		return nil
+	}
+	return fmt.Errorf("gh (GitHub CLI) or a GH_TOKEN/GITHUB_TOKEN is required.\nInstall: https://cli.github.com/")
+}
+
+// githubAPI calls the GitHub REST API at path (e.g. "repos/bep/firstupdotenv")
+// and decodes the JSON response into v.
+func githubAPI(path string, v any) error {
+	return githubRequest("GET", path, nil, v)
+}
+
+// githubRequest sends a request with an optional JSON body to the GitHub REST
+// API, via gh if installed and directly otherwise, and decodes the JSON
+// response into v if v is not nil.
+func githubRequest(method, path string, body, v any) error {
+	var input []byte
+	if body != nil {
+		var err error
+		if input, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	var output []byte
+	if hasGh() {
+		args := []string{"api", "-X", method, path}
+		if input != nil {
+			args = append(args, "--input", "-")
+		}
+		out, err := ghOutputWithInput(input, args...)
+		if err != nil {
+			return err
+		}
+		output = []byte(out)
+	} else {
+		out, _, err := githubHTTP(method, githubAPIURL()+path, input)
+		if err != nil {
+			return err
+		}
+		output = out
+	}
+
+	if v == nil || len(bytes.TrimSpace(output)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(output, v)
+}
+
+// githubAPIList fetches all pages of a GitHub REST API list endpoint.
+func githubAPIList[T any](path string) ([]T, error) {
+	var all []T
+
+	if !hasGh() {
+		for url := githubAPIURL() + path; url != ""; {
+			output, header, err := githubHTTP("GET", url, nil)
+			if err != nil {
+				return nil, err
+			}
+			var page []T
+			if err := json.Unmarshal(output, &page); err != nil {
+				return nil, err
+			}
+			all = append(all, page...)
+			url = nextPageURL(header.Get("Link"))
+		}
+		return all, nil
+	}
+
+	output, err := ghOutput("api", "--paginate", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// gh writes one JSON array per page.
+	dec := json.NewDecoder(strings.NewReader(output))
+	for {
+		var page []T
+		if err := dec.Decode(&page); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		all = append(all, page...)
+	}
+	return all, nil
+}
+
+// isNotFound reports whether err is the GitHub API's response for a missing
+// resource. Unknown commits get a 422.
+func isNotFound(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "(HTTP 404)") || strings.Contains(err.Error(), "(HTTP 422)"))
+}
+
+func githubHTTP(method, url string, body []byte) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+githubToken())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	output, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(output, &apiErr) == nil && apiErr.Message != "" {
+			return nil, nil, fmt.Errorf("%s (HTTP %d)", apiErr.Message, resp.StatusCode)
+		}
+		return nil, nil, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return output, resp.Header, nil
+}
+
+var linkNextRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPageURL returns the rel="next" URL from a Link header, if any.
+func nextPageURL(link string) string {
+	if m := linkNextRe.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func ghOutput(args ...string) (string, error) {
+	return ghOutputWithInput(nil, args...)
+}
+
+func ghOutputWithInput(input []byte, args ...string) (string, error) {
+	cmd, done := newCommand(context.Background(), "gh", args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	rec := startExec(cmd)
+	output, err := cmd.Output()
+	rec.finish(err)
+	if err := done(err); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(output), nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitReader answers the read-only questions about a repo we ask for every
+// repo in a run. Mutations always go through the git CLI.
+type gitReader interface {
+	// currentBranch returns the checked out branch, or "HEAD" if detached.
+	currentBranch(dir string) (string, error)
+
+	// symbolicRef returns the full name of the ref that ref (e.g.
+	// "refs/remotes/origin/HEAD") points to.
+	symbolicRef(dir, ref string) (string, error)
+
+	// refExists reports whether the full ref name (e.g. "refs/tags/v1.0.0")
+	// exists.
+	refExists(dir, ref string) bool
+
+	// status returns the output of git status --porcelain.
+	status(dir string) (string, error)
+}
+
+// gitReaders are the backends for git_backend: "cli" (the default) runs git
+// for each query, "native" reads the refs, the index and the objects from the
+// .git directory, which saves a process per query on large fleets and falls
+// back to git for what it can't read (e.g. reftable repos) or when the status
+// isn't clean.
+var gitReaders = map[string]gitReader{
+	"cli":    cliGitReader{},
+	"native": nativeGitReader{},
+}
+
+// gitRead is the gitReader in use, set from git_backend.
+var gitRead gitReader = cliGitReader{}
+
+type cliGitReader struct{}
+
+func (cliGitReader) currentBranch(dir string) (string, error) {
+	output, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	return strings.TrimSpace(output), err
+}
+
+func (cliGitReader) symbolicRef(dir, ref string) (string, error) {
+	output, err := gitOutput(dir, "symbolic-ref", ref)
+	return strings.TrimSpace(output), err
+}
+
+func (cliGitReader) refExists(dir, ref string) bool {
+	_, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+func (cliGitReader) status(dir string) (string, error) {
+	return gitOutput(dir, "status", "--porcelain")
+}
+
+type nativeGitReader struct{}
+
+// errNotNative is returned by the native reader for repos it can't read.
+var errNotNative = errors.New("not readable without git")
+
+func (r nativeGitReader) currentBranch(dir string) (string, error) {
+	target, err := r.readSymbolic(dir, "HEAD")
+	if errors.Is(err, errNotNative) {
+		return cliGitReader{}.currentBranch(dir)
+	}
+	if err != nil {
+		return "", err
+	}
+	if target == "" {
+		return "HEAD", nil
+	}
+	return strings.TrimPrefix(target, "refs/heads/"), nil
+}
+
+func (r nativeGitReader) symbolicRef(dir, ref string) (string, error) {
+	target, err := r.readSymbolic(dir, ref)
+	if errors.Is(err, errNotNative) {
+		return cliGitReader{}.symbolicRef(dir, ref)
+	}
+	if err != nil {
+		return "", err
+	}
+	if target == "" {
+		return "", fmt.Errorf("%s is not a symbolic ref", ref)
+	}
+	return target, nil
+}
+
+func (r nativeGitReader) refExists(dir, ref string) bool {
+	gitDir, commonDir, err := r.gitDirs(dir)
+	if err != nil {
+		return cliGitReader{}.refExists(dir, ref)
+	}
+	if fileExists(filepath.Join(refDir(gitDir, commonDir, ref), filepath.FromSlash(ref))) {
+		return true
+	}
+	found, err := packedRefExists(commonDir, ref)
+	if err != nil {
+		return cliGitReader{}.refExists(dir, ref)
+	}
+	return found
+}
+
+func (r nativeGitReader) status(dir string) (string, error) {
+	if r.nativeClean(dir) == nil {
+		return "", nil
+	}
+	return cliGitReader{}.status(dir)
+}
+
+// readSymbolic returns the ref the loose ref file points to, or "" if it
+// holds a commit.
+func (r nativeGitReader) readSymbolic(dir, ref string) (string, error) {
+	gitDir, commonDir, err := r.gitDirs(dir)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(filepath.Join(refDir(gitDir, commonDir, ref), filepath.FromSlash(ref)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%s not found", ref)
+		}
+		return "", err
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "ref: ")
+	if !ok {
+		return "", nil
+	}
+	return target, nil
+}
+
+// gitDirs returns the git directory of the checkout in dir and the common
+// directory shared by its worktrees.
+func (nativeGitReader) gitDirs(dir string) (gitDir, commonDir string, err error) {
+	gitDir = filepath.Join(dir, ".git")
+	fi, err := os.Stat(gitDir)
+	if err != nil {
+		return "", "", errNotNative
+	}
+	if !fi.IsDir() {
+		// A worktree or submodule: .git is a file pointing to the git directory.
+		b, err := os.ReadFile(gitDir)
+		if err != nil {
+			return "", "", errNotNative
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir: ")
+		if !ok {
+			return "", "", errNotNative
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		gitDir = target
+	}
+
+	commonDir = gitDir
+	if b, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(b))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+	if dirExists(filepath.Join(commonDir, "reftable")) {
+		return "", "", errNotNative
+	}
+	return gitDir, commonDir, nil
+}
+
+// refDir returns the directory the loose ref is stored below: HEAD and the
+// other per-worktree refs in the worktree's git directory, the rest in the
+// common one.
+func refDir(gitDir, commonDir, ref string) string {
+	if strings.HasPrefix(ref, "refs/") && !strings.HasPrefix(ref, "refs/bisect/") && !strings.HasPrefix(ref, "refs/worktree/") {
+		return commonDir
+	}
+	return gitDir
+}
+
+func packedRefExists(commonDir, ref string) (bool, error) {
+	f, err := os.Open(filepath.Join(commonDir, "packed-refs"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// <sha> <ref>, with comments and ^<sha> lines for peeled tags.
+		if _, name, ok := strings.Cut(sc.Text(), " "); ok && name == ref {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNativeGitReader(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	for _, test := range []struct {
+		name string
+		// setup changes the repo in dir and returns the checkout to check.
+		setup func(t *testing.T, dir string) string
+		// clean is whether the native reader tells the checkout is clean
+		// without asking git.
+		clean bool
+	}{
+		{
+			name:  "clean",
+			setup: func(t *testing.T, dir string) string { return dir },
+			clean: true,
+		},
+		{
+			name: "modified with the same size",
+			setup: func(t *testing.T, dir string) string {
+				writeTestFile(t, dir, "a.txt", "A\n")
+				return dir
+			},
+		},
+		{
+			name: "untracked",
+			setup: func(t *testing.T, dir string) string {
+				writeTestFile(t, dir, "dir/new.txt", "new\n")
+				return dir
+			},
+		},
+		{
+			name: "staged",
+			setup: func(t *testing.T, dir string) string {
+				writeTestFile(t, dir, "c.txt", "c\n")
+				testGit(t, dir, "add", "c.txt")
+				settleTestRepo(t, dir)
+				return dir
+			},
+		},
+		{
+			name: "HEAD commit packed",
+			setup: func(t *testing.T, dir string) string {
+				testGit(t, dir, "repack", "-a", "-d", "-q")
+				testGit(t, dir, "prune-packed")
+				return dir
+			},
+			clean: true,
+		},
+		{
+			name: "packed-refs only",
+			setup: func(t *testing.T, dir string) string {
+				testGit(t, dir, "pack-refs", "--all")
+				return dir
+			},
+			clean: true,
+		},
+		{
+			name: "worktree",
+			setup: func(t *testing.T, dir string) string {
+				wt := filepath.Join(filepath.Dir(dir), "wt")
+				testGit(t, dir, "worktree", "add", "-q", "-b", "other", wt)
+				settleTestRepo(t, wt)
+				return wt
+			},
+			clean: true,
+		},
+		{
+			name: "detached HEAD",
+			setup: func(t *testing.T, dir string) string {
+				testGit(t, dir, "checkout", "-q", "--detach")
+				return dir
+			},
+			clean: true,
+		},
+		{
+			name: "skip-worktree",
+			setup: func(t *testing.T, dir string) string {
+				testGit(t, dir, "update-index", "--skip-worktree", "a.txt")
+				return dir
+			},
+		},
+		{
+			name: "sparse checkout",
+			setup: func(t *testing.T, dir string) string {
+				testGit(t, dir, "sparse-checkout", "set", "--no-cone", "dir/")
+				settleTestRepo(t, dir)
+				return dir
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := test.setup(t, newTestRepo(t))
+
+			cli, native := cliGitReader{}, nativeGitReader{}
+
+			cliStatus, err := cli.status(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nativeStatus, err := native.status(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nativeStatus != cliStatus {
+				t.Errorf("status: native %q, cli %q", nativeStatus, cliStatus)
+			}
+			if err := native.nativeClean(dir); (err == nil) != test.clean {
+				t.Errorf("nativeClean: got %v, want clean %t", err, test.clean)
+			}
+
+			cliBranch, cliErr := cli.currentBranch(dir)
+			nativeBranch, nativeErr := native.currentBranch(dir)
+			if nativeBranch != cliBranch || (nativeErr == nil) != (cliErr == nil) {
+				t.Errorf("currentBranch: native %q, %v, cli %q, %v", nativeBranch, nativeErr, cliBranch, cliErr)
+			}
+
+			cliRef, cliErr := cli.symbolicRef(dir, "HEAD")
+			nativeRef, nativeErr := native.symbolicRef(dir, "HEAD")
+			if nativeRef != cliRef || (nativeErr == nil) != (cliErr == nil) {
+				t.Errorf("symbolicRef: native %q, %v, cli %q, %v", nativeRef, nativeErr, cliRef, cliErr)
+			}
+
+			for _, ref := range []string{"refs/heads/main", "refs/tags/v1.0.0", "refs/tags/v2.0.0", "HEAD"} {
+				if got, want := native.refExists(dir, ref), cli.refExists(dir, ref); got != want {
+					t.Errorf("refExists(%s): native %t, cli %t", ref, got, want)
+				}
+			}
+		})
+	}
+}
+
+// newTestRepo creates a repo with a commit on main tagged v1.0.0, with the
+// files dated back so the index doesn't look racy.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, key := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(key, "Test")
+	}
+	for _, key := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(key, "test@example.com")
+	}
+
+	dir := filepath.Join(t.TempDir(), "repo")
+	testGit(t, "", "init", "-q", "-b", "main", dir)
+	writeTestFile(t, dir, "a.txt", "a\n")
+	writeTestFile(t, dir, "dir/b.txt", "b\n")
+	testGit(t, dir, "add", "-A")
+	testGit(t, dir, "commit", "-q", "-m", "Initial")
+	testGit(t, dir, "tag", "v1.0.0")
+	settleTestRepo(t, dir)
+	return dir
+}
+
+// settleTestRepo dates the files in dir back an hour and refreshes the
+// index, as if they were checked out a while ago.
+func settleTestRepo(t *testing.T, dir string) {
+	t.Helper()
+	past := time.Now().Add(-time.Hour)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return os.Chtimes(path, past, past)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGit(t, dir, "update-index", "-q", "--refresh")
+}
+
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestParseIndexMalformed(t *testing.T) {
+	for _, index := range []string{
+		"",
+		"DIRC",
+		"DIRC\x00\x00\x00\x04\x00\x00\x00\x00" + strings.Repeat("\x00", 20),
+		// A count far above what the size allows.
+		"DIRC\x00\x00\x00\x02\x10\x00\x00\x00TREE" + strings.Repeat("\x00", 28),
+		// An entry cut short.
+		"DIRC\x00\x00\x00\x02\x00\x00\x00\x01" + strings.Repeat("\x00", 40) + strings.Repeat("\x00", 20),
+		// An extension longer than the index.
+		"DIRC\x00\x00\x00\x02\x00\x00\x00\x00TREE\x00\x00\x10\x00" + strings.Repeat("\x00", 20),
+	} {
+		if _, _, err := parseIndex([]byte(index)); err == nil {
+			t.Errorf("parseIndex(%q): expected an error", index)
+		}
+	}
+}
+
+func TestPackOffsetMalformed(t *testing.T) {
+	// A fanout claiming 1000 objects in an index holding none.
+	b := []byte("\xfftOc\x00\x00\x00\x02")
+	for range 256 {
+		b = append(b, 0, 0, 0x03, 0xe8)
+	}
+	b = append(b, make([]byte, 10)...)
+	idxFile := filepath.Join(t.TempDir(), "pack-x.idx")
+	if err := os.WriteFile(idxFile, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	name := make([]byte, 20)
+	name[0] = 0x42
+	if _, _, err := packOffset(idxFile, name); err == nil {
+		t.Error("expected an error")
+	}
+}
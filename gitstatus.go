@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- Native git status ---
+
+// The native reader answers git status --porcelain for the common case of a
+// clean checkout: the index matches the HEAD commit (by its cached tree),
+// every tracked file has the size, modification time and mode recorded in the
+// index, and there are no other files. Anything else, including ignored files
+// and what it can't read, is left to git, which gives the exact status.
+
+// nativeClean returns nil if the checkout in dir is known to be clean, or
+// what kept it from telling.
+func (r nativeGitReader) nativeClean(dir string) error {
+	gitDir, commonDir, err := r.gitDirs(dir)
+	if err != nil {
+		return err
+	}
+	if b, err := os.ReadFile(filepath.Join(commonDir, "config")); err != nil || strings.Contains(string(b), "objectformat") {
+		// SHA-256 repos have other object names and index entries.
+		return errNotNative
+	}
+
+	indexFile := filepath.Join(gitDir, "index")
+	indexInfo, err := os.Stat(indexFile)
+	if err != nil {
+		return errNotNative
+	}
+	index, err := os.ReadFile(indexFile)
+	if err != nil {
+		return errNotNative
+	}
+	entries, tree, err := parseIndex(index)
+	if err != nil {
+		return err
+	}
+
+	head, err := r.resolveRef(gitDir, commonDir, "HEAD")
+	if err != nil {
+		return err
+	}
+	commit, err := readCommitObject(filepath.Join(commonDir, "objects"), head)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(commit, []byte("tree "+tree+"\n")) {
+		return errors.New("staged changes")
+	}
+
+	tracked := map[string]bool{}
+	for _, e := range entries {
+		if err := e.checkFile(dir, indexInfo); err != nil {
+			return err
+		}
+		tracked[e.Name] = true
+	}
+	return checkNoUntracked(dir, tracked)
+}
+
+// indexEntry is an entry of the git index with the stat data we compare.
+type indexEntry struct {
+	Name      string
+	MtimeSec  uint32
+	MtimeNsec uint32
+	Mode      uint32
+	Size      uint32
+}
+
+// parseIndex returns the entries of a version 2 or 3 index and the tree of
+// its cached tree extension, which is the tree a commit of the index has.
+func parseIndex(b []byte) ([]indexEntry, string, error) {
+	if len(b) < 12+20 || string(b[:4]) != "DIRC" {
+		return nil, "", errNotNative
+	}
+	if version := binary.BigEndian.Uint32(b[4:]); version != 2 && version != 3 {
+		return nil, "", errNotNative
+	}
+	count := int(binary.BigEndian.Uint32(b[8:]))
+	body := b[:len(b)-20] // Without the checksum.
+
+	// Each entry takes at least 62 bytes, whatever the header claims.
+	entries := make([]indexEntry, 0, min(count, len(body)/62))
+	pos := 12
+	for range count {
+		if pos+62 > len(body) {
+			return nil, "", errNotNative
+		}
+		e := body[pos:]
+		flags := binary.BigEndian.Uint16(e[60:])
+		if flags&0x8000 != 0 || flags&0x3000 != 0 {
+			// Assume-valid and unmerged entries.
+			return nil, "", errNotNative
+		}
+		nameStart := 62
+		if flags&0x4000 != 0 {
+			// Skip-worktree and intent-to-add entries.
+			return nil, "", errNotNative
+		}
+		nameEnd := bytes.IndexByte(e[nameStart:], 0)
+		if nameEnd < 0 {
+			return nil, "", errNotNative
+		}
+		entries = append(entries, indexEntry{
+			Name:      string(e[nameStart : nameStart+nameEnd]),
+			MtimeSec:  binary.BigEndian.Uint32(e[8:]),
+			MtimeNsec: binary.BigEndian.Uint32(e[12:]),
+			Mode:      binary.BigEndian.Uint32(e[24:]),
+			Size:      binary.BigEndian.Uint32(e[36:]),
+		})
+		// Entries are padded with 1-8 NULs to a multiple of 8 bytes.
+		pos += (nameStart + nameEnd + 8) &^ 7
+	}
+
+	// The extensions: a signature, a size and the data.
+	for pos+8 <= len(body) {
+		signature := string(body[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(body[pos+4:]))
+		data := body[pos+8:]
+		if size > len(data) {
+			return nil, "", errNotNative
+		}
+		data = data[:size]
+		pos += 8 + size
+		switch {
+		case signature == "TREE":
+			// The root comes first: "\x00<entries> <subtrees>\n<sha>",
+			// with -1 entries when it's invalidated.
+			path, rest, _ := bytes.Cut(data, []byte{0})
+			counts, rest, _ := bytes.Cut(rest, []byte{'\n'})
+			n, _, _ := bytes.Cut(counts, []byte{' '})
+			if len(path) != 0 || string(n) == "-1" || len(rest) < 20 {
+				return nil, "", errors.New("staged changes")
+			}
+			return entries, hex.EncodeToString(rest[:20]), nil
+		case signature[0] < 'A' || signature[0] > 'Z':
+			// Optional extensions start with an upper case letter; others,
+			// such as the split index link, must be understood.
+			return nil, "", errNotNative
+		}
+	}
+	return nil, "", errNotNative
+}
+
+// checkFile checks that the file of e in dir has the mode, size and
+// modification time recorded in the index. Files modified in the second the
+// index was written may have changed since, so they're left to git.
+func (e indexEntry) checkFile(dir string, indexInfo fs.FileInfo) error {
+	fi, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(e.Name)))
+	if err != nil {
+		return errors.New("missing files")
+	}
+	var mode uint32
+	switch {
+	case fi.Mode().IsRegular() && fi.Mode()&0o111 != 0:
+		mode = 0o100755
+	case fi.Mode().IsRegular():
+		mode = 0o100644
+	case fi.Mode()&fs.ModeSymlink != 0:
+		mode = 0o120000
+	default:
+		// Submodules and type changes.
+		return errNotNative
+	}
+	mtime := fi.ModTime()
+	if mode != e.Mode || uint32(fi.Size()) != e.Size ||
+		uint32(mtime.Unix()) != e.MtimeSec || uint32(mtime.Nanosecond()) != e.MtimeNsec ||
+		!mtime.Before(indexInfo.ModTime().Truncate(1e9)) {
+		return errors.New("modified files")
+	}
+	return nil
+}
+
+// checkNoUntracked checks that the worktree in dir has no files but the
+// tracked ones. Untracked files may be ignored, so it's for git to tell.
+func checkNoUntracked(dir string, tracked map[string]bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errNotNative
+		}
+		if path == dir {
+			return nil
+		}
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if !tracked[filepath.ToSlash(rel)] {
+			return errors.New("untracked files")
+		}
+		return nil
+	})
+}
+
+// resolveRef returns the commit ref points to, following symbolic refs.
+func (r nativeGitReader) resolveRef(gitDir, commonDir, ref string) (string, error) {
+	for range 5 {
+		b, err := os.ReadFile(filepath.Join(refDir(gitDir, commonDir, ref), filepath.FromSlash(ref)))
+		if errors.Is(err, os.ErrNotExist) {
+			return packedRef(commonDir, ref)
+		}
+		if err != nil {
+			return "", errNotNative
+		}
+		content := strings.TrimSpace(string(b))
+		target, ok := strings.CutPrefix(content, "ref: ")
+		if !ok {
+			return content, nil
+		}
+		ref = target
+	}
+	return "", errNotNative
+}
+
+// packedRef returns the commit of ref in packed-refs.
+func packedRef(commonDir, ref string) (string, error) {
+	f, err := os.Open(filepath.Join(commonDir, "packed-refs"))
+	if err != nil {
+		return "", errNotNative
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if sha, name, ok := strings.Cut(sc.Text(), " "); ok && name == ref {
+			return sha, nil
+		}
+	}
+	return "", errNotNative
+}
+
+// readCommitObject returns the content of the commit sha, loose or stored
+// undeltified in a pack, as commits usually are.
+func readCommitObject(objectsDir, sha string) ([]byte, error) {
+	if len(sha) != 40 {
+		return nil, errNotNative
+	}
+	if f, err := os.Open(filepath.Join(objectsDir, sha[:2], sha[2:])); err == nil {
+		defer f.Close()
+		zr, err := zlib.NewReader(f)
+		if err != nil {
+			return nil, errNotNative
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, errNotNative
+		}
+		header, content, ok := bytes.Cut(b, []byte{0})
+		if !ok || !bytes.HasPrefix(header, []byte("commit ")) {
+			return nil, errNotNative
+		}
+		return content, nil
+	}
+
+	name, err := hex.DecodeString(sha)
+	if err != nil {
+		return nil, errNotNative
+	}
+	idxFiles, _ := filepath.Glob(filepath.Join(objectsDir, "pack", "*.idx"))
+	for _, idxFile := range idxFiles {
+		offset, found, err := packOffset(idxFile, name)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return readPackedCommit(strings.TrimSuffix(idxFile, ".idx")+".pack", offset)
+		}
+	}
+	return nil, errNotNative
+}
+
+// packOffset looks up the offset of the object name in a version 2 pack
+// index.
+func packOffset(idxFile string, name []byte) (int64, bool, error) {
+	b, err := os.ReadFile(idxFile)
+	if err != nil || len(b) < 8+256*4 || string(b[:4]) != "\xfftOc" || binary.BigEndian.Uint32(b[4:]) != 2 {
+		return 0, false, errNotNative
+	}
+	fanout := b[8:]
+	count := int(binary.BigEndian.Uint32(fanout[255*4:]))
+	names := b[8+256*4:]
+	// The names, their CRCs and their offsets, 20, 4 and 4 bytes each.
+	if len(names) < count*28 {
+		return 0, false, errNotNative
+	}
+	offsets := names[count*24:]
+
+	lo := 0
+	if name[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(fanout[(int(name[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(fanout[int(name[0])*4:]))
+	if lo > hi || hi > count {
+		return 0, false, errNotNative
+	}
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch c := bytes.Compare(names[mid*20:mid*20+20], name); {
+		case c == 0:
+			offset := binary.BigEndian.Uint32(offsets[mid*4:])
+			if offset&0x80000000 != 0 {
+				// In the table of offsets for packs above 2 GiB.
+				large := offsets[count*4:]
+				i := int(offset &^ 0x80000000)
+				if len(large) < i*8+8 {
+					return 0, false, errNotNative
+				}
+				return int64(binary.BigEndian.Uint64(large[i*8:])), true, nil
+			}
+			return int64(offset), true, nil
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false, nil
+}
+
+// readPackedCommit reads the commit at offset in packFile. Deltified
+// commits are left to git.
+func readPackedCommit(packFile string, offset int64) ([]byte, error) {
+	f, err := os.Open(packFile)
+	if err != nil {
+		return nil, errNotNative
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, errNotNative
+	}
+	br := bufio.NewReader(f)
+
+	// The type and size: 3 bits of type and 4 of size, then 7 bits of size
+	// per byte while the high bit is set.
+	c, err := br.ReadByte()
+	if err != nil {
+		return nil, errNotNative
+	}
+	if objType := (c >> 4) & 7; objType != 1 {
+		return nil, errNotNative
+	}
+	size, shift := int64(c&0x0f), 4
+	for c&0x80 != 0 {
+		if c, err = br.ReadByte(); err != nil {
+			return nil, errNotNative
+		}
+		size |= int64(c&0x7f) << shift
+		shift += 7
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return nil, errNotNative
+	}
+	content, err := io.ReadAll(io.LimitReader(zr, size))
+	if err != nil || int64(len(content)) != size {
+		return nil, errNotNative
+	}
+	return content, nil
+}
@@ -2,4 +2,7 @@ module github.com/bep/mygithelper
 
 go 1.26.0
 
-require github.com/cespare/xxhash/v2 v2.3.0
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	gopkg.in/yaml.v3 v3.0.1
+)
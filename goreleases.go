@@ -0,0 +1,153 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The previous Go version is the newest stable Go release before a version,
+// looked up in the list of releases on go.dev, so that 1.27rc1 follows 1.26,
+// 1.100 follows 1.99 and 2.0 follows the last 1.x release. The list is cached
+// for a day in the user's cache dir; without it and without network access
+// knownGoReleases is used.
+
+const (
+	goReleasesURL    = "https://go.dev/dl/?mode=json&include=all"
+	goReleasesMaxAge = 24 * time.Hour
+)
+
+// knownGoReleases are the minor Go releases as of writing.
+var knownGoReleases = []string{
+	"1.0", "1.1", "1.2", "1.3", "1.4", "1.5", "1.6", "1.7", "1.8", "1.9",
+	"1.10", "1.11", "1.12", "1.13", "1.14", "1.15", "1.16", "1.17", "1.18", "1.19",
+	"1.20", "1.21", "1.22", "1.23", "1.24", "1.25", "1.26", "1.27",
+}
+
+// goMinor is a minor Go release, e.g. {1, 26}.
+type goMinor struct {
+	Major, Minor int
+}
+
+func (v goMinor) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v goMinor) compare(w goMinor) int {
+	return cmp.Or(cmp.Compare(v.Major, w.Major), cmp.Compare(v.Minor, w.Minor))
+}
+
+var goReleases struct {
+	once     sync.Once
+	minors   []goMinor // Sorted
+	fallback bool      // From knownGoReleases
+}
+
+// prevGoVersion returns the minor Go release before version (e.g. 1.26 for
+// 1.27, 1.27.1 or 1.27rc1), or version if there is none.
+func prevGoVersion(version string) string {
+	major, minor, ok := goMinorVersion(version)
+	if !ok {
+		return version
+	}
+	v := goMinor{major, minor}
+
+	goReleases.once.Do(loadGoReleases)
+	var prev goMinor
+	for _, r := range goReleases.minors {
+		if r.compare(v) >= 0 {
+			break
+		}
+		prev = r
+	}
+	// The table may not know the latest releases; go.dev does.
+	if goReleases.fallback && minor > 0 && prev.compare(goMinor{major, minor - 1}) < 0 {
+		prev = goMinor{major, minor - 1}
+	}
+	if prev == (goMinor{}) {
+		return version
+	}
+	return prev.String()
+}
+
+// loadGoReleases loads the minor Go releases from the cache, go.dev, a stale
+// cache or knownGoReleases, in that order.
+func loadGoReleases() {
+	var filename string
+	if dir, err := os.UserCacheDir(); err == nil {
+		filename = filepath.Join(dir, "mygithelper", "go-releases.json")
+	}
+	readCache := func(maxAge time.Duration) []string {
+		info, err := os.Stat(filename)
+		if err != nil || maxAge > 0 && time.Since(info.ModTime()) > maxAge {
+			return nil
+		}
+		var versions []string
+		if b, err := os.ReadFile(filename); err == nil {
+			json.Unmarshal(b, &versions)
+		}
+		return versions
+	}
+
+	versions := readCache(goReleasesMaxAge)
+	if versions == nil {
+		var err error
+		if versions, err = fetchGoReleases(); err == nil && filename != "" {
+			if b, err := json.Marshal(versions); err == nil && os.MkdirAll(filepath.Dir(filename), 0o755) == nil {
+				os.WriteFile(filename, b, 0o644)
+			}
+		} else if err != nil {
+			versions = readCache(0)
+		}
+	}
+	if versions == nil {
+		versions = knownGoReleases
+		goReleases.fallback = true
+	}
+
+	for _, s := range versions {
+		if major, minor, ok := goMinorVersion(s); ok {
+			goReleases.minors = append(goReleases.minors, goMinor{major, minor})
+		}
+	}
+	slices.SortFunc(goReleases.minors, goMinor.compare)
+	goReleases.minors = slices.Compact(goReleases.minors)
+}
+
+// fetchGoReleases returns the minor versions (e.g. "1.26") of the stable Go
+// releases on go.dev.
+func fetchGoReleases() ([]string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(goReleasesURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list Go releases: %s", resp.Status)
+	}
+	var releases []struct {
+		Version string `json:"version"` // e.g. "go1.26.1"
+		Stable  bool   `json:"stable"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("failed to list Go releases: %w", err)
+	}
+	var versions []string
+	for _, r := range releases {
+		if major, minor, ok := goMinorVersion(r.Version); ok && r.Stable {
+			versions = append(versions, goMinor{major, minor}.String())
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no Go releases in %s", goReleasesURL)
+	}
+	slices.Sort(versions)
+	return slices.Compact(versions), nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// --- Go versions command ---
+
+// goVersionsCmd reports the go and toolchain directives in go.mod and the Go
+// versions the CI workflows test with for each repo, as on the default branch
+// last fetched, and flags CI versions the go directive no longer supports.
+type goVersionsCmd struct {
+	BaseDir   string
+	Config    *config
+	KeepGoing bool
+	Pick      bool
+
+	rows       []goVersionsRow
+	mismatched int
+	summary    runSummary
+}
+
+type goVersionsRow struct {
+	Repo      string
+	Go        string
+	Toolchain string
+	CI        []string // Distinct versions in the go-version matrices
+	Problems  []string
+}
+
+func (cmd *goVersionsCmd) Run() error {
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	if err := forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.inspectRepo); err != nil {
+		return err
+	}
+
+	printSection("Go versions")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Repo\tgo\ttoolchain\tCI\tProblems")
+	for _, r := range cmd.rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Repo, cmp.Or(r.Go, "-"), cmp.Or(r.Toolchain, "-"), cmp.Or(strings.Join(r.CI, ", "), "-"), strings.Join(r.Problems, "; "))
+	}
+	w.Flush()
+	if cmd.mismatched > 0 {
+		return fmt.Errorf("%d of %d repos test Go versions their go.mod doesn't support", cmd.mismatched, len(cmd.rows))
+	}
+	return nil
+}
+
+func (cmd *goVersionsCmd) inspectRepo(repo repo) error {
+	branch, err := cmd.Config.defaultBranch(repo)
+	if err != nil {
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	}
+	rev := "origin/" + branch
+
+	row := goVersionsRow{Repo: repo.Path}
+	mod := parseGoMod(gitShow(repo.Dir, rev, "go.mod"))
+	row.Go, row.Toolchain = mod.Go, strings.TrimPrefix(mod.Toolchain, "go")
+
+	// -z as names with spaces or non-ASCII characters are quoted otherwise.
+	output, err := gitOutput(repo.Dir, "ls-tree", "-z", "--name-only", rev, ".github/workflows/")
+	if err != nil {
+		return fmt.Errorf("%s: failed to list workflows: %w", repo.Path, err)
+	}
+	for filename := range strings.SplitSeq(output, "\x00") {
+		if filename == "" || !isWorkflowFile(path.Base(filename)) {
+			continue
+		}
+		for _, list := range goVersionLists([]byte(gitShow(repo.Dir, rev, filename))) {
+			for _, v := range list {
+				if !slices.Contains(row.CI, v) {
+					row.CI = append(row.CI, v)
+				}
+			}
+		}
+	}
+
+	// Versions like stable, tip or a matrix expression can't be compared.
+	if goMajor, goMinor, ok := goMinorVersion(row.Go); ok {
+		var unsupported []string
+		for _, v := range row.CI {
+			if major, minor, ok := goMinorVersion(v); ok && (major < goMajor || major == goMajor && minor < goMinor) {
+				unsupported = append(unsupported, v)
+			}
+		}
+		if len(unsupported) > 0 {
+			row.Problems = append(row.Problems, fmt.Sprintf("CI tests %s, below go %s", strings.Join(unsupported, ", "), row.Go))
+			cmd.mismatched++
+		}
+	}
+	cmd.rows = append(cmd.rows, row)
+	return nil
+}
+
+// goMinorVersion returns the major and minor version of a Go version as used
+// in go.mod or a go-version matrix, e.g. 1 and 25 for 1.25.x, 1.25.0 or
+// 1.25rc1.
+func goMinorVersion(v string) (major, minor int, ok bool) {
+	v = strings.TrimPrefix(strings.TrimSuffix(v, ".x"), "go")
+	if !goVersionRe.MatchString(v) {
+		return 0, 0, false
+	}
+	majorStr, rest, _ := strings.Cut(v, ".")
+	minorStr := rest[:strings.IndexFunc(rest+".", func(r rune) bool { return r < '0' || r > '9' })]
+	major, err1 := strconv.Atoi(majorStr)
+	minor, err2 := strconv.Atoi(minorStr)
+	return major, minor, err1 == nil && err2 == nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- Hooks command ---
+
+// hooksCmd installs the git hooks in the shared hooks directory into the
+// repos, so the same pre-commit, commit-msg etc. policies apply everywhere.
+type hooksCmd struct {
+	BaseDir   string
+	Config    *config
+	Action    string
+	Mode      string // Overrides hooks_mode
+	Force     bool   // Replace existing hooks that differ
+	Try       bool
+	KeepGoing bool
+	Pick      bool
+
+	hooksDir string
+	hooks    []string // Names of the hooks in hooksDir
+	summary  runSummary
+}
+
+func (cmd *hooksCmd) Run() error {
+	if cmd.Action != "install" {
+		return fmt.Errorf("unknown hooks action %q, expected install", cmd.Action)
+	}
+	cmd.Mode = cmp.Or(cmd.Mode, cmd.Config.HooksMode, "symlink")
+	switch cmd.Mode {
+	case "symlink", "copy", "hooks_path":
+	default:
+		return fmt.Errorf("invalid --mode %q, must be symlink, copy or hooks_path", cmd.Mode)
+	}
+
+	cmd.hooksDir = cmd.Config.hooksDir(cmd.BaseDir)
+	entries, err := os.ReadDir(cmd.hooksDir)
+	if err != nil {
+		return fmt.Errorf("failed to read the hooks directory: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".sample") {
+			continue
+		}
+		cmd.hooks = append(cmd.hooks, name)
+	}
+	if len(cmd.hooks) == 0 {
+		return fmt.Errorf("no hooks in %s", cmd.hooksDir)
+	}
+	fmt.Printf("Installing %s from %s (%s)\n", strings.Join(cmd.hooks, ", "), cmd.hooksDir, cmd.Mode)
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	return forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.installHooks)
+}
+
+func (cmd *hooksCmd) installHooks(repo repo) error {
+	printSection("Installing hooks in " + repo.Path)
+
+	hooksPath, _ := gitOutput(repo.Dir, "config", "--local", "core.hooksPath")
+	hooksPath = strings.TrimSpace(hooksPath)
+	if cmd.Mode == "hooks_path" {
+		if hooksPath == cmd.hooksDir {
+			fmt.Println("core.hooksPath is up to date")
+			return nil
+		}
+		if cmd.Try {
+			fmt.Printf("[dry-run] Would set core.hooksPath to %s\n", cmd.hooksDir)
+			return nil
+		}
+		if err := gitRun(repo.Dir, "config", "--local", "core.hooksPath", cmd.hooksDir); err != nil {
+			return fmt.Errorf("%s: failed to set core.hooksPath: %w", repo.Path, err)
+		}
+		fmt.Printf("Set core.hooksPath to %s\n", cmd.hooksDir)
+		return nil
+	}
+
+	// Switching from hooks_path: the hooks in .git/hooks aren't used while
+	// core.hooksPath points to the shared directory.
+	if hooksPath != "" {
+		if hooksPath != cmd.hooksDir {
+			return skipRepo("core.hooksPath is set to %s", hooksPath)
+		}
+		if cmd.Try {
+			fmt.Println("[dry-run] Would unset core.hooksPath")
+		} else {
+			if err := gitRun(repo.Dir, "config", "--local", "--unset", "core.hooksPath"); err != nil {
+				return fmt.Errorf("%s: failed to unset core.hooksPath: %w", repo.Path, err)
+			}
+			fmt.Println("Unset core.hooksPath")
+		}
+	}
+
+	gitHooksDir, err := gitOutput(repo.Dir, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return fmt.Errorf("%s: failed to find the git directory: %w", repo.Path, err)
+	}
+	gitHooksDir = filepath.Join(strings.TrimSpace(gitHooksDir), "hooks")
+	if !filepath.IsAbs(gitHooksDir) {
+		gitHooksDir = filepath.Join(repo.Dir, gitHooksDir)
+	}
+
+	var kept []string
+	for _, name := range cmd.hooks {
+		installed, err := cmd.installHook(filepath.Join(cmd.hooksDir, name), filepath.Join(gitHooksDir, name))
+		if err != nil {
+			return fmt.Errorf("%s: failed to install %s: %w", repo.Path, name, err)
+		}
+		if !installed {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) > 0 {
+		return skipRepo("kept existing %s (use --force to replace)", strings.Join(kept, ", "))
+	}
+	return nil
+}
+
+// installHook links or copies the hook source to target, returning false if
+// a different hook is there and --force isn't set.
+func (cmd *hooksCmd) installHook(source, target string) (bool, error) {
+	name := filepath.Base(target)
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return false, err
+	}
+
+	if fi, err := os.Lstat(target); err == nil {
+		isLink := fi.Mode()&os.ModeSymlink != 0
+		link, _ := os.Readlink(target)
+		existing, _ := os.ReadFile(target)
+		if cmd.Mode == "symlink" && link == source || cmd.Mode == "copy" && !isLink && bytes.Equal(existing, content) {
+			return true, nil
+		}
+
+		// Hooks installed by us before, linked or copied, are replaced; others
+		// only with --force, and kept as <hook>.orig.
+		ours := link == source || bytes.Equal(existing, content)
+		if !ours && !cmd.Force {
+			fmt.Printf("%s exists and differs, keeping it\n", name)
+			return false, nil
+		}
+		if cmd.Try {
+			fmt.Printf("[dry-run] Would replace %s\n", name)
+			return true, nil
+		}
+		if ours {
+			err = os.Remove(target)
+		} else {
+			err = os.Rename(target, target+".orig")
+		}
+		if err != nil {
+			return false, err
+		}
+	} else if cmd.Try {
+		fmt.Printf("[dry-run] Would install %s\n", name)
+		return true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return false, err
+	}
+	if cmd.Mode == "symlink" {
+		err = os.Symlink(source, target)
+	} else {
+		err = os.WriteFile(target, content, 0o755)
+	}
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("Installed %s\n", name)
+	return true, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// identity is the GitHub account used for the repos of a group.
+type identity struct {
+	// TokenEnv is the environment variable holding the GitHub token for the
+	// account, used by gh and the REST API.
+	TokenEnv string `json:"token_env,omitempty"`
+
+	// SSHKey is the private key git uses over SSH.
+	SSHKey string `json:"ssh_key,omitempty"`
+
+	// Host is the GitHub Enterprise Server hostname of the account, e.g.
+	// "github.example.com" (default github.com). The repos' host option
+	// overrides it.
+	Host string `json:"host,omitempty"`
+
+	// Name and Email are the author and committer of the commits we create.
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// identityEnv lists the environment variables an identity may set.
+var identityEnv = []string{
+	"GH_TOKEN", "GITHUB_TOKEN", "GH_HOST", "GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN", "GIT_SSH_COMMAND",
+	"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL",
+}
+
+// defaultIdentityEnv holds the values of identityEnv we started with.
+var defaultIdentityEnv map[string]*string
+
+// repoGroup returns the group of r, the directory of its gitjoin.txt
+// relative to baseDir, e.g. "bep".
+func repoGroup(baseDir string, r repo) string {
+	group, err := filepath.Rel(baseDir, r.ListDir)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(group)
+}
+
+// useIdentity switches the environment of the git, gh and GitHub API calls to
+// the identity configured for the group of r and the GitHub host of r, or
+// back to the ones we started with if there are none.
+func (cfg *config) useIdentity(baseDir string, r repo) error {
+	if len(cfg.Identities) == 0 && cfg.repo(r.Path).Host == "" && defaultIdentityEnv == nil {
+		return nil
+	}
+
+	if defaultIdentityEnv == nil {
+		defaultIdentityEnv = map[string]*string{}
+		for _, key := range identityEnv {
+			if v, ok := os.LookupEnv(key); ok {
+				defaultIdentityEnv[key] = &v
+			} else {
+				defaultIdentityEnv[key] = nil
+			}
+		}
+	}
+	restoreDefaultIdentity()
+
+	group := repoGroup(baseDir, r)
+	id := cfg.Identities[group]
+
+	// gh and githubHost go by GH_HOST.
+	host := cmp.Or(cfg.repo(r.Path).Host, id.Host)
+	if host != "" && host != "github.com" {
+		os.Setenv("GH_HOST", host)
+	}
+
+	if id.TokenEnv != "" {
+		token := os.Getenv(id.TokenEnv)
+		if token == "" {
+			return fmt.Errorf("identities.%s: %s is not set", group, id.TokenEnv)
+		}
+		os.Setenv("GH_TOKEN", token)
+		os.Setenv("GITHUB_TOKEN", token)
+		if githubHost() != "github.com" {
+			os.Setenv("GH_ENTERPRISE_TOKEN", token)
+		}
+	}
+	if id.SSHKey != "" {
+		key := expandHome(id.SSHKey)
+		if !fileExists(key) {
+			return fmt.Errorf("identities.%s: SSH key %s not found", group, id.SSHKey)
+		}
+		os.Setenv("GIT_SSH_COMMAND", "ssh -i "+shellQuote(key)+" -o IdentitiesOnly=yes")
+	}
+	if id.Name != "" {
+		os.Setenv("GIT_AUTHOR_NAME", id.Name)
+		os.Setenv("GIT_COMMITTER_NAME", id.Name)
+	}
+	if id.Email != "" {
+		os.Setenv("GIT_AUTHOR_EMAIL", id.Email)
+		os.Setenv("GIT_COMMITTER_EMAIL", id.Email)
+	}
+	return nil
+}
+
+// restoreDefaultIdentity switches the environment back to the identity we
+// started with, e.g. for the calls made for the run itself after the repos.
+func restoreDefaultIdentity() {
+	for key, v := range defaultIdentityEnv {
+		if v == nil {
+			os.Unsetenv(key)
+		} else {
+			os.Setenv(key, *v)
+		}
+	}
+}
+
+// shellQuote quotes s for use in a command run by sh, such as GIT_SSH_COMMAND.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateData is what the sync_files templates are rendered with, and
+// through messageData the branch, commit and PR body templates.
+type templateData struct {
+	Path  string // GitHub path (e.g., "bep/firstupdotenv")
+	Owner string // e.g. "bep"
+	Name  string // e.g. "firstupdotenv"
+	Group string // Directory of the gitjoin.txt relative to the base dir
+	Year  int
+
+	repoFacts
+}
+
+// repoFacts are facts about a repo gathered from its checkout before we
+// change it.
+type repoFacts struct {
+	Module        string   // Module path in go.mod, "" if none
+	LatestTag     string   // Latest semver tag, e.g. "v1.8.2", "" if none
+	HasDockerfile bool     // A Dockerfile in the root
+	Workflows     []string // Names of the GitHub Actions workflows
+}
+
+// newTemplateData returns the template data for repo, inspecting the
+// checkout in repo.Dir.
+func newTemplateData(baseDir string, repo repo) templateData {
+	owner, _, _ := strings.Cut(repo.Path, "/")
+	return templateData{
+		Path:      repo.Path,
+		Owner:     owner,
+		Name:      repo.Name,
+		Group:     repoGroup(baseDir, repo),
+		Year:      time.Now().Year(),
+		repoFacts: inspectRepo(repo.Dir),
+	}
+}
+
+// inspectRepo gathers the repoFacts of the checkout in dir, leaving out what
+// it can't tell.
+func inspectRepo(dir string) repoFacts {
+	var facts repoFacts
+	facts.Module = modulePath(readFileOrEmpty(filepath.Join(dir, "go.mod")))
+	facts.LatestTag, _ = latestReleaseTag(dir)
+	facts.HasDockerfile = fileExists(filepath.Join(dir, "Dockerfile"))
+	for _, name := range workflowFiles(dir) {
+		var wf struct {
+			Name string `yaml:"name"`
+		}
+		b, _ := os.ReadFile(filepath.Join(dir, ".github", "workflows", name))
+		if yaml.Unmarshal(b, &wf) != nil || wf.Name == "" {
+			// GitHub names workflows without a name after the file.
+			wf.Name = ".github/workflows/" + name
+		}
+		facts.Workflows = append(facts.Workflows, wf.Name)
+	}
+	return facts
+}
+
+// modulePath returns the module path in the go.mod content, "" if none.
+func modulePath(gomod string) string {
+	for line := range strings.Lines(gomod) {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module")
+		if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+			continue
+		}
+		rest, _, _ = strings.Cut(rest, "//")
+		rest = strings.TrimSpace(rest)
+		if unquoted, err := strconv.Unquote(rest); err == nil {
+			return unquoted
+		}
+		return rest
+	}
+	return ""
+}
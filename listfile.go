@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A gitjoin.txt file lists one repo per line, optionally followed by
+// key=value options for that repo:
+//
+//	# Comments start with a #, also at the end of a line.
+//	github.com/bep/firstupdotenv
+//	github.com/gohugoio/hugo branch=release-0.140 verify=test
+//	github.com/gohugoio/hugo@v0.140.0
+//	github.com/bep/big sparse_checkout="docs,tools"
+//	github.com/bep/old hold_go=1.25 skip_steps=actions:2026-12-01
+//	github.com/other/Hugo dir=hugo-other
+//	github.com/bep/foo dir=tools/foo
+//	include ../shared/common.txt
+//	include-group ../hugo-core
+//	!github.com/bep/experimental-*
+//
+// A repo followed by @ and a branch, tag or commit pins the checkout to it,
+// the same as ref=<ref>.
+//
+// An include directive adds the repos listed in another file (relative to the
+// including file); they are cloned next to the including gitjoin.txt.
+//
+// A [group] line puts the repos after it in the group directory below the
+// list file's directory, so one gitjoin.txt in the base dir can replace the
+// files in the group directories:
+//
+//	[bep]
+//	github.com/bep/firstupdotenv
+//	[gohugoio/tools]
+//	github.com/gohugoio/hugo
+//
+// An include-group directive makes the group directory (relative to the list
+// file's, like a section) part of the group the line is in, without cloning its
+// repos again: --group hugo-all then also selects the repos of hugo-core, and
+// the groups hugo-core includes.
+//
+// A line starting with ! excludes the repos matching the glob (as in
+// path.Match, ignoring case) listed in the file, also through include, e.g. to
+// prune a list written by discover without deleting lines.
+
+// listPos is a position in a list file.
+type listPos struct {
+	Filename string
+	Line     int
+	Col      int
+}
+
+func (p listPos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Col)
+}
+
+// listEntry is a repo line in a list file.
+type listEntry struct {
+	Pos     listPos
+	Text    string // The repo, e.g. "github.com/bep/firstupdotenv"
+	Options []listOption
+
+	// Section is the [group] the repo is listed in, relative to the
+	// directory of the list file, "" if none.
+	Section string
+
+	// Exclude marks a ! line, with the glob in Text.
+	Exclude bool
+
+	// IncludeGroup marks an include-group line, with the absolute directory
+	// of the included group in Text.
+	IncludeGroup bool
+}
+
+type listOption struct {
+	Pos   listPos
+	Key   string
+	Value string
+}
+
+type listToken struct {
+	Pos  listPos
+	Text string
+}
+
+// parseListFile parses filename and the files it includes.
+func parseListFile(filename string) ([]listEntry, error) {
+	return parseListFileIncluded(filename, nil)
+}
+
+func parseListFileIncluded(filename string, stack []string) ([]listEntry, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(stack, abs) {
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+	}
+	stack = append(stack, abs)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []listEntry
+	var section string
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		tokens, err := tokenizeListLine(filename, lineNum, scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+
+		if tokens[0].Text == "include" {
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("%s: include takes exactly one file", tokens[0].Pos)
+			}
+			included := tokens[1].Text
+			if !filepath.IsAbs(included) {
+				included = filepath.Join(filepath.Dir(filename), included)
+			}
+			includedEntries, err := parseListFileIncluded(included, stack)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", tokens[1].Pos, err)
+			}
+			for _, e := range includedEntries {
+				e.Section = path.Join(section, e.Section)
+				entries = append(entries, e)
+			}
+			continue
+		}
+
+		if tokens[0].Text == "include-group" {
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("%s: include-group takes exactly one group", tokens[0].Pos)
+			}
+			group := filepath.FromSlash(tokens[1].Text)
+			if !filepath.IsAbs(group) {
+				group = filepath.Join(filepath.Dir(abs), group)
+			}
+			entries = append(entries, listEntry{Pos: tokens[0].Pos, Text: group, Section: section, IncludeGroup: true})
+			continue
+		}
+
+		if name, ok := listSection(tokens[0].Text); ok {
+			if len(tokens) != 1 {
+				return nil, fmt.Errorf("%s: unexpected %q after section", tokens[1].Pos, tokens[1].Text)
+			}
+			if name == "" || path.IsAbs(name) || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+				return nil, fmt.Errorf("%s: invalid section [%s], expected a directory below the list file's", tokens[0].Pos, name)
+			}
+			section = name
+			if section == "." {
+				section = ""
+			}
+			continue
+		}
+
+		if pattern, ok := strings.CutPrefix(tokens[0].Text, "!"); ok {
+			if len(tokens) != 1 {
+				return nil, fmt.Errorf("%s: an exclude takes no options", tokens[1].Pos)
+			}
+			if err := validExclude(pattern); err != nil {
+				return nil, fmt.Errorf("%s: %w", tokens[0].Pos, err)
+			}
+			entries = append(entries, listEntry{Pos: tokens[0].Pos, Text: pattern, Section: section, Exclude: true})
+			continue
+		}
+
+		entry := listEntry{Pos: tokens[0].Pos, Text: tokens[0].Text, Section: section}
+		if repoPath, ref, ok := strings.Cut(tokens[0].Text, "@"); ok {
+			if !validRef(ref) {
+				return nil, fmt.Errorf("%s: invalid ref %q after @, expected a branch, tag or commit", tokens[0].Pos, ref)
+			}
+			entry.Text = repoPath
+			entry.Options = append(entry.Options, listOption{Pos: tokens[0].Pos, Key: "ref", Value: ref})
+		}
+		for _, tok := range tokens[1:] {
+			key, value, ok := strings.Cut(tok.Text, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("%s: expected key=value, got %q", tok.Pos, tok.Text)
+			}
+			if err := (&repoConfig{}).setOption(key, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", tok.Pos, err)
+			}
+			entry.Options = append(entry.Options, listOption{Pos: tok.Pos, Key: key, Value: value})
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// listSection returns the group of a [group] line.
+func listSection(text string) (string, bool) {
+	if !strings.HasPrefix(text, "[") || !strings.HasSuffix(text, "]") {
+		return "", false
+	}
+	return strings.TrimSpace(text[1 : len(text)-1]), true
+}
+
+// groupListFile returns the list file to add the repos of group to, and the
+// section in it: the [group] section of the gitjoin.txt in baseDir if it has
+// one, else the gitjoin.txt in the group directory.
+func groupListFile(baseDir, group string) (filename, section string) {
+	filename = filepath.Join(baseDir, "gitjoin.txt")
+	group = path.Clean(filepath.ToSlash(group))
+	for line := range strings.Lines(readFileOrEmpty(filename)) {
+		if name, ok := listSection(strings.TrimSpace(line)); ok && name == group {
+			return filename, group
+		}
+	}
+	return filepath.Join(baseDir, filepath.FromSlash(group), "gitjoin.txt"), ""
+}
+
+// listFileName describes the list file (and section) relative to baseDir
+// for messages, e.g. "bep/gitjoin.txt" or "gitjoin.txt [bep]".
+func listFileName(baseDir, filename, section string) string {
+	name := filename
+	if rel, err := filepath.Rel(baseDir, filename); err == nil {
+		name = filepath.ToSlash(rel)
+	}
+	if section != "" {
+		name += " [" + section + "]"
+	}
+	return name
+}
+
+// tokenizeListLine splits a line into whitespace separated tokens, dropping
+// comments. Double quotes group text containing spaces and are removed.
+func tokenizeListLine(filename string, lineNum int, line string) ([]listToken, error) {
+	var tokens []listToken
+	i := 0
+	for i < len(line) {
+		if line[i] == ' ' || line[i] == '\t' || line[i] == '\r' {
+			i++
+			continue
+		}
+		if line[i] == '#' {
+			break
+		}
+
+		pos := listPos{Filename: filename, Line: lineNum, Col: i + 1}
+		var b strings.Builder
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' && line[i] != '\r' {
+			if line[i] != '"' {
+				b.WriteByte(line[i])
+				i++
+				continue
+			}
+			end := strings.IndexByte(line[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("%s: unterminated quote", listPos{Filename: filename, Line: lineNum, Col: i + 1})
+			}
+			b.WriteString(line[i+1 : i+1+end])
+			i += end + 2
+		}
+		tokens = append(tokens, listToken{Pos: pos, Text: b.String()})
+	}
+	return tokens, nil
+}
+
+// editListLine replaces the line at pos with the result of edit.
+func editListLine(pos listPos, edit func(line string) string) error {
+	b, err := os.ReadFile(pos.Filename)
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return fmt.Errorf("%s: no such line", pos)
+	}
+	line := lines[pos.Line-1]
+	eol := line[len(strings.TrimRight(line, "\r\n")):]
+	lines[pos.Line-1] = edit(strings.TrimSuffix(line, eol)) + eol
+	return os.WriteFile(pos.Filename, []byte(strings.Join(lines, "")), 0o644)
+}
+
+// addListOption adds key=value to a list file line, before any comment.
+func addListOption(line, key, value string) string {
+	code, comment, hasComment := strings.Cut(line, "#")
+	code = strings.TrimRight(code, " \t") + " " + key + "=" + value
+	if hasComment {
+		return code + " #" + comment
+	}
+	return code
+}
+
+// excludePatterns are the globs from exclude in the config and --exclude,
+// which apply to all list files.
+var excludePatterns []string
+
+// validExclude returns an error if pattern is not a valid exclude glob.
+func validExclude(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty exclude pattern")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// excluded reports whether repoPath (e.g. "bep/firstupdotenv") matches one of
+// the globs, with or without the github.com/ prefix.
+func excluded(repoPath string, patterns []string) bool {
+	repoPath = strings.ToLower(repoPath)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "github.com/"))
+		if ok, _ := path.Match(pattern, repoPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutExcluded returns the repo entries that neither the ! lines among
+// entries nor excludePatterns exclude, leaving out the include-group lines.
+func withoutExcluded(entries []listEntry) []listEntry {
+	patterns := slices.Clone(excludePatterns)
+	for _, e := range entries {
+		if e.Exclude {
+			patterns = append(patterns, e.Text)
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(entries), func(e listEntry) bool {
+		return e.Exclude || e.IncludeGroup || excluded(repoPathFromGitjoinLine(e.Text), patterns)
+	})
+}
+
+// selectedGroups are the groups from --group the commands work on, relative
+// to the base dir; none for all repos.
+var selectedGroups []string
+
+// resolveGroups returns the groups in spec, a comma separated list of groups
+// and names in groups in the config, with the names replaced by the groups
+// they stand for.
+func (cfg *config) resolveGroups(spec string) ([]string, error) {
+	var groups []string
+	var resolve func(name string, seen []string) error
+	resolve = func(name string, seen []string) error {
+		if slices.Contains(seen, name) {
+			return fmt.Errorf("group %q includes itself: %s", name, strings.Join(append(seen, name), " > "))
+		}
+		members, ok := cfg.Groups[name]
+		if !ok {
+			group := path.Clean(filepath.ToSlash(name))
+			if group == "." || path.IsAbs(group) || strings.HasPrefix(group, "..") {
+				return fmt.Errorf("invalid group %q, expected a directory below the base dir or a name in groups in %s", name, configFilename)
+			}
+			if !slices.Contains(groups, group) {
+				groups = append(groups, group)
+			}
+			return nil
+		}
+		for _, m := range members {
+			if err := resolve(m, append(seen, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for name := range strings.SplitSeq(spec, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if err := resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// reposInGroups returns the repos listed in groups (relative to baseDir) or a
+// group below them, and in the groups these include, given includes from the
+// directory of a group to the directories of the groups it includes.
+func reposInGroups(baseDir string, repos []repo, includes map[string][]string, selected []string) ([]repo, error) {
+	inGroup := func(dir, group string) bool {
+		return dir == group || strings.HasPrefix(dir, group+string(filepath.Separator))
+	}
+	var groups []string
+	for _, group := range selected {
+		groups = append(groups, filepath.Join(baseDir, filepath.FromSlash(group)))
+	}
+	for i := 0; i < len(groups); i++ {
+		for from, to := range includes {
+			if !inGroup(from, groups[i]) {
+				continue
+			}
+			for _, dir := range to {
+				if !slices.Contains(groups, dir) {
+					groups = append(groups, dir)
+				}
+			}
+		}
+	}
+
+	var inSelected []repo
+	for _, r := range repos {
+		if slices.ContainsFunc(groups, func(g string) bool { return inGroup(r.ListDir, g) }) {
+			inSelected = append(inSelected, r)
+		}
+	}
+	if len(inSelected) == 0 {
+		return nil, fmt.Errorf("no repos in group %s", strings.Join(selected, ", "))
+	}
+	return inSelected, nil
+}
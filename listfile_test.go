@@ -0,0 +1,226 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeListLine(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want []string // Text@col
+		err  string
+	}{
+		{line: "", want: nil},
+		{line: "   # Just a comment", want: nil},
+		{line: "github.com/bep/a", want: []string{"github.com/bep/a@1"}},
+		{line: "  github.com/bep/a\tbranch=main  verify=test # A comment", want: []string{"github.com/bep/a@3", "branch=main@20", "verify=test@33"}},
+		{line: `github.com/bep/a sparse_checkout="docs, tools"`, want: []string{"github.com/bep/a@1", "sparse_checkout=docs, tools@18"}},
+		{line: `github.com/bep/a key="a # b"`, want: []string{"github.com/bep/a@1", "key=a # b@18"}},
+		{line: `"a b"c "" d`, want: []string{"a bc@1", "@8", "d@11"}},
+		{line: "github.com/bep/a\r", want: []string{"github.com/bep/a@1"}},
+		{line: `github.com/bep/a key="docs`, err: "f.txt:3:22: unterminated quote"},
+	} {
+		tokens, err := tokenizeListLine("f.txt", 3, test.line)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: got error %v, want %q", test.line, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens {
+			if tok.Pos.Filename != "f.txt" || tok.Pos.Line != 3 {
+				t.Errorf("%q: unexpected position %s", test.line, tok.Pos)
+			}
+			got = append(got, tok.Text+"@"+strconv.Itoa(tok.Pos.Col))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestParseListFile(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		files map[string]string // Relative to the temp dir; main.txt is parsed.
+		want  []string          // Entries as file:line:col text key=value...
+		err   string            // The error, with the temp dir as $DIR.
+	}{
+		{
+			name: "repos and options",
+			files: map[string]string{"main.txt": `# Repos
+github.com/bep/a
+github.com/bep/b   branch=release verify=test # Comment
+github.com/bep/c sparse_checkout="docs,tools"
+`},
+			want: []string{
+				"main.txt:2:1 github.com/bep/a",
+				"main.txt:3:1 github.com/bep/b branch=release@3:20 verify=test@3:35",
+				"main.txt:4:1 github.com/bep/c sparse_checkout=docs,tools@4:18",
+			},
+		},
+		{
+			name:  "ref",
+			files: map[string]string{"main.txt": "github.com/bep/a@v1.2.0\ngithub.com/bep/b ref=main\n"},
+			want: []string{
+				"main.txt:1:1 github.com/bep/a ref=v1.2.0@1:1",
+				"main.txt:2:1 github.com/bep/b ref=main@2:18",
+			},
+		},
+		{
+			name:  "invalid ref",
+			files: map[string]string{"main.txt": "github.com/bep/a\ngithub.com/bep/b@a..b\n"},
+			err:   `$DIR/main.txt:2:1: invalid ref "a..b" after @, expected a branch, tag or commit`,
+		},
+		{
+			name:  "not key=value",
+			files: map[string]string{"main.txt": "github.com/bep/a branch=main oops\n"},
+			err:   `$DIR/main.txt:1:30: expected key=value, got "oops"`,
+		},
+		{
+			name:  "invalid option",
+			files: map[string]string{"main.txt": "\n  github.com/bep/a skip_update=maybe\n"},
+			err:   `$DIR/main.txt:2:20: invalid boolean "maybe" for skip_update`,
+		},
+		{
+			name:  "unterminated quote",
+			files: map[string]string{"main.txt": "github.com/bep/a\ngithub.com/bep/b sparse_checkout=\"docs\n"},
+			err:   `$DIR/main.txt:2:34: unterminated quote`,
+		},
+		{
+			name:  "excludes",
+			files: map[string]string{"main.txt": "github.com/bep/a\n!github.com/bep/old-*\n"},
+			want: []string{
+				"main.txt:1:1 github.com/bep/a",
+				"main.txt:2:1 !github.com/bep/old-*",
+			},
+		},
+		{
+			name:  "exclude with options",
+			files: map[string]string{"main.txt": "!github.com/bep/old-* branch=main\n"},
+			err:   `$DIR/main.txt:1:23: an exclude takes no options`,
+		},
+		{
+			name:  "invalid exclude",
+			files: map[string]string{"main.txt": "!github.com/bep/[\n"},
+			err:   `$DIR/main.txt:1:1: invalid exclude pattern "github.com/bep/[": syntax error in pattern`,
+		},
+		{
+			name: "include",
+			files: map[string]string{
+				"main.txt":          "github.com/bep/a\ninclude shared/common.txt\ngithub.com/bep/c\n",
+				"shared/common.txt": "github.com/bep/b verify=test\n!github.com/bep/x\n",
+			},
+			want: []string{
+				"main.txt:1:1 github.com/bep/a",
+				"shared/common.txt:1:1 github.com/bep/b verify=test@1:18",
+				"shared/common.txt:2:1 !github.com/bep/x",
+				"main.txt:3:1 github.com/bep/c",
+			},
+		},
+		{
+			name:  "include of a missing file",
+			files: map[string]string{"main.txt": "github.com/bep/a\ninclude  missing.txt\n"},
+			err:   `$DIR/main.txt:2:10: open $DIR/missing.txt: no such file or directory`,
+		},
+		{
+			name:  "include without a file",
+			files: map[string]string{"main.txt": "include\n"},
+			err:   `$DIR/main.txt:1:1: include takes exactly one file`,
+		},
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"main.txt": "include a.txt\n",
+				"a.txt":    "github.com/bep/a\ninclude b.txt\n",
+				"b.txt":    "include a.txt\n",
+			},
+			err: `$DIR/main.txt:1:9: $DIR/a.txt:2:9: $DIR/b.txt:1:9: include cycle: $DIR/main.txt -> $DIR/a.txt -> $DIR/b.txt -> $DIR/a.txt`,
+		},
+		{
+			name: "sections",
+			files: map[string]string{
+				"main.txt": "github.com/bep/a\n[bep]\ngithub.com/bep/b\ninclude more.txt\n[.]\ngithub.com/bep/d\n",
+				"more.txt": "[tools]\ngithub.com/bep/c\n",
+			},
+			want: []string{
+				"main.txt:1:1 github.com/bep/a",
+				"main.txt:3:1 [bep] github.com/bep/b",
+				"more.txt:2:1 [bep/tools] github.com/bep/c",
+				"main.txt:6:1 github.com/bep/d",
+			},
+		},
+		{
+			name:  "section outside the directory",
+			files: map[string]string{"main.txt": "[../other]\n"},
+			err:   `$DIR/main.txt:1:1: invalid section [../other], expected a directory below the list file's`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.files {
+				writeTestFile(t, dir, name, content)
+			}
+
+			entries, err := parseListFile(filepath.Join(dir, "main.txt"))
+			if test.err != "" {
+				want := strings.ReplaceAll(test.err, "$DIR", dir)
+				if err == nil || err.Error() != want {
+					t.Fatalf("got error %v, want %s", err, want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, e := range entries {
+				rel, _ := filepath.Rel(dir, e.Pos.Filename)
+				s := filepath.ToSlash(rel) + ":" + strconv.Itoa(e.Pos.Line) + ":" + strconv.Itoa(e.Pos.Col) + " "
+				if e.Section != "" {
+					s += "[" + e.Section + "] "
+				}
+				if e.Exclude {
+					s += "!"
+				}
+				s += e.Text
+				for _, o := range e.Options {
+					s += " " + o.Key + "=" + o.Value + "@" + strconv.Itoa(o.Pos.Line) + ":" + strconv.Itoa(o.Pos.Col)
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseListFileNotFound(t *testing.T) {
+	_, err := parseListFile(filepath.Join(t.TempDir(), "gitjoin.txt"))
+	if !os.IsNotExist(err) {
+		t.Errorf("got %v, want a not exist error", err)
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	filename := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,15 +2,29 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go/version"
+	"io"
 	"io/fs"
+	"maps"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/cespare/xxhash/v2"
 )
@@ -19,193 +33,523 @@ type repo struct {
 	Path string // GitHub path (e.g., "bep/firstupdotenv")
 	Name string // Extracted repo name (e.g., "firstupdotenv")
 	Dir  string // Full path on disk
+
+	// ListDir is the directory of the gitjoin.txt listing the repo, which Dir
+	// is in, possibly nested (see the dir option).
+	ListDir string
+
+	// Pos is where the repo is listed, if it is.
+	Pos listPos
 }
 
 func main() {
 	if len(os.Args) < 2 {
-		fatalf("Usage: mygithelper <command>\n\nCommands:\n  update [--force] [--try]  Update Go versions, GitHub Actions, and dependencies\n  fix [--try]               Run modernize -fix on all repos\n\nFlags:\n  --try    Dry-run: show what would change without creating branches or PRs")
+		printUsage(os.Stderr)
+		os.Exit(1)
+	}
+	if slices.Contains([]string{"help", "-h", "--help"}, os.Args[1]) {
+		if err := helpCommand(os.Stdout, os.Args[2:]); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	if os.Args[1] == "credential" {
+		// Run by git, see setupCredentialHelper.
+		if err := credentialHelper(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fatalf("%v", err)
+		}
+		return
 	}
+	command, ok := findCommand(os.Args[1])
+	if !ok {
+		fatalf("Unknown command: %s\nRun mygithelper help for the commands.", os.Args[1])
+	}
+	opts := options{network: os.Getenv("MYGITHELPER_NETWORK")}
+	positional := parseCommandArgs(command, &opts)
 
 	baseDir, err := os.Getwd()
 	if err != nil {
 		fatalf("failed to get working directory: %v", err)
 	}
 
-	// Parse flags from remaining args
-	var force, try bool
-	for _, arg := range os.Args[2:] {
-		switch arg {
-		case "--force":
-			force = true
-		case "--try":
-			try = true
+	handleInterrupts()
+	initTracing()
+	startSpan("mygithelper "+strings.Join(os.Args[1:], " "), "base_dir", baseDir)
+
+	initCommandLog(baseDir, opts.traceExec)
+	initState(baseDir)
+
+	if opts.host != "" {
+		cfg, err := loadConfig(baseDir)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if err := cfg.runOnHost(opts.host, baseDir, withoutFlag(os.Args[1:], "host")); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				flushTraces()
+				os.Exit(exitErr.ExitCode())
+			}
+			fatalf("failed to run on %s: %v", opts.host, err)
+		}
+		flushTraces()
+		return
+	}
+
+	// doctor reports a broken config instead of failing on it.
+	if os.Args[1] == "doctor" {
+		if err := (&doctorCmd{BaseDir: baseDir}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+		flushTraces()
+		return
+	}
+
+	cfg, err := loadConfig(baseDir)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	// validate reports the problems in the list files instead of failing on
+	// the first.
+	if os.Args[1] != "validate" {
+		if err := cfg.loadListOptions(baseDir); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	if err := cfg.applyURLRewrites(opts.network); err != nil {
+		fatalf("%v", err)
+	}
+	if err := cfg.setupCredentialHelper(); err != nil {
+		fatalf("%v", err)
+	}
+	if err := cfg.applyTimeouts(opts.timeout); err != nil {
+		fatalf("%v", err)
+	}
+	if cfg.GitBackend != "" {
+		gitRead = gitReaders[cfg.GitBackend]
+	}
+	excludePatterns = slices.Concat(cfg.Exclude, opts.excludes)
+	initBaseRepo(baseDir)
+	if len(cfg.WorkflowFiles) > 0 {
+		workflowPatterns = cfg.WorkflowFiles
+	}
+	if cmd := os.Args[1]; cmd != "discover" && cmd != "validate" {
+		// discover adds to the group; validate checks all list files.
+		if selectedGroups, err = cfg.resolveGroups(opts.discover.Group); err != nil {
+			fatalf("--group: %v", err)
+		}
+	}
+	if botMode {
+		if err := setupBot(); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	cfg.AutoMerge = cfg.AutoMerge || opts.autoMerge
+
+	switch os.Args[1] {
+	case "update", "fix", "sync-files":
+		// These add run records, SBOMs and worktrees.
+		if !opts.try {
+			cfg.pruneArtifacts(baseDir)
 		}
 	}
 
 	switch os.Args[1] {
 	case "update":
-		if err := (&updateCmd{BaseDir: baseDir, Force: force, Try: try}).Run(); err != nil {
+		if err := (&updateCmd{BaseDir: baseDir, Config: cfg, GoVersions: opts.goVersions, Go: opts.goCurrent, PrevGo: opts.goPrev, Force: opts.force, Try: opts.try, Draft: opts.draft || cfg.Draft, KeepGoing: opts.keepGoing, ReviewWeb: opts.reviewWeb, SinceTag: opts.sinceTag, Yes: opts.yes, Worktree: opts.worktree || cfg.Worktree, Pick: opts.pick, Path: opts.repoDir, NoPreflight: opts.skipPreflight, RetryFailed: opts.retryFailed}).Run(); err != nil {
 			fatalf("%v", err)
 		}
 	case "fix":
-		if err := (&fixCmd{BaseDir: baseDir, Try: try}).Run(); err != nil {
+		if err := (&fixCmd{BaseDir: baseDir, Config: cfg, Try: opts.try, KeepGoing: opts.keepGoing, ReviewWeb: opts.reviewWeb, Worktree: opts.worktree || cfg.Worktree, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "get":
+		if err := (&getCmd{BaseDir: baseDir, Config: cfg, Clone: opts.clone, Try: opts.try, KeepGoing: opts.keepGoing, Pick: opts.pick, NoPreflight: opts.skipPreflight}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "mirror":
+		if err := (&mirrorCmd{BaseDir: baseDir, Config: cfg, Dest: opts.mirrorDest, Try: opts.try, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "go-versions":
+		if err := (&goVersionsCmd{BaseDir: baseDir, Config: cfg, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "audit":
+		if err := (&auditCmd{BaseDir: baseDir, Config: cfg, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "unshallow":
+		if err := (&unshallowCmd{BaseDir: baseDir, Config: cfg, Try: opts.try, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "setup":
+		if err := (&setupCmd{BaseDir: baseDir, Config: cfg}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "validate":
+		if err := (&validateCmd{BaseDir: baseDir}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "discover":
+		opts.discover.BaseDir = baseDir
+		opts.discover.Config = cfg
+		opts.discover.Try = opts.try
+		if err := opts.discover.Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "prune-remote":
+		if err := (&pruneRemoteCmd{BaseDir: baseDir, Config: cfg, Try: opts.try, Yes: opts.yes, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "prune-branches":
+		if err := (&pruneBranchesCmd{BaseDir: baseDir, Config: cfg, Try: opts.try, Yes: opts.yes, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "sync-forks":
+		if err := (&syncForksCmd{BaseDir: baseDir, Config: cfg, Try: opts.try, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "sync-files":
+		if err := (&syncFilesCmd{BaseDir: baseDir, Config: cfg, Try: opts.try, KeepGoing: opts.keepGoing, Worktree: opts.worktree || cfg.Worktree, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "verify-actions":
+		if err := (&verifyActionsCmd{BaseDir: baseDir, Config: cfg, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "editor-workspace":
+		if err := (&editorWorkspaceCmd{BaseDir: baseDir, JetBrains: opts.jetBrains, Try: opts.try}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "release":
+		if err := (&releaseCmd{BaseDir: baseDir, Config: cfg, Bump: opts.bump, Tag: opts.releaseTag, Preview: opts.preview, Try: opts.try, Yes: opts.yes, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "hooks":
+		if len(positional) != 1 {
+			usageErrorf(command, "expected install")
+		}
+		if err := (&hooksCmd{BaseDir: baseDir, Config: cfg, Action: positional[0], Mode: opts.hooksMode, Force: opts.force, Try: opts.try, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "self-update":
+		if err := (&selfUpdateCmd{Try: opts.try}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "clean":
+		if err := (&cleanCmd{BaseDir: baseDir, Config: cfg, Force: opts.force, Ignored: opts.ignored, Artifacts: opts.artifacts, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "diff":
+		if err := (&diffCmd{BaseDir: baseDir, Config: cfg, Update: opts.diffUpdate, Stat: opts.diffStat, GoVersions: opts.goVersions, Go: opts.goCurrent, PrevGo: opts.goPrev, KeepGoing: opts.keepGoing, Pick: opts.pick}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "unquarantine":
+		if err := (&unquarantineCmd{BaseDir: baseDir, Repos: positional}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "report":
+		if err := (&reportCmd{BaseDir: baseDir, Top: 20}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "transaction":
+		if len(positional) != 2 {
+			usageErrorf(command, "expected an action and a transaction name")
+		}
+		if err := (&transactionCmd{BaseDir: baseDir, Config: cfg, Action: positional[0], Name: positional[1], Title: opts.title, Pick: opts.pick, Try: opts.try}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "pr":
+		if len(positional) != 3 || positional[0] != "comment" {
+			usageErrorf(command, "expected comment, a run ID and the comment")
+		}
+		if err := (&prCommentCmd{BaseDir: baseDir, Config: cfg, RunID: positional[1], Body: positional[2], Try: opts.try}).Run(); err != nil {
+			fatalf("%v", err)
+		}
+	case "revert-run":
+		if len(positional) != 1 {
+			usageErrorf(command, "expected a run ID")
+		}
+		if err := (&revertRunCmd{BaseDir: baseDir, Config: cfg, RunID: positional[0], RevertMerged: opts.revertMerged, Try: opts.try, Yes: opts.yes}).Run(); err != nil {
 			fatalf("%v", err)
 		}
 	default:
 		fatalf("Unknown command: %s", os.Args[1])
 	}
+
+	endSection()
+	flushTraces()
 }
 
 // --- Update command ---
 
 type updateCmd struct {
 	BaseDir     string
-	GoVersion   string
-	PrevVersion string
+	Config      *config
+	GoVersions  []string // Go version matrix for workflows, oldest first (e.g. "1.25", "1.26", "tip")
+	Go          string   // Current Go version from --go, overriding the running Go
+	PrevGo      string   // Previous Go version from --prev-go
 	Force       bool
 	Try         bool
+	Draft       bool   // Open the PRs as drafts
+	KeepGoing   bool   // Go on with the other repos when one fails
+	ReviewWeb   bool   // Open the pushed branches in the browser instead of creating PRs
+	SinceTag    bool   // Check our own dependencies for unreleased commits first
+	Yes         bool   // With SinceTag, warn instead of asking
+	Worktree    bool   // Work in temporary worktrees instead of the checkouts
+	Pick        bool   // Interactively pick the repos to work on
+	Path        string // Update only the repo in this directory, listed or not
+	NoPreflight bool   // Skip the access checks before the run
+	RetryFailed bool   // Only update the repos that failed in the last run, in that run
+
+	runID   string
+	actions *actionResolver
+	summary runSummary
+
+	managed    map[string]bool           // GitHub paths of all listed repos
+	unreleased map[string]*unreleasedDep // Keyed by module path
 }
 
 func (cmd *updateCmd) Run() error {
 	// Check dependencies (use shell to resolve aliases)
-	if err := shellCommandExists("ghat"); err != nil {
-		return fmt.Errorf("ghat is required but not installed.\nInstall: go install github.com/JamesWoolfenden/ghat@latest")
-	}
-	if err := shellCommandExists("gh"); err != nil {
-		return fmt.Errorf("gh (GitHub CLI) is required but not installed.\nInstall: https://cli.github.com/")
+	if err := requireGitHub(); err != nil {
+		return err
 	}
-
-	// Derive Go versions from the running Go binary (current = running, previous = running - 1)
-	if goVersion, err := runningGoVersion(); err == nil {
-		cmd.GoVersion = goVersion
-		cmd.PrevVersion = prevGoVersion(cmd.GoVersion)
-		fmt.Printf("Using Go versions: %s.x (current), %s.x (previous) [running Go %s]\n", cmd.GoVersion, cmd.PrevVersion, goVersion)
-	} else {
-		fmt.Printf("Could not determine running Go version: %v\n", err)
+	if !cmd.Try {
+		if err := cmd.Config.checkSigning(cmd.BaseDir); err != nil {
+			return err
+		}
 	}
+	cmd.actions = newActionResolver()
 
-	// Find and process all gitjoin.txt files
-	repos, err := cmd.findRepos()
-	if err != nil {
+	if err := cmd.resolveGoVersions(); err != nil {
 		return err
 	}
 
-	if len(repos) == 0 {
-		fmt.Println("No repos found in gitjoin.txt files")
-		return nil
+	var repos []repo
+	var err error
+	if cmd.Path != "" {
+		r, err := repoFromDir(cmd.Path)
+		if err != nil {
+			return err
+		}
+		repos = []repo{r}
+	} else {
+		// Find and process all gitjoin.txt files
+		if repos, err = findRepos(cmd.BaseDir); err != nil {
+			return err
+		}
+
+		if cmd.Pick {
+			if repos, err = pickRepos(repos); err != nil {
+				return err
+			}
+		}
+
+		if len(repos) == 0 {
+			fmt.Println("No repos found in gitjoin.txt files")
+			return nil
+		}
+
+		fmt.Printf("Found %d repos in gitjoin.txt files\n", len(repos))
 	}
 
-	fmt.Printf("Found %d repos in gitjoin.txt files\n", len(repos))
+	var retry *runRecord
+	if cmd.RetryFailed {
+		if retry, err = lastRunRecord(cmd.BaseDir, "update"); err != nil {
+			return err
+		}
+		failed := map[string]bool{}
+		for _, f := range retry.Failures {
+			failed[f.Repo] = true
+		}
+		repos = slices.DeleteFunc(repos, func(r repo) bool { return !failed[r.Path] })
+		if len(repos) == 0 {
+			fmt.Printf("No failed repos to retry in run %s\n", retry.ID)
+			return nil
+		}
+		fmt.Printf("Retrying %d failed repos of run %s\n", len(repos), retry.ID)
+	}
 
-	for _, repo := range repos {
-		if err := cmd.updateRepo(repo); err != nil {
+	if !cmd.NoPreflight {
+		if err := cmd.Config.preflight(cmd.BaseDir, repos, true); err != nil {
 			return err
 		}
 	}
-	return nil
-}
 
-func (cmd *updateCmd) findRepos() ([]repo, error) {
-	var repos []repo
+	if err := setGoPrivate(repos); err != nil {
+		fmt.Printf("Could not determine private repos for GOPRIVATE: %v\n", err)
+	}
 
-	err := filepath.WalkDir(cmd.BaseDir, func(path string, d fs.DirEntry, err error) error {
+	if cmd.SinceTag {
+		all, err := listRepos(cmd.BaseDir)
 		if err != nil {
 			return err
 		}
+		cmd.managed = map[string]bool{}
+		for _, r := range all {
+			cmd.managed[r.Path] = true
+		}
+		cmd.unreleased = map[string]*unreleasedDep{}
+	}
 
-		// Skip .git directories
-		if d.IsDir() && d.Name() == ".git" {
-			return filepath.SkipDir
+	if !cmd.Worktree {
+		ready := slices.DeleteFunc(slices.Clone(repos), func(r repo) bool { return cmd.Config.repo(r.Path).SkipUpdate })
+		if err := cmd.Config.checkReadiness(ready, cmd.KeepGoing); err != nil {
+			return err
 		}
+	}
 
-		if d.Name() != "gitjoin.txt" {
-			return nil
+	cmd.runID = newRunID()
+	switch {
+	case cmd.Try:
+		// Dry runs are not recorded as runs, and leave the retried run alone.
+	case retry != nil:
+		// Keep the PRs of the retried repos with the ones of the run, and
+		// forget the failures we retry.
+		cmd.runID = retry.ID
+		if err := updateRunRecord(cmd.BaseDir, cmd.runID, func(rec *runRecord) {
+			rec.Failures = slices.DeleteFunc(rec.Failures, func(f runFailure) bool {
+				return slices.ContainsFunc(repos, func(r repo) bool { return r.Path == f.Repo })
+			})
+		}); err != nil {
+			return err
 		}
+	default:
+		startRunRecord(cmd.BaseDir, cmd.runID, "update")
+	}
+	fmt.Printf("Run ID: %s\n", cmd.runID)
+	if cmd.Worktree {
+		defer removeRunWorkDir(cmd.BaseDir, cmd.runID)
+	}
 
-		// Found a gitjoin.txt file
-		gitjoinDir := filepath.Dir(path)
-		lines, err := readLines(path)
-		if err != nil {
-			return fmt.Errorf("failed to read %s: %w", path, err)
+	err = forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.Config.withQuarantine(cmd.BaseDir, cmd.Try, func(repo repo) error {
+		err := cmd.updateRepo(repo)
+		if err != nil && !isSkipped(err) && !cmd.Try {
+			recordFailure(cmd.BaseDir, cmd.runID, repo.Path, err)
 		}
+		return err
+	}))
+	cmd.Config.trackPRs("update", cmd.runID, cmd.summary.PRs)
+	cmd.Config.notifyRun("update", cmd.runID, cmd.Try, &cmd.summary)
+	return err
+}
 
-		for _, line := range lines {
-			repoPath := repoPathFromGitjoinLine(line)
-			if repoPath == "" {
-				continue
-			}
-			repoName := repoNameFromPath(repoPath)
-			if repoName == "" {
-				continue
+// resolveGoVersions sets the Go versions to roll out from --go/--prev-go,
+// --go-version, the config, or derives them from the running Go binary
+// (current = running, previous = running - 1).
+func (cmd *updateCmd) resolveGoVersions() error {
+	switch {
+	case cmd.Go != "" || cmd.PrevGo != "":
+		if len(cmd.GoVersions) > 0 {
+			return fmt.Errorf("--go and --prev-go can't be combined with --go-version")
+		}
+		current := cmd.Go
+		if current == "" {
+			v, err := runningGoVersion()
+			if err != nil {
+				return err
 			}
-			repoDir := filepath.Join(gitjoinDir, repoName)
-			if !dirExists(repoDir) {
-				fmt.Printf("Skipping %s: not cloned at %s\n", repoPath, repoDir)
-				continue
+			current = v
+		}
+		prev := cmp.Or(cmd.PrevGo, prevGoVersion(current))
+		for _, v := range []string{current, prev} {
+			if !goVersionRe.MatchString(v) {
+				return fmt.Errorf("invalid Go version %q, expected e.g. 1.26 or 1.27rc1", v)
 			}
-			repos = append(repos, repo{
-				Path: repoPath,
-				Name: repoName,
-				Dir:  repoDir,
-			})
 		}
-
-		return nil
-	})
-
-	return repos, err
+		cmd.GoVersions = []string{prev, current}
+		fmt.Printf("Using Go versions: %s (current), %s (previous) [--go/--prev-go]\n", goMatrixEntries(cmd.GoVersions[1:])[0], goMatrixEntries(cmd.GoVersions[:1])[0])
+	case len(cmd.GoVersions) > 0:
+		fmt.Printf("Using Go versions: %s [--go-version]\n", strings.Join(goMatrixEntries(cmd.GoVersions), ", "))
+	case len(cmd.Config.GoVersions) > 0:
+		cmd.GoVersions = cmd.Config.GoVersions
+		fmt.Printf("Using Go versions: %s [%s]\n", strings.Join(goMatrixEntries(cmd.GoVersions), ", "), configFilename)
+	default:
+		if goVersion, err := runningGoVersion(); err == nil {
+			cmd.GoVersions = []string{prevGoVersion(goVersion), goVersion}
+			fmt.Printf("Using Go versions: %s.x (current), %s.x (previous) [running Go %s]\n", goVersion, cmd.GoVersions[0], goVersion)
+		} else {
+			fmt.Printf("Could not determine running Go version: %v\n", err)
+		}
+	}
+	return nil
 }
 
 func (cmd *updateCmd) updateRepo(repo repo) error {
-	fmt.Printf("\n=== Updating %s ===\n", repo.Path)
+	printSection("Updating " + repo.Path)
 
-	// Check for uncommitted changes
-	if dirty, status, err := checkUncommitted(repo.Dir); err != nil {
-		return err
-	} else if dirty {
-		return fmt.Errorf("repo %s has uncommitted changes:\n%s\nPlease commit or stash your changes", repo.Path, status)
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
 	}
 
-	// Get default branch and ensure we're on it
-	defaultBranch, err := getDefaultBranch(repo.Dir)
-	if err != nil {
-		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	if cmd.Config.repo(repo.Path).SkipUpdate {
+		fmt.Println("skip_update is set, skipping")
+		return skipRepo("skip_update is set")
+	}
+	if ref := cmd.Config.repo(repo.Path).Ref; ref != "" {
+		fmt.Printf("Pinned to %s, skipping\n", ref)
+		return skipRepo("pinned to %s", ref)
 	}
 
-	currentBranch, err := gitOutput(repo.Dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err := cmd.Config.checkArchived(repo, cmd.Try); err != nil {
+		return err
+	}
+
+	defaultBranch, err := cmd.Config.defaultBranch(repo)
 	if err != nil {
-		return fmt.Errorf("%s: failed to get current branch: %w", repo.Path, err)
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
 	}
-	currentBranch = strings.TrimSpace(currentBranch)
 
-	if currentBranch != defaultBranch {
-		fmt.Printf("Switching to %s...\n", defaultBranch)
-		if err := gitRun(repo.Dir, "checkout", defaultBranch); err != nil {
-			return fmt.Errorf("%s: failed to checkout %s: %w", repo.Path, defaultBranch, err)
+	if cmd.Worktree {
+		// Work in a throwaway worktree, leaving the user's checkout alone.
+		ws, err := newWorkspace(cmd.BaseDir, cmd.runID, repo, defaultBranch)
+		if err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
 		}
+		defer ws.Close()
+		repo.Dir = ws.Dir
+	} else if err := prepareCheckout(repo, defaultBranch, cmd.Config.PullStrategy); err != nil {
+		return err
 	}
+	data := newTemplateData(cmd.BaseDir, repo)
 
-	// Pull latest
-	if err := gitRun(repo.Dir, "pull"); err != nil {
-		return fmt.Errorf("%s: failed to pull: %w", repo.Path, err)
+	if cmd.SinceTag && hasGoMod(repo.Dir) {
+		if skip, err := cmd.checkUnreleased(repo); err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		} else if skip {
+			return skipRepo("unreleased dependencies")
+		}
 	}
 
 	// Run all update steps
-	result, err := cmd.runUpdateSteps(repo.Dir)
+	rc := cmd.Config.repo(repo.Path)
+	held := cmd.heldSteps(rc)
+	if len(held) > 0 {
+		cmd.summary.Held = append(cmd.summary.Held, summaryEntry{Repo: repo.Path, Detail: formatHeldSteps(held)})
+	}
+	result, err := cmd.runUpdateSteps(repo.Dir, rc, held)
 	if err != nil {
 		return fmt.Errorf("%s: %w", repo.Path, err)
 	}
 
-	// Build commit message based on what was actually updated
+	// Collect what was actually updated
 	var updates []string
-	if result.UpdatedGoVersions && testYmlChanged(repo.Dir) {
-		updates = append(updates, fmt.Sprintf("Go %s.x/%s.x", cmd.PrevVersion, cmd.GoVersion))
+	if result.UpdatedGoVersions && workflowsChanged(repo.Dir) {
+		updates = append(updates, fmt.Sprintf("Go %s in %s", strings.Join(goMatrixEntries(cmd.GoVersions), "/"), strings.Join(result.GoVersionsFiles, ", ")))
 	}
-	if result.UpdatedGitHubActions && testYmlChanged(repo.Dir) {
+	if result.UpdatedGitHubActions && workflowsChanged(repo.Dir) {
 		updates = append(updates, "GitHub Actions")
 	}
+	if len(result.RunnerLabelsFiles) > 0 && workflowsChanged(repo.Dir) {
+		updates = append(updates, "runner labels in "+strings.Join(result.RunnerLabelsFiles, ", "))
+	}
 	if result.UpdatedGoMod && goModChanged(repo.Dir) {
-		updates = append(updates, fmt.Sprintf("go.mod Go %s, dependencies", cmd.PrevVersion))
+		updates = append(updates, fmt.Sprintf("go.mod Go %s, dependencies", cmd.goModVersion()))
+	}
+	if len(result.GeneratedFiles) > 0 {
+		updates = append(updates, "generated code")
 	}
 
 	if len(updates) == 0 {
@@ -213,12 +557,51 @@ func (cmd *updateCmd) updateRepo(repo repo) error {
 		return nil
 	}
 
+	// Make sure the updated repo still builds (and optionally passes its tests)
+	if err := cmd.verify(repo); err != nil {
+		if err := cmd.revert(repo.Dir, result); err != nil {
+			return fmt.Errorf("%s: failed to revert changes: %w", repo.Path, err)
+		}
+		return fmt.Errorf("%s: verification failed, changes reverted: %w", repo.Path, err)
+	}
+
+	if cmd.Config.SBOM != "" && result.UpdatedGoMod && !cmd.Try {
+		if filename, err := writeSBOM(cmd.BaseDir, cmd.runID, repo, cmd.Config.SBOM); err != nil {
+			fmt.Printf("Failed to write the SBOM: %v\n", err)
+		} else {
+			fmt.Printf("Wrote SBOM to %s\n", filename)
+		}
+	}
+
+	// Show what the edits did before anything is committed
+	cmd.printUpdateDiff(repo)
+
+	// Describe what actually changed
+	changes := collectUpdateChanges(repo.Dir)
+	// Don't let an ecosystem-breaking update pass as a routine one.
+	large := changes.largeUpdate(cmd.Config.largeUpdateModules())
+	if len(large) > 0 {
+		fmt.Printf("Large update, flagging for manual review: %s\n", strings.Join(large, "; "))
+	}
+	commitMsg, prBody, err := cmd.Config.prMessage("update", data,
+		updateCommitMessage(changes, goMatrixEntries(cmd.GoVersions), updates, len(result.GeneratedFiles) > 0),
+		updatePRBody(changes, updates, result, large))
+	if err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+
 	// Dry-run: show what would be done and revert
 	if cmd.Try {
-		commitMsg := "Update " + strings.Join(updates, ", ")
 		fmt.Printf("[dry-run] Would commit: %s\n", commitMsg)
-		fmt.Printf("[dry-run] Would create PR: %s\n", commitMsg)
-		if err := gitRun(repo.Dir, "checkout", "."); err != nil {
+		switch {
+		case cmd.ReviewWeb || cmd.Config.repo(repo.Path).ReviewWeb:
+			fmt.Printf("[dry-run] Would open in the browser for review: %s\n", commitMsg)
+		case cmd.Draft || len(large) > 0:
+			fmt.Printf("[dry-run] Would create draft PR: %s\n", commitMsg)
+		default:
+			fmt.Printf("[dry-run] Would create PR: %s\n", commitMsg)
+		}
+		if err := cmd.revert(repo.Dir, result); err != nil {
 			return fmt.Errorf("%s: failed to revert changes: %w", repo.Path, err)
 		}
 		return nil
@@ -227,14 +610,14 @@ func (cmd *updateCmd) updateRepo(repo repo) error {
 	// Require at least 2 updates unless --force is used
 	if len(updates) < 2 && !cmd.Force {
 		fmt.Printf("Only %d update(s), skipping PR (use --force to override)\n", len(updates))
-		if err := gitRun(repo.Dir, "checkout", "."); err != nil {
+		if err := cmd.revert(repo.Dir, result); err != nil {
 			return fmt.Errorf("%s: failed to revert changes: %w", repo.Path, err)
 		}
-		return nil
+		return skipRepo("only %d update(s)", len(updates))
 	}
 
 	// Generate branch name from hash of all changed files
-	branchName, err := cmd.generateBranchName(repo.Dir)
+	branchName, err := cmd.generateBranchName(repo.Dir, data)
 	if err != nil {
 		return fmt.Errorf("%s: %w", repo.Path, err)
 	}
@@ -242,170 +625,482 @@ func (cmd *updateCmd) updateRepo(repo repo) error {
 	// Check if branch already exists remotely
 	if branchExistsRemote(repo.Dir, branchName) {
 		fmt.Printf("Branch %s already exists, skipping\n", branchName)
-		if err := gitRun(repo.Dir, "checkout", "."); err != nil {
+		if err := cmd.revert(repo.Dir, result); err != nil {
 			return fmt.Errorf("%s: failed to revert changes: %w", repo.Path, err)
 		}
-		return nil
+		return skipRepo("branch %s already exists", branchName)
 	}
 
 	// Create branch, commit, push, and create PR
-	commitMsg := "Update " + strings.Join(updates, ", ")
-	prBody := "Updates: " + strings.Join(updates, ", ") + "\n\n---\nCreated by mygithelper"
-
-	if err := cmd.createPR(repo.Dir, defaultBranch, branchName, commitMsg, prBody); err != nil {
+	opts := cmd.prOptions(repo.Path)
+	opts.Draft = opts.Draft || len(large) > 0
+	url, err := cmd.Config.commitAndCreatePR(repo, prChange{
+		Base:      defaultBranch,
+		Branch:    branchName,
+		Title:     commitMsg,
+		Body:      prBody,
+		Options:   opts,
+		ReviewWeb: cmd.ReviewWeb || cmd.Config.repo(repo.Path).ReviewWeb,
+		Worktree:  cmd.Worktree,
+	})
+	if err != nil {
 		return fmt.Errorf("%s: %w", repo.Path, err)
 	}
+	cmd.summary.addPR(repo.Path, url)
+	if len(large) > 0 {
+		cmd.summary.Flagged = append(cmd.summary.Flagged, summaryEntry{Repo: repo.Path, Detail: strings.Join(large, "; ")})
+	}
+	addStepSummary(fmt.Sprintf("- %s: created PR %q", repo.Path, commitMsg))
+	if err := recordPR(cmd.BaseDir, cmd.runID, repo.Dir, repo.Path, branchName, commitMsg); err != nil {
+		fmt.Printf("Failed to record PR in run %s: %v\n", cmd.runID, err)
+	}
 
 	return nil
 }
 
+// revert undoes the changes of the update steps in repoDir, removing the
+// files go generate created along with the tracked changes.
+func (cmd *updateCmd) revert(repoDir string, result updateResult) error {
+	if err := gitRun(repoDir, "checkout", "."); err != nil {
+		return err
+	}
+	if len(result.GeneratedFiles) == 0 {
+		return nil
+	}
+	return gitRun(repoDir, append([]string{"clean", "-fd", "--"}, result.GeneratedFiles...)...)
+}
+
 type updateResult struct {
 	UpdatedGoVersions    bool
+	GoVersionsFiles      []string // Workflow files with updated Go versions
 	UpdatedGitHubActions bool
+	RunnerLabelsFiles    []string // Workflow files with renamed runner labels
 	UpdatedGoMod         bool
+	GeneratedFiles       []string // Files changed by go generate
+
+	// Vulnerabilities (OSV IDs) reported by govulncheck, if enabled.
+	VulnCheck      bool
+	VulnsFixed     []string
+	VulnsRemaining []string
 }
 
-func (cmd *updateCmd) runUpdateSteps(repoDir string) (updateResult, error) {
+// runUpdateSteps runs the update steps in repoDir, leaving out the held ones.
+func (cmd *updateCmd) runUpdateSteps(repoDir string, rc repoConfig, held map[string]string) (updateResult, error) {
 	var result updateResult
 
-	// Step 1: Update test.yml with Go versions (optional - requires file and Go version config)
-	if cmd.GoVersion != "" && hasTestYml(repoDir) {
-		fmt.Println("Updating test.yml...")
-		if _, _, err := cmd.updateTestYml(repoDir); err != nil {
-			return result, fmt.Errorf("failed to update test.yml: %w", err)
+	for _, step := range updateSteps {
+		if reason, ok := held[step]; ok {
+			fmt.Printf("Holding back %s: %s\n", step, reason)
+		}
+	}
+	run := func(step string) bool {
+		_, ok := held[step]
+		return !ok
+	}
+
+	// Fail before changing anything if a generator is missing
+	if rc.Generate {
+		if missing := missingGenerators(repoDir); len(missing) > 0 {
+			return result, fmt.Errorf("go generate needs %s, which is not installed", strings.Join(missing, ", "))
+		}
+	}
+
+	// Step 0: Check for vulnerabilities before updating (optional - requires go.mod and govulncheck config)
+	var vulnsBefore []string
+	checkVulns := cmd.Config.Govulncheck && hasGoMod(repoDir) && run("govulncheck")
+	if checkVulns {
+		printStep("Running govulncheck...")
+		var err error
+		if vulnsBefore, err = runGovulncheck(repoDir); err != nil {
+			return result, fmt.Errorf("govulncheck failed: %w", err)
+		}
+	}
+
+	// Step 1: Update workflows with Go versions (optional - requires workflows and Go version config)
+	if len(cmd.GoVersions) > 0 && hasWorkflowsDir(repoDir) && run("go_versions") {
+		printStep("Updating Go versions in workflows...")
+		changed, err := cmd.updateWorkflows(repoDir)
+		if err != nil {
+			return result, fmt.Errorf("failed to update workflows: %w", err)
+		}
+		result.UpdatedGoVersions = len(changed) > 0
+		result.GoVersionsFiles = changed
+	}
+
+	// Step 2: Pin GitHub Actions to their latest releases (optional - directory may not exist)
+	if hasWorkflowsDir(repoDir) && run("actions") {
+		printStep("Updating GitHub Actions...")
+		changed, err := cmd.updateActions(repoDir)
+		if err != nil {
+			return result, fmt.Errorf("failed to update GitHub Actions: %w", err)
 		}
-		result.UpdatedGoVersions = testYmlChanged(repoDir)
+		result.UpdatedGitHubActions = len(changed) > 0
 	}
 
-	// Step 2: Run ghat on .github/workflows (optional - directory may not exist)
-	testYmlBeforeGhat := readFileOrEmpty(filepath.Join(repoDir, ".github", "workflows", "test.yml"))
-	if hasWorkflowsDir(repoDir) {
-		fmt.Println("Running ghat swot...")
-		if err := runGhat(repoDir); err != nil {
-			return result, fmt.Errorf("ghat failed: %w", err)
+	// Step 2b: Rename runner labels (optional - requires workflows and runner_labels config)
+	if len(cmd.Config.RunnerLabels) > 0 && hasWorkflowsDir(repoDir) && run("runner_labels") {
+		printStep("Renaming runner labels in workflows...")
+		changed, err := cmd.updateRunnerLabels(repoDir)
+		if err != nil {
+			return result, fmt.Errorf("failed to rename runner labels: %w", err)
 		}
-		testYmlAfterGhat := readFileOrEmpty(filepath.Join(repoDir, ".github", "workflows", "test.yml"))
-		result.UpdatedGitHubActions = testYmlAfterGhat != testYmlBeforeGhat
+		result.RunnerLabelsFiles = changed
 	}
 
 	// Step 3: Update Go version in go.mod (optional - requires go.mod and Go version config)
-	if cmd.GoVersion != "" && hasGoMod(repoDir) {
-		goModVersion := cmd.PrevVersion
-		fmt.Printf("Setting go.mod version to %s...\n", goModVersion)
+	if cmd.goModVersion() != "" && hasGoMod(repoDir) && run("go_directive") {
+		goModVersion := cmd.goModVersion()
+		printStep(fmt.Sprintf("Setting go.mod version to %s...", goModVersion))
 		if err := goRun(repoDir, "mod", "edit", "-go", goModVersion); err != nil {
 			return result, fmt.Errorf("go mod edit failed: %w", err)
 		}
 	}
 
 	// Step 4: Update dependencies (optional - requires go.mod and Go version config)
-	if cmd.GoVersion != "" && hasGoMod(repoDir) {
-		fmt.Println("Updating dependencies...")
+	if cmd.goModVersion() != "" && hasGoMod(repoDir) && run("dependencies") {
+		printStep("Updating dependencies...")
 		if err := goRun(repoDir, "get", "-t", "-u", "./..."); err != nil {
 			return result, fmt.Errorf("go get failed: %w", err)
 		}
 	}
 
-	result.UpdatedGoMod = goModChanged(repoDir)
-
-	return result, nil
-}
+	// Step 5: Tidy go.mod and go.sum (optional - requires go.mod, can be turned off per repo)
+	if cmd.goModVersion() != "" && hasGoMod(repoDir) && !rc.SkipTidy && run("tidy") {
+		printStep("Running go mod tidy...")
+		if err := goRun(repoDir, "mod", "tidy"); err != nil {
+			return result, fmt.Errorf("go mod tidy failed: %w", err)
+		}
+	}
 
-func (cmd *updateCmd) generateBranchName(repoDir string) (string, error) {
-	h := xxhash.New()
+	result.UpdatedGoMod = goModChanged(repoDir)
 
-	// Hash test.yml if changed
-	if testYmlChanged(repoDir) {
-		content, err := os.ReadFile(filepath.Join(repoDir, ".github", "workflows", "test.yml"))
-		if err != nil {
-			return "", err
+	// Step 6: Regenerate code after dependency bumps (optional - per repo)
+	if result.UpdatedGoMod && rc.Generate && run("generate") {
+		printStep("Running go generate ./...")
+		if err := goRun(repoDir, "generate", "./..."); err != nil {
+			return result, fmt.Errorf("go generate failed: %w", err)
 		}
-		h.Write(content)
+		result.GeneratedFiles = generatedFiles(repoDir)
 	}
 
-	// Hash go.mod if changed
-	if goModChanged(repoDir) {
-		content, err := os.ReadFile(filepath.Join(repoDir, "go.mod"))
+	// Step 7: Check which vulnerabilities the update fixed
+	if checkVulns && result.UpdatedGoMod {
+		printStep("Running govulncheck...")
+		vulnsAfter, err := runGovulncheck(repoDir)
 		if err != nil {
-			return "", err
+			return result, fmt.Errorf("govulncheck failed: %w", err)
+		}
+		result.VulnCheck = true
+		result.VulnsRemaining = vulnsAfter
+		for _, id := range vulnsBefore {
+			if !slices.Contains(vulnsAfter, id) {
+				result.VulnsFixed = append(result.VulnsFixed, id)
+			}
 		}
-		h.Write(content)
 	}
 
-	return fmt.Sprintf("mygithelper/update-%x", h.Sum64()), nil
+	return result, nil
 }
 
-func (cmd *updateCmd) createPR(repoDir, defaultBranch, branchName, commitMsg, prBody string) error {
-	if err := gitRun(repoDir, "checkout", "-b", branchName); err != nil {
-		return fmt.Errorf("failed to create branch: %w", err)
+// verify runs go build, and go test if configured, on the updated repo.
+func (cmd *updateCmd) verify(repo repo) error {
+	if !hasGoMod(repo.Dir) {
+		return nil
 	}
 
-	if err := gitRun(repoDir, "add", "-A"); err != nil {
-		return fmt.Errorf("failed to stage changes: %w", err)
+	mode, timeout := cmd.Config.verify(repo.Path)
+	if mode == "none" {
+		return nil
 	}
 
-	if err := gitRun(repoDir, "commit", "-m", commitMsg); err != nil {
-		return fmt.Errorf("failed to commit: %w", err)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	fmt.Printf("Pushing branch %s...\n", branchName)
-	if err := gitRun(repoDir, "push", "-u", "origin", branchName); err != nil {
-		return fmt.Errorf("failed to push: %w", err)
+	printStep("Running go build ./...")
+	if err := goRunContext(ctx, repo.Dir, "build", "./..."); err != nil {
+		return fmt.Errorf("go build failed: %w", err)
 	}
 
-	fmt.Println("Creating PR...")
-	if err := createPR(repoDir, commitMsg, prBody); err != nil {
-		return fmt.Errorf("failed to create PR: %w", err)
+	if mode == "test" {
+		printStep("Running go test ./...")
+		if err := goRunContext(ctx, repo.Dir, "test", "./..."); err != nil {
+			return fmt.Errorf("go test failed: %w", err)
+		}
 	}
 
-	if err := gitRun(repoDir, "checkout", defaultBranch); err != nil {
-		return fmt.Errorf("failed to checkout %s: %w", defaultBranch, err)
+	return nil
+}
+
+// goModVersion returns the Go version to set in go.mod, the oldest released
+// version in the matrix.
+func (cmd *updateCmd) goModVersion() string {
+	for _, v := range cmd.GoVersions {
+		if v != "tip" {
+			return v
+		}
 	}
+	return ""
+}
 
-	return nil
+// currentGoVersion returns the newest released Go version update rolls out.
+func (cmd *updateCmd) currentGoVersion() string {
+	for _, v := range slices.Backward(cmd.GoVersions) {
+		if v != "tip" {
+			return v
+		}
+	}
+	return ""
+}
+
+// heldSteps returns the update steps held back in a repo by hold_go and
+// skip_steps, with the reason.
+func (cmd *updateCmd) heldSteps(rc repoConfig) map[string]string {
+	held := map[string]string{}
+	current := cmd.currentGoVersion()
+	if rc.HoldGo != "" && current != "" && version.Compare("go"+current, "go"+rc.HoldGo) > 0 {
+		held["go_versions"] = "Go held at " + rc.HoldGo
+		held["go_directive"] = "Go held at " + rc.HoldGo
+	}
+	for step, until := range rc.SkipSteps {
+		if until == "" {
+			held[step] = "skip_steps"
+		} else if date, err := time.Parse(time.DateOnly, until); err == nil {
+			if time.Now().Before(date) {
+				held[step] = "skipped until " + until
+			}
+		} else if current == "" || version.Compare("go"+current, "go"+until) < 0 {
+			held[step] = "skipped until Go " + until
+		}
+	}
+	return held
+}
+
+// formatHeldSteps lists the held steps by reason, e.g. "go_versions,
+// go_directive: Go held at 1.25; actions: skipped until 2026-12-01".
+func formatHeldSteps(held map[string]string) string {
+	var reasons []string
+	stepsByReason := map[string][]string{}
+	for _, step := range updateSteps {
+		if reason, ok := held[step]; ok {
+			if stepsByReason[reason] == nil {
+				reasons = append(reasons, reason)
+			}
+			stepsByReason[reason] = append(stepsByReason[reason], step)
+		}
+	}
+	var parts []string
+	for _, reason := range reasons {
+		parts = append(parts, strings.Join(stepsByReason[reason], ", ")+": "+reason)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (cmd *updateCmd) generateBranchName(repoDir string, data templateData) (string, error) {
+	h := xxhash.New()
+
+	// Hash workflows if changed
+	if workflowsChanged(repoDir) {
+		workflows := readWorkflows(repoDir)
+		for _, name := range slices.Sorted(maps.Keys(workflows)) {
+			h.Write([]byte(workflows[name]))
+		}
+	}
+
+	// Hash go.mod if changed
+	if goModChanged(repoDir) {
+		content, err := os.ReadFile(filepath.Join(repoDir, "go.mod"))
+		if err != nil {
+			return "", err
+		}
+		h.Write(content)
+	}
+
+	return cmd.Config.branchName("update", h.Sum64(), data)
 }
 
-func (cmd *updateCmd) updateTestYml(repoDir string) (newContent []byte, updated bool, err error) {
-	testYmlPath := filepath.Join(repoDir, ".github", "workflows", "test.yml")
-	content, err := os.ReadFile(testYmlPath)
+// checkUnreleased lists the dependencies of repo we maintain ourselves that
+// have commits after their latest tag and, unless --yes is set, asks whether
+// to go on (e.g. after cutting a release), skip the repo or stop.
+func (cmd *updateCmd) checkUnreleased(repo repo) (skip bool, err error) {
+	deps, err := unreleasedDeps(repo.Dir, cmd.managed, cmd.unreleased)
 	if err != nil {
-		return nil, false, fmt.Errorf("no .github/workflows/test.yml found")
+		return false, err
 	}
+	if len(deps) == 0 {
+		return false, nil
+	}
+
+	for _, dep := range deps {
+		fmt.Printf("%s has %d unreleased commit(s) since %s\n", dep.Module, dep.AheadBy, dep.Tag)
+	}
+	if cmd.Yes || cmd.Try {
+		return false, nil
+	}
+
+	for range maxPromptTries {
+		answer, err := prompt("Release them first? [c]ontinue (e.g. after tagging), [s]kip repo, [q]uit:")
+		if err != nil {
+			return false, fmt.Errorf("%w; use --yes to go on without asking", err)
+		}
+		switch strings.ToLower(answer) {
+		case "c", "continue":
+			// Look again next time, the user may have tagged a release.
+			for _, dep := range deps {
+				delete(cmd.unreleased, dep.Module)
+			}
+			return false, nil
+		case "s", "skip":
+			return true, nil
+		case "q", "quit":
+			return false, errors.New("stopped by user")
+		}
+	}
+	return false, errors.New("stopped, no valid answer")
+}
 
-	original := string(content)
+func (cmd *updateCmd) prOptions(repoPath string) prOptions {
+	opts := cmd.Config.prOptions(repoPath)
+	opts.Draft = cmd.Draft
+	return opts
+}
 
-	re := regexp.MustCompile(`(?m)(go-version:\s*)\[([^\]]*)\]`)
-	newVersions := fmt.Sprintf("[%s.x, %s.x]", cmd.PrevVersion, cmd.GoVersion)
-	result := re.ReplaceAllString(original, "${1}"+newVersions)
+// updateWorkflows sets the go-version matrix in all workflow files and returns
+// the names of the files changed.
+func (cmd *updateCmd) updateWorkflows(repoDir string) (changed []string, err error) {
+	versions := goMatrixEntries(cmd.GoVersions)
 
-	if result == original {
-		return nil, false, nil
+	for _, name := range workflowFiles(repoDir) {
+		filename := filepath.Join(repoDir, ".github", "workflows", name)
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		newContent, updated, err := setGoVersionMatrix(content, versions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		if !updated {
+			continue
+		}
+
+		if err := os.WriteFile(filename, newContent, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		changed = append(changed, name)
 	}
 
-	newContent = []byte(result)
-	if err := os.WriteFile(testYmlPath, newContent, 0o644); err != nil {
-		return nil, false, fmt.Errorf("failed to write test.yml: %w", err)
+	return changed, nil
+}
+
+// updateActions pins the GitHub Actions used in all workflow files and
+// returns the names of the files that changed.
+func (cmd *updateCmd) updateActions(repoDir string) (changed []string, err error) {
+	for _, name := range workflowFiles(repoDir) {
+		filename := filepath.Join(repoDir, ".github", "workflows", name)
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		newContent, updated, err := pinActions(content, cmd.actions.resolve)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if !updated {
+			continue
+		}
+
+		if err := os.WriteFile(filename, newContent, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		changed = append(changed, name)
 	}
 
-	return newContent, true, nil
+	return changed, nil
+}
+
+// printUpdateDiff prints the diff of the workflows and go.mod in repo and,
+// unless it's a dry run, records it with the run. go.sum and generated code
+// are left out, they're too long to read.
+func (cmd *updateCmd) printUpdateDiff(repo repo) {
+	diff, err := gitOutput(repo.Dir, "diff", "--no-color", "HEAD", "--", ".github/workflows", "go.mod")
+	if err != nil || strings.TrimSpace(diff) == "" {
+		return
+	}
+	fmt.Println("Changes to the workflows and go.mod:")
+	fmt.Print(diff)
+	if cmd.Try {
+		return
+	}
+	if err := recordDiff(cmd.BaseDir, cmd.runID, repo.Path, diff); err != nil {
+		fmt.Printf("Failed to record the diff in run %s: %v\n", cmd.runID, err)
+	}
+}
+
+// updateRunnerLabels renames the runner labels in runner_labels in all
+// workflow files and returns the names of the files that changed.
+func (cmd *updateCmd) updateRunnerLabels(repoDir string) (changed []string, err error) {
+	for _, name := range workflowFiles(repoDir) {
+		filename := filepath.Join(repoDir, ".github", "workflows", name)
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		newContent, updated, err := setRunnerLabels(content, cmd.Config.RunnerLabels)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		if !updated {
+			continue
+		}
+
+		if err := os.WriteFile(filename, newContent, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		changed = append(changed, name)
+	}
+
+	return changed, nil
 }
 
 // --- Fix command ---
 
 type fixCmd struct {
-	BaseDir string
-	Try     bool
+	BaseDir   string
+	Config    *config
+	Try       bool
+	KeepGoing bool // Go on with the other repos when one fails
+	ReviewWeb bool // Open the pushed branches in the browser instead of creating PRs
+	Worktree  bool // Work in temporary worktrees instead of the checkouts
+	Pick      bool // Interactively pick the repos to work on
+
+	runID   string
+	summary runSummary
 }
 
 func (cmd *fixCmd) Run() error {
-	if err := shellCommandExists("gh"); err != nil {
-		return fmt.Errorf("gh (GitHub CLI) is required but not installed.\nInstall: https://cli.github.com/")
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+	if !cmd.Try {
+		if err := cmd.Config.checkSigning(cmd.BaseDir); err != nil {
+			return err
+		}
 	}
 
-	repos, err := cmd.findRepos()
+	repos, err := findRepos(cmd.BaseDir)
 	if err != nil {
 		return err
 	}
 
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+
 	if len(repos) == 0 {
 		fmt.Println("No repos found in gitjoin.txt files")
 		return nil
@@ -413,104 +1108,73 @@ func (cmd *fixCmd) Run() error {
 
 	fmt.Printf("Found %d repos in gitjoin.txt files\n", len(repos))
 
-	for _, repo := range repos {
-		if err := cmd.fixRepo(repo); err != nil {
-			return err
-		}
+	if err := setGoPrivate(repos); err != nil {
+		fmt.Printf("Could not determine private repos for GOPRIVATE: %v\n", err)
 	}
-	return nil
-}
-
-func (cmd *fixCmd) findRepos() ([]repo, error) {
-	var repos []repo
 
-	err := filepath.WalkDir(cmd.BaseDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
+	if !cmd.Worktree {
+		if err := cmd.Config.checkReadiness(repos, cmd.KeepGoing); err != nil {
 			return err
 		}
+	}
 
-		if d.IsDir() && d.Name() == ".git" {
-			return filepath.SkipDir
-		}
-
-		if d.Name() != "gitjoin.txt" {
-			return nil
-		}
-
-		gitjoinDir := filepath.Dir(path)
-		lines, err := readLines(path)
-		if err != nil {
-			return fmt.Errorf("failed to read %s: %w", path, err)
-		}
+	cmd.runID = newRunID()
+	fmt.Printf("Run ID: %s\n", cmd.runID)
+	if cmd.Worktree {
+		defer removeRunWorkDir(cmd.BaseDir, cmd.runID)
+	}
 
-		for _, line := range lines {
-			repoPath := repoPathFromGitjoinLine(line)
-			if repoPath == "" {
-				continue
-			}
-			repoName := repoNameFromPath(repoPath)
-			if repoName == "" {
-				continue
-			}
-			repoDir := filepath.Join(gitjoinDir, repoName)
-			if !dirExists(repoDir) {
-				fmt.Printf("Skipping %s: not cloned at %s\n", repoPath, repoDir)
-				continue
-			}
-			repos = append(repos, repo{
-				Path: repoPath,
-				Name: repoName,
-				Dir:  repoDir,
-			})
+	err = forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.Config.withQuarantine(cmd.BaseDir, cmd.Try, func(repo repo) error {
+		err := cmd.fixRepo(repo)
+		if err != nil && !isSkipped(err) && !cmd.Try {
+			recordFailure(cmd.BaseDir, cmd.runID, repo.Path, err)
 		}
-
-		return nil
-	})
-
-	return repos, err
+		return err
+	}))
+	cmd.Config.trackPRs("fix", cmd.runID, cmd.summary.PRs)
+	cmd.Config.notifyRun("fix", cmd.runID, cmd.Try, &cmd.summary)
+	return err
 }
 
 func (cmd *fixCmd) fixRepo(repo repo) error {
-	fmt.Printf("\n=== Fixing %s ===\n", repo.Path)
+	printSection("Fixing " + repo.Path)
 
-	if !hasGoMod(repo.Dir) {
-		fmt.Println("No go.mod, skipping")
-		return nil
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
 	}
 
-	// Check for uncommitted changes
-	if dirty, status, err := checkUncommitted(repo.Dir); err != nil {
+	if err := cmd.Config.checkArchived(repo, cmd.Try); err != nil {
 		return err
-	} else if dirty {
-		return fmt.Errorf("repo %s has uncommitted changes:\n%s\nPlease commit or stash your changes", repo.Path, status)
 	}
 
-	// Get default branch and ensure we're on it
-	defaultBranch, err := getDefaultBranch(repo.Dir)
-	if err != nil {
-		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	if !hasGoMod(repo.Dir) {
+		fmt.Println("No go.mod, skipping")
+		return skipRepo("no go.mod")
 	}
 
-	currentBranch, err := gitOutput(repo.Dir, "rev-parse", "--abbrev-ref", "HEAD")
+	defaultBranch, err := cmd.Config.defaultBranch(repo)
 	if err != nil {
-		return fmt.Errorf("%s: failed to get current branch: %w", repo.Path, err)
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
 	}
-	currentBranch = strings.TrimSpace(currentBranch)
 
-	if currentBranch != defaultBranch {
-		fmt.Printf("Switching to %s...\n", defaultBranch)
-		if err := gitRun(repo.Dir, "checkout", defaultBranch); err != nil {
-			return fmt.Errorf("%s: failed to checkout %s: %w", repo.Path, defaultBranch, err)
+	if cmd.Worktree {
+		// Work in a throwaway worktree, leaving the user's checkout alone.
+		ws, err := newWorkspace(cmd.BaseDir, cmd.runID, repo, defaultBranch)
+		if err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		}
+		defer ws.Close()
+		repo.Dir = ws.Dir
+	} else {
+		cmd.Config.warnPinned(repo, defaultBranch)
+		if err := prepareCheckout(repo, defaultBranch, cmd.Config.PullStrategy); err != nil {
+			return err
 		}
 	}
-
-	// Pull latest
-	if err := gitRun(repo.Dir, "pull"); err != nil {
-		return fmt.Errorf("%s: failed to pull: %w", repo.Path, err)
-	}
+	data := newTemplateData(cmd.BaseDir, repo)
 
 	// Run modernize -fix
-	fmt.Println("Running modernize -fix...")
+	printStep("Running modernize -fix...")
 	if err := goRun(repo.Dir, "run", "golang.org/x/tools/go/analysis/passes/modernize/cmd/modernize@latest", "-fix", "./..."); err != nil {
 		return fmt.Errorf("%s: modernize failed: %w", repo.Path, err)
 	}
@@ -523,10 +1187,20 @@ func (cmd *fixCmd) fixRepo(repo repo) error {
 		return nil
 	}
 
+	commitMsg, prBody, err := cmd.Config.prMessage("fix", data, "all: Run modernize -fix ./...",
+		"all: Run modernize -fix ./...\n\n---\nCreated by mygithelper")
+	if err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+
 	// Dry-run: show what would be done and revert
 	if cmd.Try {
-		fmt.Println("[dry-run] Would commit: all: Run modernize -fix ./...")
-		fmt.Println("[dry-run] Would create PR: all: Run modernize -fix ./...")
+		fmt.Printf("[dry-run] Would commit: %s\n", commitMsg)
+		if cmd.ReviewWeb || cmd.Config.repo(repo.Path).ReviewWeb {
+			fmt.Printf("[dry-run] Would open in the browser for review: %s\n", commitMsg)
+		} else {
+			fmt.Printf("[dry-run] Would create PR: %s\n", commitMsg)
+		}
 		if err := gitRun(repo.Dir, "checkout", "."); err != nil {
 			return fmt.Errorf("%s: failed to revert changes: %w", repo.Path, err)
 		}
@@ -534,7 +1208,7 @@ func (cmd *fixCmd) fixRepo(repo repo) error {
 	}
 
 	// Generate branch name from diff hash
-	branchName, err := cmd.generateBranchName(repo.Dir)
+	branchName, err := cmd.generateBranchName(repo.Dir, data)
 	if err != nil {
 		return fmt.Errorf("%s: %w", repo.Path, err)
 	}
@@ -545,20 +1219,31 @@ func (cmd *fixCmd) fixRepo(repo repo) error {
 		if err := gitRun(repo.Dir, "checkout", "."); err != nil {
 			return fmt.Errorf("%s: failed to revert changes: %w", repo.Path, err)
 		}
-		return nil
+		return skipRepo("branch %s already exists", branchName)
 	}
 
-	commitMsg := "all: Run modernize -fix ./..."
-	prBody := commitMsg + "\n\n---\nCreated by mygithelper"
-
-	if err := cmd.createPR(repo.Dir, defaultBranch, branchName, commitMsg, prBody); err != nil {
+	url, err := cmd.Config.commitAndCreatePR(repo, prChange{
+		Base:      defaultBranch,
+		Branch:    branchName,
+		Title:     commitMsg,
+		Body:      prBody,
+		Options:   cmd.Config.prOptions(repo.Path),
+		ReviewWeb: cmd.ReviewWeb || cmd.Config.repo(repo.Path).ReviewWeb,
+		Worktree:  cmd.Worktree,
+	})
+	if err != nil {
 		return fmt.Errorf("%s: %w", repo.Path, err)
 	}
+	cmd.summary.addPR(repo.Path, url)
+	addStepSummary(fmt.Sprintf("- %s: created PR %q", repo.Path, commitMsg))
+	if err := recordPR(cmd.BaseDir, cmd.runID, repo.Dir, repo.Path, branchName, commitMsg); err != nil {
+		fmt.Printf("Failed to record PR in run %s: %v\n", cmd.runID, err)
+	}
 
 	return nil
 }
 
-func (cmd *fixCmd) generateBranchName(repoDir string) (string, error) {
+func (cmd *fixCmd) generateBranchName(repoDir string, data templateData) (string, error) {
 	h := xxhash.New()
 
 	output, err := gitOutput(repoDir, "diff")
@@ -567,41 +1252,345 @@ func (cmd *fixCmd) generateBranchName(repoDir string) (string, error) {
 	}
 	h.Write([]byte(output))
 
-	return fmt.Sprintf("mygithelper/fix-%x", h.Sum64()), nil
+	return cmd.Config.branchName("fix", h.Sum64(), data)
+}
+
+// --- Helpers ---
+
+// skipError is returned for a repo that was left alone, with the reason.
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+func skipRepo(format string, args ...any) error {
+	return &skipError{reason: fmt.Sprintf(format, args...)}
+}
+
+func isSkipped(err error) bool {
+	var skip *skipError
+	return errors.As(err, &skip)
+}
+
+// runSummary collects what a command did to the repos, printed at the end
+// of the run.
+type runSummary struct {
+	Succeeded  int
+	Cloned     []string
+	CheckedOut []string // Repos with a changed sparse checkout
+	Removed    []string // Remote branches deleted, as repo:branch
+	PRs        []summaryEntry
+	Released   []summaryEntry // Release URLs
+	Held       []summaryEntry // Update steps held back by hold_go and skip_steps
+	Flagged    []summaryEntry // Large updates opened as drafts for manual review
+	Skipped    []summaryEntry
+	Failed     []summaryEntry
 }
 
-func (cmd *fixCmd) createPR(repoDir, defaultBranch, branchName, commitMsg, prBody string) error {
-	if err := gitRun(repoDir, "checkout", "-b", branchName); err != nil {
-		return fmt.Errorf("failed to create branch: %w", err)
+type summaryEntry struct {
+	Repo   string
+	Detail string // PR or release URL, reason for skipping, or error
+}
+
+func (s *runSummary) addPR(repo, url string) {
+	s.PRs = append(s.PRs, summaryEntry{Repo: repo, Detail: url})
+}
+
+func (s *runSummary) print(total int) {
+	printSection("Summary")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Repos\t%d\t%d succeeded, %d skipped, %d failed\n", total, s.Succeeded, len(s.Skipped), len(s.Failed))
+	printList := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s\t%d\t\n", title, len(items))
+		for _, item := range items {
+			fmt.Fprintf(w, "\t\t%s\n", item)
+		}
+	}
+	printEntries := func(title string, entries []summaryEntry) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s\t%d\t\n", title, len(entries))
+		for _, e := range entries {
+			fmt.Fprintf(w, "\t\t%s\t%s\n", e.Repo, e.Detail)
+		}
 	}
+	printList("Cloned", s.Cloned)
+	printList("Checked out", s.CheckedOut)
+	printList("Removed", s.Removed)
+	printEntries("PRs created", s.PRs)
+	printEntries("Released", s.Released)
+	printEntries("Held back", s.Held)
+	printEntries("Needs review", s.Flagged)
+	printEntries("Skipped", s.Skipped)
+	printEntries("Failed", s.Failed)
+	w.Flush()
 
-	if err := gitRun(repoDir, "add", "-A"); err != nil {
-		return fmt.Errorf("failed to stage changes: %w", err)
+	for _, f := range s.Flagged {
+		addStepSummary(fmt.Sprintf("- **Needs review:** %s: %s", f.Repo, f.Detail))
+	}
+	for _, f := range s.Failed {
+		addStepSummary(fmt.Sprintf("- **Failed:** %s: %s", f.Repo, f.Detail))
+	}
+}
+
+// forEachRepo runs fn for each repo, keeping track of the progress,
+// collecting the outcomes in summary and printing it at the end. It stops at
+// the first error unless keepGoing is set, in which case it goes on with the
+// other repos and returns an error at the end if any failed.
+func forEachRepo(repos []repo, keepGoing bool, summary *runSummary, fn func(repo) error) error {
+	defer restoreDefaultIdentity()
+	defer printTimings()
+	defer summary.print(len(repos))
+	defer clearProgress()
+	for i, r := range repos {
+		setProgress(i+1, len(repos), r.Path)
+		start := time.Now()
+		err := fn(r)
+		endStepTiming()
+		timings.repos = append(timings.repos, timing{Repo: r.Path, Duration: time.Since(start)})
+		switch {
+		case err == nil:
+			summary.Succeeded++
+		case isSkipped(err):
+			summary.Skipped = append(summary.Skipped, summaryEntry{Repo: r.Path, Detail: err.Error()})
+		default:
+			detail := strings.TrimPrefix(err.Error(), r.Path+": ")
+			summary.Failed = append(summary.Failed, summaryEntry{Repo: r.Path, Detail: detail})
+			if !keepGoing {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if n := len(summary.Failed); n > 0 {
+		return fmt.Errorf("%d of %d repos failed", n, len(repos))
+	}
+	return nil
+}
+
+// findRepos returns the repos listed in the gitjoin.txt files below baseDir
+// that are cloned next to their gitjoin.txt file.
+func findRepos(baseDir string) ([]repo, error) {
+	all, err := listRepos(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDirCollisions(all); err != nil {
+		return nil, err
+	}
+
+	var repos []repo
+	for _, r := range all {
+		if !dirExists(r.Dir) {
+			fmt.Printf("Skipping %s: not cloned at %s\n", r.Path, r.Dir)
+			continue
+		}
+		if !isCheckout(r.Dir) {
+			// Git would work on the base repo instead.
+			fmt.Printf("Skipping %s: %s is not a git clone\n", r.Path, r.Dir)
+			continue
+		}
+		repos = append(repos, r)
+	}
+
+	return repos, nil
+}
+
+// listRepos returns all repos listed in the gitjoin.txt files below baseDir,
+// cloned or not.
+func listRepos(baseDir string) ([]repo, error) {
+	files, err := findGitjoinFiles(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []repo
+	seen := map[string]bool{}
+	includes := map[string][]string{}
+	for _, filename := range files {
+		gitjoinDir := filepath.Dir(filename)
+		entries, err := parseListFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+
+		for _, e := range entries {
+			if e.IncludeGroup {
+				from := filepath.Join(gitjoinDir, filepath.FromSlash(e.Section))
+				includes[from] = append(includes[from], e.Text)
+			}
+		}
+
+		for _, e := range withoutExcluded(entries) {
+			repoPath := repoPathFromGitjoinLine(e.Text)
+			if repoPath == "" {
+				continue
+			}
+			repoName := repoNameFromPath(repoPath)
+			if repoName == "" || isBaseRepo(repoPath) {
+				continue
+			}
+			dirName := repoName
+			for _, o := range e.Options {
+				if o.Key == "dir" {
+					dirName = o.Value
+				}
+			}
+			listDir := filepath.Join(gitjoinDir, filepath.FromSlash(e.Section))
+			dir := filepath.Join(listDir, filepath.FromSlash(dirName))
+			if seen[repoPath+"\n"+dir] {
+				// Listed again, e.g. through two includes of the same file.
+				continue
+			}
+			seen[repoPath+"\n"+dir] = true
+			repos = append(repos, repo{
+				Path:    repoPath,
+				Name:    repoName,
+				Dir:     dir,
+				ListDir: listDir,
+				Pos:     e.Pos,
+			})
+		}
+	}
+
+	if len(selectedGroups) > 0 {
+		return reposInGroups(baseDir, repos, includes, selectedGroups)
+	}
+	return repos, nil
+}
+
+// repoFromDir returns the repo cloned in dir, which doesn't need to be listed
+// in a gitjoin.txt file, with the GitHub path taken from its origin remote.
+func repoFromDir(dir string) (repo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return repo{}, err
+	}
+	if !isCheckout(dir) {
+		return repo{}, fmt.Errorf("%s is not a git checkout", dir)
+	}
+	url, err := gitOutput(dir, "config", "--get", "remote.origin.url")
+	if err != nil {
+		return repo{}, fmt.Errorf("%s: failed to get the origin remote: %w", dir, err)
+	}
+	repoPath := repoPathFromRemoteURL(strings.TrimSpace(url))
+	if repoPath == "" {
+		return repo{}, fmt.Errorf("%s: origin %s is not a GitHub repo", dir, strings.TrimSpace(url))
+	}
+	return repo{
+		Path:    repoPath,
+		Name:    repoNameFromPath(repoPath),
+		Dir:     dir,
+		ListDir: filepath.Dir(dir),
+	}, nil
+}
+
+// repoPathFromRemoteURL extracts the GitHub repo path from a remote URL, e.g.
+// "git@github.com:bep/firstupdotenv.git" or
+// "https://github.com/bep/firstupdotenv" -> "bep/firstupdotenv".
+func repoPathFromRemoteURL(url string) string {
+	host := githubHost()
+	for _, prefix := range []string{"git@" + host + ":", "ssh://git@" + host + "/", "https://" + host + "/"} {
+		if rest, ok := strings.CutPrefix(url, prefix); ok {
+			return repoPathFromGitjoinLine(strings.TrimSuffix(strings.TrimSuffix(rest, "/"), ".git"))
+		}
+	}
+	return ""
+}
+
+// dirCollisions describes the repos that would be cloned into the same
+// directory as another repo, also when the names only differ in case, which
+// collide on case-insensitive file systems (macOS, Windows).
+func dirCollisions(repos []repo) []string {
+	var collisions []string
+	seen := map[string]repo{}
+	for _, r := range repos {
+		key := strings.ToLower(r.Dir)
+		other, ok := seen[key]
+		if !ok {
+			seen[key] = r
+			continue
+		}
+		if other.Path == r.Path {
+			// A duplicate entry, reported by validate.
+			continue
+		}
+		collisions = append(collisions, fmt.Sprintf("%s: %s and %s (%s) would be cloned into the same directory %s; add dir=<path> to one of them", r.Pos, r.Path, other.Path, other.Pos, r.Dir))
 	}
+	return collisions
+}
 
-	if err := gitRun(repoDir, "commit", "-m", commitMsg); err != nil {
-		return fmt.Errorf("failed to commit: %w", err)
+// checkDirCollisions fails if two of repos would be cloned into the same
+// directory.
+func checkDirCollisions(repos []repo) error {
+	if collisions := dirCollisions(repos); len(collisions) > 0 {
+		return errors.New(collisions[0])
 	}
+	return nil
+}
 
-	fmt.Printf("Pushing branch %s...\n", branchName)
-	if err := gitRun(repoDir, "push", "-u", "origin", branchName); err != nil {
-		return fmt.Errorf("failed to push: %w", err)
+// findGitjoinFiles returns the paths of all gitjoin.txt files below baseDir.
+func findGitjoinFiles(baseDir string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip .git directories and our own work dirs
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == stateDirName) {
+			return filepath.SkipDir
+		}
+
+		if d.Name() == "gitjoin.txt" {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// prepareCheckout makes sure the checkout of repo is clean and on an up to
+// date defaultBranch.
+func prepareCheckout(repo repo, defaultBranch, pullStrategy string) error {
+	// Check for uncommitted changes
+	if dirty, status, err := checkUncommitted(repo.Dir); err != nil {
+		return err
+	} else if dirty {
+		return fmt.Errorf("repo %s has uncommitted changes:\n%s\nPlease commit or stash your changes", repo.Path, status)
+	}
+
+	currentBranch, err := gitRead.currentBranch(repo.Dir)
+	if err != nil {
+		return fmt.Errorf("%s: failed to get current branch: %w", repo.Path, err)
 	}
 
-	fmt.Println("Creating PR...")
-	if err := createPR(repoDir, commitMsg, prBody); err != nil {
-		return fmt.Errorf("failed to create PR: %w", err)
+	if currentBranch != defaultBranch {
+		fmt.Printf("Switching to %s...\n", defaultBranch)
+		if err := gitRun(repo.Dir, "checkout", defaultBranch); err != nil {
+			return fmt.Errorf("%s: failed to checkout %s: %w", repo.Path, defaultBranch, err)
+		}
 	}
 
-	if err := gitRun(repoDir, "checkout", defaultBranch); err != nil {
-		return fmt.Errorf("failed to checkout %s: %w", defaultBranch, err)
+	// Pull latest
+	if err := gitPull(repo.Dir, pullStrategy); err != nil {
+		return fmt.Errorf("%s: failed to pull: %w", repo.Path, err)
 	}
 
 	return nil
 }
 
-// --- Helpers ---
-
 // repoPathFromGitjoinLine extracts the GitHub repo path from a gitjoin.txt line.
 // Input: "github.com/bep/firstupdotenv" -> Output: "bep/firstupdotenv"
 func repoPathFromGitjoinLine(line string) string {
@@ -621,22 +1610,73 @@ func repoNameFromPath(repoPath string) string {
 	return parts[1]
 }
 
+// defaultBranches caches getDefaultBranch by repo directory.
+var defaultBranches sync.Map
+
+// getDefaultBranch returns the default branch of origin from origin/HEAD. Old
+// clones may lack origin/HEAD, in which case it is set from the remote with
+// git remote set-head, or from the default branch GitHub reports if git
+// can't tell. The branch is kept in the state file until origin/HEAD changes.
 func getDefaultBranch(repoDir string) (string, error) {
-	output, err := gitOutput(repoDir, "symbolic-ref", "refs/remotes/origin/HEAD")
-	if err == nil {
-		branch := strings.TrimSpace(output)
-		branch = strings.TrimPrefix(branch, "refs/remotes/origin/")
-		return branch, nil
+	if branch, ok := defaultBranches.Load(repoDir); ok {
+		return branch.(string), nil
+	}
+	if s := loadRepoState(repoDir); s.DefaultBranch != "" && s.OriginHEAD != "" && s.OriginHEAD == originHEADStamp(repoDir) {
+		defaultBranches.Store(repoDir, s.DefaultBranch)
+		return s.DefaultBranch, nil
 	}
 
-	if _, err := gitOutput(repoDir, "rev-parse", "--verify", "main"); err == nil {
-		return "main", nil
+	ref, err := gitRead.symbolicRef(repoDir, "refs/remotes/origin/HEAD")
+	if err != nil {
+		fmt.Printf("origin/HEAD is not set in %s, setting it from the remote\n", repoDir)
+		if err := gitRun(repoDir, "remote", "set-head", "origin", "--auto"); err != nil {
+			branch, apiErr := defaultBranchFromGitHub(repoDir)
+			if apiErr != nil {
+				return "", fmt.Errorf("failed to set origin/HEAD: %w (and from GitHub: %w)", err, apiErr)
+			}
+			// set-head needs origin/<branch>, which a single branch clone
+			// may lack; the branch is still right, it's just not kept.
+			if err := gitRun(repoDir, "remote", "set-head", "origin", branch); err != nil {
+				fmt.Printf("Failed to set origin/HEAD to %s: %v\n", branch, err)
+			}
+			ref = "refs/remotes/origin/" + branch
+		} else if ref, err = gitRead.symbolicRef(repoDir, "refs/remotes/origin/HEAD"); err != nil {
+			return "", err
+		}
 	}
-	if _, err := gitOutput(repoDir, "rev-parse", "--verify", "master"); err == nil {
-		return "master", nil
+
+	branch := strings.TrimPrefix(ref, "refs/remotes/origin/")
+	defaultBranches.Store(repoDir, branch)
+	if stamp := originHEADStamp(repoDir); stamp != "" {
+		updateRepoState(repoDir, func(s *repoState) {
+			s.DefaultBranch, s.OriginHEAD = branch, stamp
+		})
 	}
+	return branch, nil
+}
 
-	return "main", nil
+// defaultBranchFromGitHub returns the default branch GitHub reports for the
+// origin of the clone in repoDir.
+func defaultBranchFromGitHub(repoDir string) (string, error) {
+	url, err := gitOutput(repoDir, "config", "--get", "remote.origin.url")
+	if err != nil {
+		return "", fmt.Errorf("failed to get the origin remote: %w", err)
+	}
+	repoPath := repoPathFromRemoteURL(strings.TrimSpace(url))
+	if repoPath == "" {
+		return "", fmt.Errorf("origin %s is not a GitHub repo", strings.TrimSpace(url))
+	}
+	if err := requireGitHub(); err != nil {
+		return "", err
+	}
+	var r githubRepo
+	if err := githubAPI("repos/"+repoPath, &r); err != nil {
+		return "", err
+	}
+	if r.DefaultBranch == "" {
+		return "", fmt.Errorf("no default branch for %s", repoPath)
+	}
+	return r.DefaultBranch, nil
 }
 
 func runningGoVersion() (string, error) {
@@ -649,18 +1689,63 @@ func runningGoVersion() (string, error) {
 	return parts[0] + "." + parts[1], nil
 }
 
-func prevGoVersion(version string) string {
-	parts := strings.Split(version, ".")
-	if len(parts) != 2 {
-		return version
+// parseGoVersions parses a --go-version value: either a comma separated
+// matrix (e.g. "1.25,1.26,tip") or a single version, which is paired with
+// its previous version.
+func parseGoVersions(s string) ([]string, error) {
+	var versions []string
+	for v := range strings.SplitSeq(s, ",") {
+		if v = strings.TrimSuffix(strings.TrimSpace(v), ".x"); v != "" {
+			versions = append(versions, v)
+		}
+	}
+	if err := validateGoMatrix(versions); err != nil {
+		return nil, err
 	}
+	if len(versions) == 1 && versions[0] != "tip" {
+		versions = []string{prevGoVersion(versions[0]), versions[0]}
+	}
+	return versions, nil
+}
 
-	minor, err := strconv.Atoi(parts[1])
-	if err != nil || minor <= 0 {
-		return version
+// validateGoMatrix checks the versions of a Go version matrix, which must
+// be Go versions or tip, and not only tip.
+func validateGoMatrix(versions []string) error {
+	if len(versions) == 0 {
+		return errors.New("no Go versions")
+	}
+	onlyTip := true
+	for _, v := range versions {
+		if v == "tip" {
+			continue
+		}
+		onlyTip = false
+		if !goVersionRe.MatchString(v) {
+			return fmt.Errorf("invalid Go version %q, expected e.g. 1.26, 1.27rc1 or tip", v)
+		}
 	}
+	if onlyTip {
+		return errors.New("the Go version matrix needs a Go release besides tip")
+	}
+	return nil
+}
 
-	return fmt.Sprintf("%s.%d", parts[0], minor-1)
+// goVersionRe matches a Go release or pre-release version as used in go.mod,
+// e.g. 1.26, 1.26.1 or 1.27rc1.
+var goVersionRe = regexp.MustCompile(`^\d+\.\d+(\.\d+)?((rc|beta)\d+)?$`)
+
+// goMatrixEntries formats Go versions as used in a go-version matrix. Patch
+// releases and pre-releases (which setup-go understands) are kept as is.
+func goMatrixEntries(versions []string) []string {
+	entries := make([]string, len(versions))
+	for i, v := range versions {
+		if v == "tip" || strings.Count(v, ".") > 1 || strings.ContainsAny(v, "rb") {
+			entries[i] = v
+		} else {
+			entries[i] = v + ".x"
+		}
+	}
+	return entries
 }
 
 func branchExistsRemote(repoDir, branch string) bool {
@@ -671,16 +1756,140 @@ func branchExistsRemote(repoDir, branch string) bool {
 	return strings.TrimSpace(output) != ""
 }
 
-func runGhat(repoDir string) error {
-	return shellRun(repoDir, "ghat swot --stable 7 -d .")
+// runGovulncheck returns the IDs of the vulnerabilities govulncheck finds
+// in code called from the repo.
+func runGovulncheck(repoDir string) ([]string, error) {
+	cmd, done := newCommand(context.Background(), "go", "run", "golang.org/x/vuln/cmd/govulncheck@latest", "-format", "json", "./...")
+	cmd.Dir = repoDir
+	cmd.Stderr = os.Stderr
+	rec := startExec(cmd)
+	output, err := cmd.Output()
+	rec.finish(err)
+	if err := done(err); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var msg struct {
+			Finding *struct {
+				OSV   string `json:"osv"`
+				Trace []struct {
+					Function string `json:"function"`
+				} `json:"trace"`
+			} `json:"finding"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		// Only count vulnerable functions actually called, like govulncheck's text output.
+		f := msg.Finding
+		if f == nil || len(f.Trace) == 0 || f.Trace[0].Function == "" {
+			continue
+		}
+		if !slices.Contains(ids, f.OSV) {
+			ids = append(ids, f.OSV)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// vulnSummary returns the govulncheck part of the PR body.
+func vulnSummary(result updateResult) string {
+	if !result.VulnCheck {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nVulnerabilities (govulncheck):")
+	fmt.Fprintf(&b, "\n- Fixed: %d", len(result.VulnsFixed))
+	if len(result.VulnsFixed) > 0 {
+		b.WriteString(" (" + strings.Join(result.VulnsFixed, ", ") + ")")
+	}
+	fmt.Fprintf(&b, "\n- Remaining: %d", len(result.VulnsRemaining))
+	if len(result.VulnsRemaining) > 0 {
+		b.WriteString(" (" + strings.Join(result.VulnsRemaining, ", ") + ")")
+	}
+	return b.String()
 }
 
 func goRun(dir string, args ...string) error {
-	cmd := exec.Command("go", args...)
+	return goRunContext(context.Background(), dir, args...)
+}
+
+func goRunContext(ctx context.Context, dir string, args ...string) error {
+	cmd, done := newCommand(ctx, "go", args...)
 	cmd.Dir = dir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return done(runTraced(cmd))
+}
+
+// goModJSON is the go.mod of a module as printed by go mod edit -json.
+type goModJSON struct {
+	Module struct {
+		Path string
+	}
+	Go      string
+	Require []struct {
+		Path     string
+		Version  string
+		Indirect bool
+	}
+}
+
+// readGoMod reads the go.mod in repoDir.
+func readGoMod(repoDir string) (goModJSON, error) {
+	var mod goModJSON
+	cmd, done := newCommand(context.Background(), "go", "mod", "edit", "-json", filepath.Join(repoDir, "go.mod"))
+	rec := startExec(cmd)
+	out, err := cmd.Output()
+	rec.finish(err)
+	if err := done(err); err != nil {
+		return mod, fmt.Errorf("failed to read go.mod: %w", err)
+	}
+	if err := json.Unmarshal(out, &mod); err != nil {
+		return mod, fmt.Errorf("failed to parse go.mod: %w", err)
+	}
+	return mod, nil
+}
+
+// setGoPrivate adds the repos that are private on GitHub to GOPRIVATE for the
+// go commands we run, so private cross-dependencies resolve without going
+// through the module proxy and checksum database.
+func setGoPrivate(repos []repo) error {
+	private, err := githubAPIList[githubRepo]("user/repos?visibility=private&per_page=100")
+	if err != nil {
+		return err
+	}
+
+	isPrivate := map[string]bool{}
+	for _, r := range private {
+		isPrivate[strings.ToLower(r.FullName)] = true
+	}
+
+	var patterns []string
+	if existing := os.Getenv("GOPRIVATE"); existing != "" {
+		patterns = append(patterns, existing)
+	}
+	var added int
+	for _, r := range repos {
+		if isPrivate[strings.ToLower(r.Path)] {
+			patterns = append(patterns, "github.com/"+r.Path)
+			added++
+		}
+	}
+
+	if added == 0 {
+		return nil
+	}
+
+	fmt.Printf("Adding %d private repo(s) to GOPRIVATE\n", added)
+	return os.Setenv("GOPRIVATE", strings.Join(patterns, ","))
 }
 
 func goModChanged(repoDir string) bool {
@@ -691,14 +1900,110 @@ func goModChanged(repoDir string) bool {
 	return strings.TrimSpace(output) != ""
 }
 
-func testYmlChanged(repoDir string) bool {
-	output, err := gitOutput(repoDir, "status", "--porcelain", ".github/workflows/test.yml")
+// generatedFiles returns the changed files in repoDir other than go.mod,
+// go.sum and the workflows, i.e. what go generate changed.
+func generatedFiles(repoDir string) []string {
+	output, err := gitOutput(repoDir, "status", "--porcelain", "--", ".", ":!go.mod", ":!go.sum", ":!.github/workflows")
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for line := range strings.Lines(output) {
+		if len(line) > 3 {
+			files = append(files, strings.TrimSpace(line[3:]))
+		}
+	}
+	return files
+}
+
+// missingGenerators returns the commands run by //go:generate directives in
+// repoDir that are not installed. Generators run with go run are fetched by
+// the go command and always available.
+func missingGenerators(repoDir string) []string {
+	var missing []string
+	filepath.WalkDir(repoDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != repoDir && (strings.HasPrefix(d.Name(), ".") || d.Name() == "vendor" || d.Name() == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		for line := range strings.Lines(string(content)) {
+			directive, ok := strings.CutPrefix(line, "//go:generate ")
+			if !ok {
+				continue
+			}
+			fields := strings.Fields(directive)
+			if len(fields) == 0 || fields[0] == "go" || strings.HasPrefix(fields[0], "$") {
+				continue
+			}
+			if _, err := exec.LookPath(fields[0]); err != nil && !slices.Contains(missing, fields[0]) {
+				missing = append(missing, fields[0])
+			}
+		}
+		return nil
+	})
+	return missing
+}
+
+func workflowsChanged(repoDir string) bool {
+	output, err := gitOutput(repoDir, "status", "--porcelain", ".github/workflows")
 	if err != nil {
 		return false
 	}
 	return strings.TrimSpace(output) != ""
 }
 
+// workflowPatterns are the globs of the files in .github/workflows to treat
+// as workflows, from workflow_files in the config.
+var workflowPatterns = []string{"*.yml", "*.yaml"}
+
+// isWorkflowFile reports whether name, a file in .github/workflows, matches
+// one of the workflowPatterns, ignoring case (e.g. Test.YML, ci.yaml).
+func isWorkflowFile(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range workflowPatterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// workflowFiles returns the names of the workflow files in .github/workflows.
+func workflowFiles(repoDir string) []string {
+	entries, err := os.ReadDir(filepath.Join(repoDir, ".github", "workflows"))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && isWorkflowFile(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// readWorkflows returns the content of all workflow files keyed by name.
+func readWorkflows(repoDir string) map[string]string {
+	workflows := map[string]string{}
+	for _, name := range workflowFiles(repoDir) {
+		workflows[name] = readFileOrEmpty(filepath.Join(repoDir, ".github", "workflows", name))
+	}
+	return workflows
+}
+
 func readFileOrEmpty(filename string) string {
 	b, err := os.ReadFile(filename)
 	if err != nil {
@@ -707,57 +2012,295 @@ func readFileOrEmpty(filename string) string {
 	return string(b)
 }
 
-func createPR(repoDir, title, body string) error {
-	// Escape single quotes in title and body for shell
-	escapedTitle := strings.ReplaceAll(title, "'", "'\"'\"'")
-	escapedBody := strings.ReplaceAll(body, "'", "'\"'\"'")
-	return shellRun(repoDir, fmt.Sprintf("gh pr create --title '%s' --body '%s'", escapedTitle, escapedBody))
+// prChange is a PR to open with the changes in a checkout.
+type prChange struct {
+	Base   string // The default branch
+	Branch string // The branch to commit to and push
+	Title  string // The commit message and PR title
+	Body   string
+
+	Options   prOptions
+	ReviewWeb bool // Open the pushed branch in the browser instead of creating the PR
+	Worktree  bool // The checkout is a temporary worktree
+}
+
+// commitAndCreatePR commits all changes in repo to a new branch, pushes it,
+// creates the PR (or opens it for review in the browser with review_web) and
+// leaves the branch as local_branch says. It returns the URL of the PR.
+func (cfg *config) commitAndCreatePR(repo repo, c prChange) (string, error) {
+	repoDir := repo.Dir
+	if err := gitRun(repoDir, "checkout", "-b", c.Branch); err != nil {
+		return "", fmt.Errorf("failed to create branch: %w", err)
+	}
+
+	if err := gitRun(repoDir, "add", "-A"); err != nil {
+		return "", fmt.Errorf("failed to stage changes: %w", err)
+	}
+
+	if err := gitRun(repoDir, cfg.gitCommitArgs("commit", "-m", c.Title)...); err != nil {
+		return "", fmt.Errorf("failed to commit: %w", err)
+	}
+
+	head, err := cfg.pushBranch(repo, c.Branch)
+	if err != nil {
+		return "", err
+	}
+
+	var url string
+	if c.ReviewWeb {
+		fmt.Println("Opening in the browser for review...")
+		url, err = openPRInBrowser(repoDir, repo.Path, c.Base, head, c.Title, c.Body)
+	} else {
+		fmt.Println("Creating PR...")
+		url, err = createPR(repoDir, repo.Path, c.Base, head, c.Title, c.Body, c.Options)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create PR: %w", err)
+	}
+
+	if err := cfg.leaveBranch(repo, c.Branch, c.Base, c.Worktree); err != nil {
+		return "", err
+	}
+
+	return url, nil
+}
+
+// prOptions is the metadata applied to a PR when it's created.
+type prOptions struct {
+	Labels    []string
+	Reviewers []string // Users or teams (org/team)
+	Assignees []string
+	Milestone string // Title
+	Draft     bool
+	AutoMerge bool // Enable auto-merge (squash), not possible for drafts
+}
+
+// createPR opens a PR for the pushed head branch against base, using gh if
+// installed and the GitHub REST API otherwise, and returns its URL.
+func createPR(repoDir, repoPath, base, head, title, body string, opts prOptions) (string, error) {
+	if !hasGh() {
+		var pr struct {
+			Number  int    `json:"number"`
+			NodeID  string `json:"node_id"`
+			HTMLURL string `json:"html_url"`
+		}
+		req := map[string]any{"title": title, "body": body, "head": head, "base": base, "draft": opts.Draft}
+		if err := githubRequest("POST", "repos/"+repoPath+"/pulls", req, &pr); err != nil {
+			return "", err
+		}
+		fmt.Println(pr.HTMLURL)
+		if err := applyPROptions(repoPath, pr.Number, opts); err != nil {
+			return pr.HTMLURL, fmt.Errorf("created %s, but %w", pr.HTMLURL, err)
+		}
+		if opts.AutoMerge && !opts.Draft {
+			if err := enableAutoMerge(pr.NodeID); err != nil {
+				return pr.HTMLURL, fmt.Errorf("created %s, but failed to enable auto-merge: %w", pr.HTMLURL, err)
+			}
+		}
+		return pr.HTMLURL, nil
+	}
+
+	// --repo as the repo may have a fork remote too, and head is "<owner>:<branch>"
+	// for cross-fork PRs.
+	command := fmt.Sprintf("gh pr create --repo %s --base %s --head %s --title %s --body %s", shellQuote(repoPath), shellQuote(base), shellQuote(head), shellQuote(title), shellQuote(body))
+	for _, label := range opts.Labels {
+		command += " --label " + shellQuote(label)
+	}
+	for _, reviewer := range opts.Reviewers {
+		command += " --reviewer " + shellQuote(reviewer)
+	}
+	for _, assignee := range opts.Assignees {
+		command += " --assignee " + shellQuote(assignee)
+	}
+	if opts.Milestone != "" {
+		command += " --milestone " + shellQuote(opts.Milestone)
+	}
+	if opts.Draft {
+		command += " --draft"
+	}
+	output, err := shellRunOutput(repoDir, command)
+	if err != nil {
+		return "", err
+	}
+	// gh prints the URL of the PR last.
+	var url string
+	if fields := strings.Fields(output); len(fields) > 0 {
+		url = fields[len(fields)-1]
+	}
+	if opts.AutoMerge && !opts.Draft {
+		if err := shellRun(repoDir, "gh pr merge --auto --squash "+shellQuote(cmp.Or(url, head))); err != nil {
+			return url, fmt.Errorf("failed to enable auto-merge: %w", err)
+		}
+	}
+	return url, nil
+}
+
+// openPRInBrowser opens the PR form for the pushed head branch in the
+// browser so the PR can be finished by hand, using gh if installed and
+// GitHub's compare view otherwise, and returns the compare URL.
+func openPRInBrowser(repoDir, repoPath, base, head, title, body string) (string, error) {
+	compareURL := githubWebURL(fmt.Sprintf("%s/compare/%s...%s", repoPath, base, head))
+	if hasGh() {
+		command := fmt.Sprintf("gh pr create --web --repo %s --base %s --head %s --title %s --body %s", shellQuote(repoPath), shellQuote(base), shellQuote(head), shellQuote(title), shellQuote(body))
+		return compareURL, shellRun(repoDir, command)
+	}
+
+	q := url.Values{"expand": {"1"}, "title": {title}, "body": {body}}
+	fmt.Println(compareURL)
+	return compareURL, openURL(compareURL + "?" + q.Encode())
+}
+
+// openURL opens u in the default browser, without waiting for the opener
+// to exit.
+func openURL(u string) error {
+	name, args := "xdg-open", []string{u}
+	switch runtime.GOOS {
+	case "darwin":
+		name = "open"
+	case "windows":
+		name, args = "rundll32", []string{"url.dll,FileProtocolHandler", u}
+	}
+	cmd, done := newCommand(context.Background(), name, args...)
+	rec := startExec(cmd)
+	if err := cmd.Start(); err != nil {
+		rec.finish(err)
+		return done(err)
+	}
+	go func() {
+		err := cmd.Wait()
+		rec.finish(err)
+		done(err)
+	}()
+	return nil
+}
+
+// enableAutoMerge enables squash auto-merge on the PR with the given GraphQL
+// node ID. This is only in the GraphQL API.
+func enableAutoMerge(prNodeID string) error {
+	req := map[string]any{
+		"query": `mutation($id: ID!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: SQUASH}) { clientMutationId }
+}`,
+		"variables": map[string]string{"id": prNodeID},
+	}
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := githubRequest("POST", "graphql", req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return errors.New(resp.Errors[0].Message)
+	}
+	return nil
+}
+
+// applyPROptions sets the labels, reviewers, assignees and milestone of the
+// PR with the given number using the REST API.
+func applyPROptions(repoPath string, number int, opts prOptions) error {
+	issue := fmt.Sprintf("repos/%s/issues/%d", repoPath, number)
+
+	if len(opts.Labels) > 0 {
+		if err := githubRequest("POST", issue+"/labels", map[string][]string{"labels": opts.Labels}, nil); err != nil {
+			return fmt.Errorf("failed to add labels: %w", err)
+		}
+	}
+
+	if len(opts.Assignees) > 0 {
+		if err := githubRequest("POST", issue+"/assignees", map[string][]string{"assignees": opts.Assignees}, nil); err != nil {
+			return fmt.Errorf("failed to add assignees: %w", err)
+		}
+	}
+
+	if len(opts.Reviewers) > 0 {
+		req := map[string][]string{"reviewers": {}, "team_reviewers": {}}
+		for _, r := range opts.Reviewers {
+			if _, team, ok := strings.Cut(r, "/"); ok {
+				req["team_reviewers"] = append(req["team_reviewers"], team)
+			} else {
+				req["reviewers"] = append(req["reviewers"], r)
+			}
+		}
+		if err := githubRequest("POST", fmt.Sprintf("repos/%s/pulls/%d/requested_reviewers", repoPath, number), req, nil); err != nil {
+			return fmt.Errorf("failed to request reviewers: %w", err)
+		}
+	}
+
+	if opts.Milestone != "" {
+		var milestones []struct {
+			Number int    `json:"number"`
+			Title  string `json:"title"`
+		}
+		if err := githubAPI("repos/"+repoPath+"/milestones?state=open&per_page=100", &milestones); err != nil {
+			return fmt.Errorf("failed to list milestones: %w", err)
+		}
+		milestone := 0
+		for _, m := range milestones {
+			if m.Title == opts.Milestone {
+				milestone = m.Number
+			}
+		}
+		if milestone == 0 {
+			return fmt.Errorf("no open milestone %q", opts.Milestone)
+		}
+		if err := githubRequest("PATCH", issue, map[string]int{"milestone": milestone}, nil); err != nil {
+			return fmt.Errorf("failed to set milestone: %w", err)
+		}
+	}
+
+	return nil
 }
 
 // --- Git helpers ---
 
 func gitRun(dir string, args ...string) error {
-	cmd := exec.Command("git", args...)
+	cmd, done := newCommand(context.Background(), "git", args...)
 	cmd.Dir = dir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return done(runTraced(cmd))
+}
+
+// gitPull pulls the current branch with --ff-only, never relying on the
+// repo's pull.rebase setting. If the branches have diverged it falls back
+// to strategy, "rebase" or "merge"; the default "ff-only" gives up.
+func gitPull(dir, strategy string) error {
+	err := gitRun(dir, "pull", "--ff-only")
+	if err == nil {
+		return nil
+	}
+
+	switch strategy {
+	case "rebase":
+		fmt.Println("Fast-forward failed, pulling with --rebase...")
+		return gitRun(dir, "pull", "--rebase")
+	case "merge":
+		fmt.Println("Fast-forward failed, pulling with --no-rebase...")
+		return gitRun(dir, "pull", "--no-rebase", "--no-edit")
+	default:
+		return err
+	}
 }
 
 func gitOutput(dir string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+	cmd, done := newCommand(context.Background(), "git", args...)
 	cmd.Dir = dir
+	rec := startExec(cmd)
 	output, err := cmd.Output()
-	return string(output), err
+	rec.finish(err)
+	return string(output), done(err)
 }
 
 func checkUncommitted(repoDir string) (dirty bool, status string, err error) {
-	status, err = gitOutput(repoDir, "status", "--porcelain")
+	status, err = gitRead.status(repoDir)
 	if err != nil {
 		return false, "", fmt.Errorf("failed to check git status in %s: %w", repoDir, err)
 	}
 	return len(status) > 0, status, nil
 }
 
-func readLines(filename string) ([]string, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		lines = append(lines, line)
-	}
-	return lines, scanner.Err()
-}
-
 func dirExists(path string) bool {
 	info, err := os.Stat(path)
 	return err == nil && info.IsDir()
@@ -768,10 +2311,6 @@ func fileExists(path string) bool {
 	return err == nil && !info.IsDir()
 }
 
-func hasTestYml(repoDir string) bool {
-	return fileExists(filepath.Join(repoDir, ".github", "workflows", "test.yml"))
-}
-
 func hasWorkflowsDir(repoDir string) bool {
 	return dirExists(filepath.Join(repoDir, ".github", "workflows"))
 }
@@ -780,11 +2319,96 @@ func hasGoMod(repoDir string) bool {
 	return fileExists(filepath.Join(repoDir, "go.mod"))
 }
 
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt prints question and returns the trimmed line read from stdin.
+func prompt(question string) (string, error) {
+	if botMode {
+		fatalf("Can't ask %q in bot mode; see --yes", question)
+	}
+	fmt.Printf("%s ", question)
+	answer, err := stdin.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return "", errNoAnswer
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// maxPromptTries is how many times a question with fixed answers is asked
+// before giving up on the answers.
+const maxPromptTries = 3
+
+// errNoAnswer is returned by prompt when stdin is closed, e.g. when run
+// without a terminal.
+var errNoAnswer = errors.New("no answer, stdin is closed")
+
+// confirm asks a yes/no question on stdin and reports whether the answer was
+// yes. No answer is no.
+func confirm(question string) bool {
+	answer, _ := prompt(question + " [y/N]")
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes"
+}
+
 func fatalf(format string, args ...any) {
+	endSection()
 	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	if inGitHubActions {
+		msg := fmt.Sprintf(format, args...)
+		fmt.Printf("::error::%s\n", escapeWorkflowCommand(msg))
+		addStepSummary("**Failed:** " + msg)
+	}
+	runExitHandlers()
 	os.Exit(1)
 }
 
+var exitHandlers struct {
+	sync.Mutex
+	next int
+	fns  map[int]func()
+}
+
+// onExit registers fn to be run if the program is interrupted or exits
+// through fatalf. The returned func unregisters it.
+func onExit(fn func()) (unregister func()) {
+	exitHandlers.Lock()
+	defer exitHandlers.Unlock()
+	if exitHandlers.fns == nil {
+		exitHandlers.fns = map[int]func(){}
+	}
+	id := exitHandlers.next
+	exitHandlers.next++
+	exitHandlers.fns[id] = fn
+	return func() {
+		exitHandlers.Lock()
+		defer exitHandlers.Unlock()
+		delete(exitHandlers.fns, id)
+	}
+}
+
+func runExitHandlers() {
+	exitHandlers.Lock()
+	fns := exitHandlers.fns
+	exitHandlers.fns = nil
+	exitHandlers.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// handleInterrupts runs the exit handlers before exiting on SIGINT/SIGTERM.
+func handleInterrupts() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		fmt.Fprintln(os.Stderr, "Interrupted, cleaning up...")
+		runExitHandlers()
+		os.Exit(130)
+	}()
+}
+
 // --- Shell helpers (for alias support) ---
 
 func getShell() string {
@@ -794,17 +2418,35 @@ func getShell() string {
 	return "bash"
 }
 
+// shellFlags returns the flags to run a command with the user's shell,
+// interactive to get the aliases unless in bot mode.
+func shellFlags() string {
+	if botMode {
+		return "-c"
+	}
+	return "-ic"
+}
+
 func shellCommandExists(command string) error {
-	shell := getShell()
-	cmd := exec.Command(shell, "-ic", "command -v "+command)
-	return cmd.Run()
+	cmd, done := newCommand(context.Background(), getShell(), shellFlags(), "command -v "+command)
+	return done(cmd.Run())
+}
+
+// shellRunOutput is shellRun that also returns the standard output.
+func shellRunOutput(dir, command string) (string, error) {
+	var buf bytes.Buffer
+	cmd, done := newCommand(context.Background(), getShell(), shellFlags(), command)
+	cmd.Dir = dir
+	cmd.Stdout = io.MultiWriter(os.Stdout, &buf)
+	cmd.Stderr = os.Stderr
+	err := done(runTraced(cmd))
+	return buf.String(), err
 }
 
 func shellRun(dir, command string) error {
-	shell := getShell()
-	cmd := exec.Command(shell, "-ic", command)
+	cmd, done := newCommand(context.Background(), getShell(), shellFlags(), command)
 	cmd.Dir = dir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return done(runTraced(cmd))
 }
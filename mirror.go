@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// --- Mirror command ---
+
+// mirrorCmd keeps bare mirror clones of all the repos in the gitjoin.txt
+// files, cloned or not, in Dest as <owner>/<name>.git, as an offline backup.
+type mirrorCmd struct {
+	BaseDir   string
+	Config    *config
+	Dest      string
+	Try       bool
+	KeepGoing bool // Go on with the other repos when one fails
+	Pick      bool // Interactively pick the repos to work on
+
+	summary runSummary
+}
+
+func (cmd *mirrorCmd) Run() error {
+	if cmd.Dest == "" {
+		return errors.New("mirror requires --dest <dir>")
+	}
+	dest, err := filepath.Abs(cmd.Dest)
+	if err != nil {
+		return err
+	}
+
+	repos, err := listRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	fmt.Printf("Mirroring %d repos into %s\n", len(repos), dest)
+	return forEachRepo(repos, cmd.KeepGoing, &cmd.summary, func(repo repo) error {
+		return cmd.mirrorRepo(repo, filepath.Join(dest, filepath.FromSlash(repo.Path)+".git"))
+	})
+}
+
+func (cmd *mirrorCmd) mirrorRepo(repo repo, dir string) error {
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	url := cmd.Config.cloneURL(repo.Path)
+
+	if !dirExists(dir) {
+		if cmd.Try {
+			fmt.Printf("[dry-run] Would create a mirror of %s in %s\n", repo.Path, dir)
+			return nil
+		}
+		fmt.Printf("%sCreating a mirror of %s...\n", progressPrefix(), repo.Path)
+		if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		}
+		if err := gitRun(filepath.Dir(dir), "clone", "--mirror", url, filepath.Base(dir)); err != nil {
+			return fmt.Errorf("%s: failed to clone: %w", repo.Path, err)
+		}
+		cmd.summary.Cloned = append(cmd.summary.Cloned, repo.Path)
+		return nil
+	}
+
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would update the mirror of %s\n", repo.Path)
+		return nil
+	}
+	fmt.Printf("%sUpdating the mirror of %s...\n", progressPrefix(), repo.Path)
+	if err := setRemote(dir, "origin", url); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	if err := gitRun(dir, "remote", "update", "--prune"); err != nil {
+		return fmt.Errorf("%s: failed to update: %w", repo.Path, err)
+	}
+	return nil
+}
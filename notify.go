@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// notifyPayload is what notify_webhook receives at the end of a run.
+type notifyPayload struct {
+	Command   string        `json:"command"`
+	RunID     string        `json:"run_id"`
+	Text      string        `json:"text"`
+	Succeeded int           `json:"succeeded"`
+	PRs       []notifyEntry `json:"prs"`
+	Skipped   []notifyEntry `json:"skipped"`
+	Failed    []notifyEntry `json:"failed"`
+}
+
+type notifyEntry struct {
+	Repo   string `json:"repo"`
+	Detail string `json:"detail"`
+}
+
+func notifyEntries(entries []summaryEntry) []notifyEntry {
+	out := []notifyEntry{}
+	for _, e := range entries {
+		out = append(out, notifyEntry{Repo: e.Repo, Detail: e.Detail})
+	}
+	return out
+}
+
+// notifyRun sends the summary of a run of command to the notify_slack and
+// notify_webhook URLs and as a desktop notification with notify_desktop.
+// Dry runs are not announced. Failing to notify is reported, not an error.
+func (cfg *config) notifyRun(command, runID string, try bool, s *runSummary) {
+	if try || cfg.NotifySlack == "" && cfg.NotifyWebhook == "" && !cfg.NotifyDesktop {
+		return
+	}
+
+	title := fmt.Sprintf("mygithelper %s finished", command)
+	summary := fmt.Sprintf("%d succeeded, %d skipped, %d failed, %d PR(s) created", s.Succeeded, len(s.Skipped), len(s.Failed), len(s.PRs))
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (run %s): %s", title, runID, summary)
+	for _, pr := range s.PRs {
+		fmt.Fprintf(&b, "\n- %s %s", pr.Repo, pr.Detail)
+	}
+	for _, f := range s.Failed {
+		fmt.Fprintf(&b, "\n- Failed: %s: %s", f.Repo, f.Detail)
+	}
+	text := b.String()
+
+	if url := os.ExpandEnv(cfg.NotifySlack); url != "" {
+		if err := postJSON(url, map[string]string{"text": text}); err != nil {
+			fmt.Printf("Failed to notify Slack: %v\n", err)
+		}
+	}
+	if url := os.ExpandEnv(cfg.NotifyWebhook); url != "" {
+		payload := notifyPayload{
+			Command:   command,
+			RunID:     runID,
+			Text:      text,
+			Succeeded: s.Succeeded,
+			PRs:       notifyEntries(s.PRs),
+			Skipped:   notifyEntries(s.Skipped),
+			Failed:    notifyEntries(s.Failed),
+		}
+		if err := postJSON(url, payload); err != nil {
+			fmt.Printf("Failed to notify the webhook: %v\n", err)
+		}
+	}
+	if cfg.NotifyDesktop {
+		if err := notifyDesktop(title, summary); err != nil {
+			fmt.Printf("Failed to show a desktop notification: %v\n", err)
+		}
+	}
+}
+
+// postJSON posts v as JSON to rawURL. Webhook URLs carry their secret in the
+// path, so errors only show the scheme and host.
+func postJSON(rawURL string, v any) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.New("invalid URL")
+	}
+	target := u.Scheme + "://" + u.Host
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(rawURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("POST %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", target, resp.Status)
+	}
+	return nil
+}
+
+// notifyDesktop shows a desktop notification with notify-send on Linux and
+// osascript on macOS.
+func notifyDesktop(title, message string) error {
+	var (
+		cmd  *exec.Cmd
+		done func(error) error
+	)
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		cmd, done = newCommand(context.Background(), "osascript", "-e", script)
+	case "windows":
+		return fmt.Errorf("not supported on %s", runtime.GOOS)
+	default:
+		cmd, done = newCommand(context.Background(), "notify-send", title, message)
+	}
+	rec := startExec(cmd)
+	output, err := cmd.CombinedOutput()
+	rec.finish(err)
+	if err := done(err); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal.
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pickRepos lets the user select some of repos interactively, using fzf if
+// installed.
+func pickRepos(repos []repo) ([]repo, error) {
+	if len(repos) == 0 {
+		return nil, nil
+	}
+
+	labels := make([]string, len(repos))
+	for i, r := range repos {
+		labels[i] = fmt.Sprintf("%-40s %s", r.Path, repoStatus(r))
+	}
+
+	var indexes []int
+	var err error
+	if _, lookErr := exec.LookPath("fzf"); lookErr == nil {
+		indexes, err = pickWithFzf(labels)
+	} else {
+		indexes, err = pickWithPrompt(labels)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	picked := make([]repo, len(indexes))
+	for i, idx := range indexes {
+		picked[i] = repos[idx]
+	}
+	fmt.Printf("Picked %d of %d repos\n", len(picked), len(repos))
+	return picked, nil
+}
+
+// repoStatus returns a short status annotation for the picker.
+func repoStatus(r repo) string {
+	if !dirExists(r.Dir) {
+		return "[not cloned]"
+	}
+	branch, err := gitRead.currentBranch(r.Dir)
+	if err != nil {
+		return "[unknown]"
+	}
+	status := "[" + branch
+	if dirty, _, err := checkUncommitted(r.Dir); err == nil && dirty {
+		status += ", dirty"
+	}
+	return status + "]"
+}
+
+func pickWithFzf(labels []string) ([]int, error) {
+	var input bytes.Buffer
+	for i, label := range labels {
+		// Prefix the index so we can map the selection back; fzf hides it.
+		fmt.Fprintf(&input, "%d\t%s\n", i, label)
+	}
+
+	cmd, done := newCommand(context.Background(), "fzf", "--multi", "--delimiter", "\t", "--with-nth", "2", "--prompt", "repos> ", "--header", "TAB to select, ENTER to confirm")
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	rec := startExec(cmd)
+	output, err := cmd.Output()
+	rec.finish(err)
+	if err := done(err); err != nil {
+		// fzf exits with 1 when nothing matched and 130 when aborted.
+		return nil, fmt.Errorf("no repos picked")
+	}
+
+	var indexes []int
+	for line := range strings.Lines(string(output)) {
+		var idx int
+		if _, err := fmt.Sscanf(line, "%d\t", &idx); err == nil && idx >= 0 && idx < len(labels) {
+			indexes = append(indexes, idx)
+		}
+	}
+	return indexes, nil
+}
+
+func pickWithPrompt(labels []string) ([]int, error) {
+	for {
+		query, err := prompt("Filter repos (fuzzy, empty for all):")
+		if err != nil {
+			return nil, err
+		}
+
+		var matches []int
+		for i, label := range labels {
+			if fuzzyMatch(label, query) {
+				matches = append(matches, i)
+			}
+		}
+		if len(matches) == 0 {
+			fmt.Println("No repos match")
+			continue
+		}
+
+		for i, idx := range matches {
+			fmt.Printf("  %3d  %s\n", i+1, labels[idx])
+		}
+
+		answer, err := prompt("Select repos (e.g. 1,3,5-7 or all, empty to filter again):")
+		if err != nil {
+			return nil, err
+		}
+		selection, err := parseSelection(answer, len(matches))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(selection) == 0 {
+			continue
+		}
+
+		indexes := make([]int, len(selection))
+		for i, s := range selection {
+			indexes[i] = matches[s]
+		}
+		return indexes, nil
+	}
+}
+
+// fuzzyMatch reports whether the characters of query appear in s in order,
+// ignoring case.
+func fuzzyMatch(s, query string) bool {
+	s, query = strings.ToLower(s), strings.ToLower(query)
+	for _, c := range query {
+		i := strings.IndexRune(s, c)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(c)):]
+	}
+	return true
+}
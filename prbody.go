@@ -0,0 +1,343 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// change is a version change in an updated repo.
+type change struct {
+	Name     string // File, module or action
+	Where    string // Workflow file of an action
+	From, To string
+	Indirect bool // For modules
+}
+
+// updateChanges are the changes an update made in a repo compared to HEAD.
+type updateChanges struct {
+	GoVersions  []change // Go version matrices in the workflows
+	GoDirective *change
+	Modules     []change
+	Actions     []change
+}
+
+// collectUpdateChanges compares the Go versions, modules and action pins in
+// repoDir with HEAD.
+func collectUpdateChanges(repoDir string) updateChanges {
+	var c updateChanges
+
+	for _, name := range workflowFiles(repoDir) {
+		filename := ".github/workflows/" + name
+		before := goVersionLists([]byte(gitShow(repoDir, "HEAD", filename)))
+		after := goVersionLists([]byte(readFileOrEmpty(filepath.Join(repoDir, filename))))
+		if len(before) == len(after) {
+			for i := range before {
+				if !slices.Equal(before[i], after[i]) {
+					c.GoVersions = append(c.GoVersions, change{Name: name, From: strings.Join(before[i], ", "), To: strings.Join(after[i], ", ")})
+				}
+			}
+		}
+	}
+
+	oldMod := parseGoMod(gitShow(repoDir, "HEAD", "go.mod"))
+	newMod := parseGoMod(readFileOrEmpty(filepath.Join(repoDir, "go.mod")))
+	if oldMod.Go != newMod.Go && newMod.Go != "" {
+		c.GoDirective = &change{Name: "go.mod", From: oldMod.Go, To: newMod.Go}
+	}
+	for _, mod := range slices.Sorted(maps.Keys(newMod.Require)) {
+		if from, to := oldMod.Require[mod], newMod.Require[mod]; from != to {
+			c.Modules = append(c.Modules, change{Name: mod, From: from, To: to, Indirect: newMod.Indirect[mod]})
+		}
+	}
+	for _, mod := range slices.Sorted(maps.Keys(oldMod.Require)) {
+		if _, ok := newMod.Require[mod]; !ok {
+			c.Modules = append(c.Modules, change{Name: mod, From: oldMod.Require[mod], Indirect: oldMod.Indirect[mod]})
+		}
+	}
+
+	for _, name := range workflowFiles(repoDir) {
+		filename := ".github/workflows/" + name
+		before := actionRefs(gitShow(repoDir, "HEAD", filename))
+		after := actionRefs(readFileOrEmpty(filepath.Join(repoDir, filename)))
+		for _, action := range slices.Sorted(maps.Keys(after)) {
+			if from, to := before[action], after[action]; from != "" && from != to {
+				c.Actions = append(c.Actions, change{Name: action, Where: name, From: from, To: to})
+			}
+		}
+	}
+
+	return c
+}
+
+// defaultLargeUpdateModules is the number of modules an update may change
+// before it's flagged for manual review.
+const defaultLargeUpdateModules = 40
+
+func (cfg *config) largeUpdateModules() int {
+	if cfg.LargeUpdateModules == 0 {
+		return defaultLargeUpdateModules
+	}
+	return cfg.LargeUpdateModules
+}
+
+// largeUpdate returns why the changes are too large to be merged as a routine
+// update, nil if they're not: more than maxModules modules changed (no limit
+// if negative) or modules bumped to a new major version.
+func (c updateChanges) largeUpdate(maxModules int) []string {
+	var reasons []string
+	if maxModules >= 0 && len(c.Modules) > maxModules {
+		reasons = append(reasons, fmt.Sprintf("%d modules changed", len(c.Modules)))
+	}
+
+	var majors []string
+	removed := map[string]int{} // Module path without /vN -> major version
+	for _, m := range c.Modules {
+		if m.To == "" {
+			base, major := splitModuleMajor(m.Name)
+			removed[base] = major
+		}
+	}
+	for _, m := range c.Modules {
+		switch {
+		case m.From != "" && m.To != "":
+			if from, to := semverMajor(m.From), semverMajor(m.To); to > from {
+				majors = append(majors, versionChange(m.Name, m.From, m.To))
+			}
+		case m.From == "":
+			// A new major version of a module lives at a new path, e.g. /v3.
+			base, major := splitModuleMajor(m.Name)
+			if old, ok := removed[base]; ok && major > old {
+				majors = append(majors, m.Name+" "+m.To)
+			}
+		}
+	}
+	if len(majors) > 0 {
+		reasons = append(reasons, "major version changes in "+strings.Join(majors, ", "))
+	}
+	return reasons
+}
+
+// splitModuleMajor splits a module path into the path without the major
+// version suffix and the major version, e.g. "example.com/m/v3" into
+// "example.com/m" and 3.
+func splitModuleMajor(path string) (string, int) {
+	if i := strings.LastIndex(path, "/v"); i > 0 {
+		if n, err := strconv.Atoi(path[i+2:]); err == nil && n >= 2 {
+			return path[:i], n
+		}
+	}
+	if base, ok := strings.CutPrefix(path, "gopkg.in/"); ok {
+		if i := strings.LastIndex(base, ".v"); i > 0 {
+			if n, err := strconv.Atoi(base[i+2:]); err == nil {
+				return "gopkg.in/" + base[:i], n
+			}
+		}
+	}
+	return path, 1
+}
+
+// semverMajor returns the major version of a module version, e.g. 2 for
+// v2.0.0+incompatible, -1 if it's not one.
+func semverMajor(v string) int {
+	major, _, _ := strings.Cut(strings.TrimPrefix(v, "v"), ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// updateCommitMessage returns the commit message (and PR title) for the
+// changes, e.g. "Bump Go 1.25.x/1.26.x in workflows, go directive to 1.25.0,
+// actions/checkout v4.2.2→v5.0.0 (+2 more), golang.org/x/net
+// v0.30.0→v0.33.0 (+12 more)". It falls back to listing updates.
+func updateCommitMessage(c updateChanges, goVersions []string, updates []string, generated bool) string {
+	var parts []string
+	if len(c.GoVersions) > 0 {
+		parts = append(parts, fmt.Sprintf("Go %s in workflows", strings.Join(goVersions, "/")))
+	}
+	if c.GoDirective != nil {
+		parts = append(parts, "go directive to "+c.GoDirective.To)
+	}
+
+	// The same action is usually pinned in more than one workflow.
+	var actions []change
+	for _, a := range c.Actions {
+		if !slices.ContainsFunc(actions, func(b change) bool { return a.Name == b.Name && a.To == b.To }) {
+			actions = append(actions, a)
+		}
+	}
+	if len(actions) > 0 {
+		parts = append(parts, withMore(versionChange(actions[0].Name, shortRef(actions[0].From), shortRef(actions[0].To)), len(actions)-1))
+	}
+
+	// Lead with a direct dependency.
+	modules := slices.Clone(c.Modules)
+	slices.SortStableFunc(modules, func(a, b change) int {
+		switch {
+		case a.Indirect == b.Indirect:
+			return 0
+		case b.Indirect:
+			return -1
+		default:
+			return 1
+		}
+	})
+	if len(modules) > 0 {
+		m := modules[0]
+		s := m.Name + " (removed)"
+		if m.To != "" {
+			s = versionChange(m.Name, m.From, m.To)
+		}
+		parts = append(parts, withMore(s, len(modules)-1))
+	}
+
+	if generated {
+		parts = append(parts, "generated code")
+	}
+
+	if len(parts) == 0 {
+		return "Update " + strings.Join(updates, ", ")
+	}
+	return "Bump " + strings.Join(parts, ", ")
+}
+
+func versionChange(name, from, to string) string {
+	if from == "" {
+		return name + " " + to
+	}
+	return name + " " + from + "→" + to
+}
+
+func withMore(s string, more int) string {
+	if more > 0 {
+		return fmt.Sprintf("%s (+%d more)", s, more)
+	}
+	return s
+}
+
+// shortRef returns the tag of a pinned action ref ("<sha> # v4.2.2"), or the
+// ref itself with SHAs shortened.
+func shortRef(ref string) string {
+	if _, tag, ok := strings.Cut(ref, "# "); ok {
+		return strings.TrimSpace(tag)
+	}
+	if len(ref) == 40 && strings.Trim(ref, "0123456789abcdef") == "" {
+		return ref[:7]
+	}
+	return ref
+}
+
+// updatePRBody returns the Markdown description of an update PR: the Go
+// version, module and action pin changes.
+func updatePRBody(c updateChanges, updates []string, result updateResult, large []string) string {
+	var b strings.Builder
+	if len(large) > 0 {
+		fmt.Fprintf(&b, "> [!WARNING]\n> Not a routine update: %s. Review the changes before marking this ready.\n\n", strings.Join(large, "; "))
+	}
+	b.WriteString("Updates: " + strings.Join(updates, ", "))
+
+	var goRows [][3]string
+	for _, ch := range c.GoVersions {
+		goRows = append(goRows, [3]string{ch.Name, ch.From, ch.To})
+	}
+	if ch := c.GoDirective; ch != nil {
+		goRows = append(goRows, [3]string{ch.Name, ch.From, ch.To})
+	}
+	writeMarkdownTable(&b, "Go versions", [3]string{"File", "From", "To"}, goRows)
+
+	var modRows [][3]string
+	for _, ch := range c.Modules {
+		modRows = append(modRows, [3]string{"`" + ch.Name + "`", cmp.Or(ch.From, "(new)"), cmp.Or(ch.To, "(removed)")})
+	}
+	writeMarkdownTable(&b, "Dependencies", [3]string{"Module", "From", "To"}, modRows)
+
+	var actionRows [][3]string
+	for _, ch := range c.Actions {
+		actionRows = append(actionRows, [3]string{"`" + ch.Name + "` (" + ch.Where + ")", ch.From, ch.To})
+	}
+	writeMarkdownTable(&b, "GitHub Actions", [3]string{"Action", "From", "To"}, actionRows)
+
+	b.WriteString(vulnSummary(result))
+	b.WriteString("\n\n---\nCreated by mygithelper")
+	return b.String()
+}
+
+func writeMarkdownTable(b *strings.Builder, title string, header [3]string, rows [][3]string) {
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n\n### %s\n\n| %s | %s | %s |\n| --- | --- | --- |", title, header[0], header[1], header[2])
+	for _, r := range rows {
+		fmt.Fprintf(b, "\n| %s | %s | %s |", r[0], r[1], r[2])
+	}
+}
+
+// goModFile is the part of a go.mod file we report changes in.
+type goModFile struct {
+	Go        string
+	Toolchain string            // e.g. "go1.25.3"
+	Require   map[string]string // Module path -> version
+	Indirect  map[string]bool
+}
+
+// parseGoMod reads the go and toolchain directives and the requirements from
+// a go.mod file.
+func parseGoMod(content string) goModFile {
+	mod := goModFile{Require: map[string]string{}, Indirect: map[string]bool{}}
+	inRequire := false
+	for line := range strings.Lines(content) {
+		line, comment, _ := strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire && len(fields) >= 2:
+			mod.Require[fields[0]] = fields[1]
+			mod.Indirect[fields[0]] = strings.TrimSpace(comment) == "indirect"
+		case fields[0] == "go" && len(fields) == 2:
+			mod.Go = fields[1]
+		case fields[0] == "toolchain" && len(fields) == 2:
+			mod.Toolchain = fields[1]
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) >= 3:
+			mod.Require[fields[1]] = fields[2]
+			mod.Indirect[fields[1]] = strings.TrimSpace(comment) == "indirect"
+		}
+	}
+	return mod
+}
+
+// actionRefs returns the refs of the actions used in a workflow, keyed by
+// action, e.g. "actions/checkout" -> "<sha> # v4.2.2".
+func actionRefs(content string) map[string]string {
+	refs := map[string]string{}
+	for line := range strings.Lines(content) {
+		m := usesRe.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+		if m == nil {
+			continue
+		}
+		ref := m[5]
+		if comment := strings.TrimSpace(m[7]); comment != "" {
+			ref += " " + comment
+		}
+		refs[m[3]+m[4]] = ref
+	}
+	return refs
+}
+
+// gitShow returns the content of filename at rev, or "" if it doesn't exist.
+func gitShow(repoDir, rev, filename string) string {
+	out, err := gitOutput(repoDir, "show", rev+":"+filename)
+	if err != nil {
+		return ""
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// preflightTimeout limits each pre-flight check, so an unreachable host fails
+// the run quickly instead of after the network timeouts.
+const preflightTimeout = time.Minute
+
+// preflight checks, before a run touches any repo, that git can reach the
+// remotes of repos and, with api, that GitHub accepts the token, once per
+// identity and host. Problems are reported with what to do about them
+// instead of surfacing as clone or fetch errors halfway through.
+func (cfg *config) preflight(baseDir string, repos []repo, api bool) error {
+	if api {
+		fmt.Println("Checking access to the remotes and GitHub...")
+	} else {
+		fmt.Println("Checking access to the remotes...")
+	}
+
+	defer restoreDefaultIdentity()
+	checkedGit := map[string]bool{}
+	checkedAPI := map[string]bool{}
+	var problems []string
+	for _, r := range repos {
+		if err := cfg.useIdentity(baseDir, r); err != nil {
+			problems = append(problems, fmt.Sprintf("  %s: %v", r.Path, err))
+			continue
+		}
+		host := githubHost()
+
+		// A repo stands in for the others with the same SSH key and host.
+		gitKey := os.Getenv("GIT_SSH_COMMAND") + "\n" + host + "\n" + cfg.repo(r.Path).URL
+		if !checkedGit[gitKey] {
+			checkedGit[gitKey] = true
+			if err := cfg.checkRemote(r); err != nil {
+				problems = append(problems, fmt.Sprintf("  %s: can't reach the remote: %v\n    Check your network, that you have access to the repo and that your SSH key or credentials are set up", r.Path, err))
+			}
+		}
+
+		if !api {
+			continue
+		}
+		apiKey := host + "\n" + githubToken()
+		if checkedAPI[apiKey] {
+			continue
+		}
+		checkedAPI[apiKey] = true
+		if err := requireGitHub(); err != nil {
+			problems = append(problems, fmt.Sprintf("  %s: %v", host, err))
+			continue
+		}
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err := githubAPI("user", &user); err != nil {
+			problems = append(problems, fmt.Sprintf("  %s (for %s): GitHub API authentication failed: %v\n    Run gh auth login or set a valid GH_TOKEN (or the token_env of the identity)", host, r.Path, err))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Pre-flight checks failed:\n%s\n", strings.Join(problems, "\n"))
+	return errors.New("not starting: fix the problems above (mygithelper doctor has more checks), or use --skip-preflight")
+}
+
+// checkRemote checks that git can list the refs of the remote of r, the
+// origin of the clone if there is one.
+func (cfg *config) checkRemote(r repo) error {
+	dir, remote := r.Dir, "origin"
+	if !dirExists(r.Dir) {
+		dir, remote = "", cfg.cloneURL(r.Path)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	cmd, done := newCommand(ctx, "git", "ls-remote", "--exit-code", remote, "HEAD")
+	cmd.Dir = dir
+	rec := startExec(cmd)
+	output, err := cmd.CombinedOutput()
+	rec.finish(err)
+	if err := done(err); err != nil {
+		// The first line has the cause, e.g. "Permission denied (publickey)".
+		if msg, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n"); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
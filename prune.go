@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// --- Prune remote command ---
+
+type pruneRemoteCmd struct {
+	BaseDir   string
+	Config    *config
+	Try       bool
+	Yes       bool
+	KeepGoing bool // Go on with the other repos when one fails
+	Pick      bool // Interactively pick the repos to work on
+
+	summary runSummary
+}
+
+func (cmd *pruneRemoteCmd) Run() error {
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	fmt.Printf("Found %d repos in gitjoin.txt files\n", len(repos))
+
+	return forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.pruneRepo)
+}
+
+// fetchOrigin fetches origin in repoDir. Dry runs don't prune, as that
+// deletes the remote-tracking branches of the branches deleted on origin.
+func fetchOrigin(repoDir string, try bool) error {
+	if try {
+		return gitRun(repoDir, "fetch", "origin")
+	}
+	return gitRun(repoDir, "fetch", "--prune", "origin")
+}
+
+func (cmd *pruneRemoteCmd) pruneRepo(repo repo) error {
+	printSection("Pruning " + repo.Path)
+
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+
+	if err := fetchOrigin(repo.Dir, cmd.Try); err != nil {
+		return fmt.Errorf("%s: failed to fetch: %w", repo.Path, err)
+	}
+
+	defaultBranch, err := cmd.Config.defaultBranch(repo)
+	if err != nil {
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	}
+
+	branches, err := mergedRemoteBranches(repo.Dir, defaultBranch)
+	if err != nil {
+		return fmt.Errorf("%s: failed to list merged branches: %w", repo.Path, err)
+	}
+
+	var toDelete []string
+	for _, branch := range branches {
+		if branch == defaultBranch || matchesAny(branch, cmd.Config.pruneProtect()) {
+			continue
+		}
+		toDelete = append(toDelete, branch)
+	}
+
+	if len(toDelete) == 0 {
+		fmt.Println("No merged branches to delete")
+		return nil
+	}
+
+	fmt.Printf("Merged into %s:\n", defaultBranch)
+	for _, branch := range toDelete {
+		fmt.Printf("  %s\n", branch)
+	}
+
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would delete %d branch(es) from origin\n", len(toDelete))
+		return nil
+	}
+
+	if !cmd.Yes && !confirm(fmt.Sprintf("Delete %d branch(es) from origin?", len(toDelete))) {
+		fmt.Println("Skipping")
+		return skipRepo("not confirmed")
+	}
+
+	args := append([]string{"push", "origin", "--delete"}, toDelete...)
+	if err := gitRun(repo.Dir, args...); err != nil {
+		return fmt.Errorf("%s: failed to delete branches: %w", repo.Path, err)
+	}
+	for _, branch := range toDelete {
+		cmd.summary.Removed = append(cmd.summary.Removed, repo.Path+":"+branch)
+	}
+
+	return nil
+}
+
+// mergedRemoteBranches returns the origin branches (without the "origin/"
+// prefix) that are merged into the given branch.
+func mergedRemoteBranches(repoDir, branch string) ([]string, error) {
+	output, err := gitOutput(repoDir, "branch", "-r", "--merged", "origin/"+branch)
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []string
+	for line := range strings.Lines(output) {
+		line = strings.TrimSpace(line)
+		// Skip the symbolic origin/HEAD -> origin/main entry.
+		if line == "" || strings.Contains(line, " -> ") {
+			continue
+		}
+		name, ok := strings.CutPrefix(line, "origin/")
+		if !ok {
+			continue
+		}
+		branches = append(branches, name)
+	}
+	return branches, nil
+}
+
+// matchesAny reports whether name matches any of the path.Match patterns.
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Prune branches command ---
+
+// pruneBranchesCmd deletes the local and origin branches created by
+// mygithelper once they are merged, including squash merged PRs.
+type pruneBranchesCmd struct {
+	BaseDir   string
+	Config    *config
+	Try       bool
+	Yes       bool
+	KeepGoing bool // Go on with the other repos when one fails
+	Pick      bool // Interactively pick the repos to work on
+
+	summary runSummary
+}
+
+func (cmd *pruneBranchesCmd) Run() error {
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	fmt.Printf("Found %d repos in gitjoin.txt files\n", len(repos))
+
+	return forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.pruneRepo)
+}
+
+func (cmd *pruneBranchesCmd) pruneRepo(repo repo) error {
+	printSection("Pruning branches in " + repo.Path)
+
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+
+	if err := fetchOrigin(repo.Dir, cmd.Try); err != nil {
+		return fmt.Errorf("%s: failed to fetch: %w", repo.Path, err)
+	}
+
+	defaultBranch, err := cmd.Config.defaultBranch(repo)
+	if err != nil {
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	}
+	current, _ := gitOutput(repo.Dir, "branch", "--show-current")
+	current = strings.TrimSpace(current)
+
+	patterns := cmd.Config.toolBranchPatterns()
+	merged := map[string]bool{} // Keyed by branch and commit
+	var local, remote []string
+	for _, ref := range []string{"refs/heads/", "refs/remotes/origin/"} {
+		output, err := gitOutput(repo.Dir, "for-each-ref", "--format=%(refname) %(objectname)", ref)
+		if err != nil {
+			return fmt.Errorf("%s: failed to list branches: %w", repo.Path, err)
+		}
+		for line := range strings.Lines(output) {
+			refname, sha, _ := strings.Cut(strings.TrimSpace(line), " ")
+			branch := strings.TrimPrefix(refname, ref)
+			if branch == defaultBranch || !matchesAny(branch, patterns) {
+				continue
+			}
+			if ref == "refs/heads/" && branch == current {
+				fmt.Printf("  %s is checked out, keeping it\n", branch)
+				continue
+			}
+			key := branch + " " + sha
+			if _, ok := merged[key]; !ok {
+				merged[key] = isBranchMerged(repo, defaultBranch, branch, sha)
+			}
+			if !merged[key] {
+				fmt.Printf("  %s is not merged, keeping it\n", strings.TrimPrefix(refname, "refs/remotes/"))
+				continue
+			}
+			if ref == "refs/heads/" {
+				local = append(local, branch)
+			} else {
+				remote = append(remote, branch)
+			}
+		}
+	}
+
+	if len(local)+len(remote) == 0 {
+		fmt.Println("No merged mygithelper branches to delete")
+		return nil
+	}
+
+	fmt.Printf("Merged into %s:\n", defaultBranch)
+	for _, branch := range local {
+		fmt.Printf("  %s\n", branch)
+	}
+	for _, branch := range remote {
+		fmt.Printf("  origin/%s\n", branch)
+	}
+
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would delete %d local and %d origin branch(es)\n", len(local), len(remote))
+		return nil
+	}
+
+	if !cmd.Yes && !confirm(fmt.Sprintf("Delete %d local and %d origin branch(es)?", len(local), len(remote))) {
+		fmt.Println("Skipping")
+		return skipRepo("not confirmed")
+	}
+
+	// -D as squash merged branches aren't merged as far as git knows.
+	if len(local) > 0 {
+		if err := gitRun(repo.Dir, append([]string{"branch", "-D"}, local...)...); err != nil {
+			return fmt.Errorf("%s: failed to delete local branches: %w", repo.Path, err)
+		}
+		for _, branch := range local {
+			cmd.summary.Removed = append(cmd.summary.Removed, repo.Path+":"+branch+" (local)")
+		}
+	}
+	if len(remote) > 0 {
+		if err := gitRun(repo.Dir, append([]string{"push", "origin", "--delete"}, remote...)...); err != nil {
+			return fmt.Errorf("%s: failed to delete branches: %w", repo.Path, err)
+		}
+		for _, branch := range remote {
+			cmd.summary.Removed = append(cmd.summary.Removed, repo.Path+":"+branch)
+		}
+	}
+
+	return nil
+}
+
+// isBranchMerged reports whether the branch at sha is merged into the default
+// branch, either by a merge or fast-forward, or as the head of a merged PR
+// (e.g. squash merged). A branch with commits pushed after its PR was merged
+// isn't.
+func isBranchMerged(repo repo, defaultBranch, branch, sha string) bool {
+	if _, err := gitOutput(repo.Dir, "merge-base", "--is-ancestor", sha, "origin/"+defaultBranch); err == nil {
+		return true
+	}
+	if requireGitHub() != nil {
+		return false
+	}
+
+	var prs []struct {
+		MergedAt *string `json:"merged_at"`
+		Head     struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	}
+	owner, _, _ := strings.Cut(repo.Path, "/")
+	if err := githubAPI(fmt.Sprintf("repos/%s/pulls?state=closed&head=%s", repo.Path, url.QueryEscape(owner+":"+branch)), &prs); err != nil {
+		fmt.Printf("  Could not look up the PRs of %s: %v\n", branch, err)
+		return false
+	}
+	for _, pr := range prs {
+		if pr.MergedAt != nil && pr.Head.SHA == sha {
+			return true
+		}
+	}
+	return false
+}
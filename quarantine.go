@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultQuarantineAfter is the number of runs in a row a repo may fail
+// before it's quarantined.
+const defaultQuarantineAfter = 3
+
+// quarantineEntry tracks the failed runs of a repo, stored by repo path in
+// .mygithelper/quarantine.json.
+type quarantineEntry struct {
+	Failures    int    `json:"failures"` // Failed runs in a row
+	LastError   string `json:"last_error,omitempty"`
+	Quarantined string `json:"quarantined,omitempty"` // When (RFC 3339), if quarantined
+}
+
+func quarantineFilename(baseDir string) string {
+	return filepath.Join(baseDir, stateDirName, "quarantine.json")
+}
+
+func loadQuarantine(baseDir string) (map[string]*quarantineEntry, error) {
+	q := map[string]*quarantineEntry{}
+	b, err := os.ReadFile(quarantineFilename(baseDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return q, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &q); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", quarantineFilename(baseDir), err)
+	}
+	return q, nil
+}
+
+func saveQuarantine(baseDir string, q map[string]*quarantineEntry) error {
+	b, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := quarantineFilename(baseDir)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0o644)
+}
+
+func (cfg *config) quarantineAfter() int {
+	if cfg.QuarantineAfter == 0 {
+		return defaultQuarantineAfter
+	}
+	return cfg.QuarantineAfter
+}
+
+// withQuarantine wraps the per-repo function of a command so that
+// quarantined repos are skipped, and repos that fail quarantine_after runs in
+// a row are quarantined until unquarantined. Dry runs don't count.
+func (cfg *config) withQuarantine(baseDir string, try bool, fn func(repo) error) func(repo) error {
+	return func(r repo) error {
+		q, err := loadQuarantine(baseDir)
+		if err != nil {
+			return err
+		}
+		if e := q[r.Path]; e != nil && e.Quarantined != "" {
+			fmt.Printf("WARNING: %s is quarantined after %d failed runs in a row (last: %s); skipping until mygithelper unquarantine %s\n", r.Path, e.Failures, e.LastError, r.Path)
+			addStepSummary(fmt.Sprintf("- **Quarantined:** %s", r.Path))
+			return skipRepo("quarantined since %s", e.Quarantined)
+		}
+
+		err = fn(r)
+		if try || isSkipped(err) || cfg.quarantineAfter() < 0 {
+			return err
+		}
+		if err == nil {
+			if _, ok := q[r.Path]; !ok {
+				return nil
+			}
+			delete(q, r.Path)
+		} else {
+			e := q[r.Path]
+			if e == nil {
+				e = &quarantineEntry{}
+				q[r.Path] = e
+			}
+			e.Failures++
+			e.LastError = strings.TrimPrefix(err.Error(), r.Path+": ")
+			if e.Failures >= cfg.quarantineAfter() {
+				e.Quarantined = time.Now().Format(time.RFC3339)
+				fmt.Printf("WARNING: %s failed %d runs in a row and is quarantined; run mygithelper unquarantine %s once fixed\n", r.Path, e.Failures, r.Path)
+			}
+		}
+		if err := saveQuarantine(baseDir, q); err != nil {
+			fmt.Printf("Failed to save %s: %v\n", quarantineFilename(baseDir), err)
+		}
+		return err
+	}
+}
+
+// --- Unquarantine command ---
+
+type unquarantineCmd struct {
+	BaseDir string
+	Repos   []string // Repo paths, e.g. "bep/firstupdotenv"
+}
+
+func (cmd *unquarantineCmd) Run() error {
+	q, err := loadQuarantine(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if len(cmd.Repos) == 0 {
+		var quarantined []string
+		for repoPath, e := range q {
+			if e.Quarantined != "" {
+				quarantined = append(quarantined, repoPath)
+			}
+		}
+		if len(quarantined) == 0 {
+			fmt.Println("No repos are quarantined")
+			return nil
+		}
+		slices.Sort(quarantined)
+		for _, repoPath := range quarantined {
+			e := q[repoPath]
+			fmt.Printf("%s: quarantined since %s after %d failed runs: %s\n", repoPath, e.Quarantined, e.Failures, e.LastError)
+		}
+		return nil
+	}
+
+	for _, arg := range cmd.Repos {
+		repoPath := repoPathFromGitjoinLine(arg)
+		if e := q[repoPath]; e == nil || e.Quarantined == "" {
+			return fmt.Errorf("%s is not quarantined", arg)
+		}
+		delete(q, repoPath)
+		fmt.Printf("Unquarantined %s\n", repoPath)
+	}
+	return saveQuarantine(cmd.BaseDir, q)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// checkReadiness checks all repos for uncommitted changes and unpushed
+// commits on the default branch before a run works in their checkouts, so
+// the full list is reported up front instead of the run stopping at the first
+// one with work half done. With keepGoing the problems are only reported.
+func (cfg *config) checkReadiness(repos []repo, keepGoing bool) error {
+	fmt.Printf("Checking %d repos for uncommitted or unpushed work...\n", len(repos))
+
+	var notReady []string
+	for _, r := range repos {
+		if problem := cfg.readinessProblem(r); problem != "" {
+			notReady = append(notReady, fmt.Sprintf("  %s: %s", r.Path, problem))
+		}
+	}
+	if len(notReady) == 0 {
+		return nil
+	}
+
+	fmt.Printf("%d repos are not ready:\n%s\n", len(notReady), strings.Join(notReady, "\n"))
+	if keepGoing {
+		fmt.Println("Going on with --keep-going; these repos will fail")
+		return nil
+	}
+	return errors.New("not starting: commit, push or stash the work in the repos above, or use --worktree to leave the checkouts alone")
+}
+
+// readinessProblem describes what keeps repo from being worked on in its
+// checkout, or returns "" if it's ready.
+func (cfg *config) readinessProblem(r repo) string {
+	dirty, status, err := checkUncommitted(r.Dir)
+	if err != nil {
+		return err.Error()
+	}
+	if dirty {
+		return fmt.Sprintf("%d uncommitted change(s)", strings.Count(status, "\n"))
+	}
+
+	branch, err := cfg.defaultBranch(r)
+	if err != nil {
+		return fmt.Sprintf("failed to get default branch: %v", err)
+	}
+	// A missing local or remote branch just means there's nothing unpushed.
+	ahead, err := gitOutput(r.Dir, "rev-list", "--count", "origin/"+branch+".."+branch, "--")
+	if err != nil {
+		return ""
+	}
+	if ahead = strings.TrimSpace(ahead); ahead != "0" {
+		return fmt.Sprintf("%s unpushed commit(s) on %s", ahead, branch)
+	}
+	return ""
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// --- Release command ---
+
+// releaseCmd tags the tip of the default branch of each repo with the next
+// version and publishes a GitHub release for it, with release notes from the
+// commits since the previous tag.
+type releaseCmd struct {
+	BaseDir   string
+	Config    *config
+	Bump      string // "patch" (default), "minor" or "major"
+	Tag       string // Use this version instead of bumping the latest
+	Preview   bool   // Only print the release notes
+	Try       bool
+	Yes       bool
+	KeepGoing bool
+	Pick      bool
+
+	summary runSummary
+}
+
+func (cmd *releaseCmd) Run() error {
+	if cmd.Preview {
+		cmd.Try = true
+	} else if err := requireGitHub(); err != nil {
+		return err
+	}
+	if !cmd.Try {
+		if err := cmd.Config.checkSigning(cmd.BaseDir); err != nil {
+			return err
+		}
+	}
+	switch cmd.Bump {
+	case "":
+		cmd.Bump = "patch"
+	case "patch", "minor", "major":
+	default:
+		return fmt.Errorf("invalid --bump %q, must be patch, minor or major", cmd.Bump)
+	}
+	if cmd.Tag != "" {
+		if _, ok := parseSemver(cmd.Tag); !ok {
+			return fmt.Errorf("invalid --tag %q, expected vMAJOR.MINOR.PATCH", cmd.Tag)
+		}
+	}
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	return forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.releaseRepo)
+}
+
+func (cmd *releaseCmd) releaseRepo(repo repo) error {
+	printSection("Releasing " + repo.Path)
+
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	if err := cmd.Config.checkArchived(repo, cmd.Try); err != nil {
+		return err
+	}
+
+	defaultBranch, err := cmd.Config.defaultBranch(repo)
+	if err != nil {
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	}
+	if err := gitRun(repo.Dir, "fetch", "--tags", "origin", defaultBranch); err != nil {
+		return fmt.Errorf("%s: failed to fetch: %w", repo.Path, err)
+	}
+	target := "origin/" + defaultBranch
+
+	latest, err := latestReleaseTag(repo.Dir)
+	if err != nil {
+		return fmt.Errorf("%s: failed to list tags: %w", repo.Path, err)
+	}
+	commits := "all"
+	if latest != "" {
+		out, err := gitOutput(repo.Dir, "rev-list", "--count", latest+".."+target)
+		if err != nil {
+			return fmt.Errorf("%s: failed to count commits since %s: %w", repo.Path, latest, err)
+		}
+		if commits = strings.TrimSpace(out); commits == "0" {
+			fmt.Printf("No commits since %s, skipping\n", latest)
+			return skipRepo("no commits since %s", latest)
+		}
+	}
+
+	next := cmd.Tag
+	if next == "" {
+		next = nextVersion(latest, cmd.Bump)
+	}
+	if gitRead.refExists(repo.Dir, "refs/tags/"+next) {
+		fmt.Printf("Tag %s already exists, skipping\n", next)
+		return skipRepo("tag %s already exists", next)
+	}
+
+	fmt.Printf("%s -> %s (%s commits on %s)\n", cmp.Or(latest, "no tags"), next, commits, defaultBranch)
+
+	notes, err := releaseNotes(repo, latest, target)
+	if err != nil {
+		return err
+	}
+	if cmd.Preview {
+		fmt.Printf("\n# %s %s\n\n%s", repo.Name, next, notes)
+		return nil
+	}
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would tag %s as %s, push it and create a release\n", target, next)
+		return nil
+	}
+	if !cmd.Yes && !confirm(fmt.Sprintf("Tag %s as %s and publish the release?", target, next)) {
+		fmt.Println("Skipping")
+		return skipRepo("not confirmed")
+	}
+
+	if err := gitRun(repo.Dir, cmd.Config.gitTagArgs(next, "Release "+next, target)...); err != nil {
+		return fmt.Errorf("%s: failed to tag: %w", repo.Path, err)
+	}
+	if err := gitRun(repo.Dir, "push", "origin", "refs/tags/"+next); err != nil {
+		return fmt.Errorf("%s: failed to push tag: %w", repo.Path, err)
+	}
+
+	var release struct {
+		HTMLURL string `json:"html_url"`
+	}
+	req := map[string]any{"tag_name": next, "name": next, "body": notes}
+	if err := githubRequest("POST", "repos/"+repo.Path+"/releases", req, &release); err != nil {
+		return fmt.Errorf("%s: pushed %s, but failed to create the release: %w", repo.Path, next, err)
+	}
+	fmt.Println(release.HTMLURL)
+	cmd.summary.Released = append(cmd.summary.Released, summaryEntry{Repo: repo.Path, Detail: release.HTMLURL})
+	addStepSummary(fmt.Sprintf("- %s: released %s", repo.Path, next))
+	return nil
+}
+
+// gitTagArgs returns the arguments to create an annotated tag of target,
+// signed the same way as the commits.
+func (cfg *config) gitTagArgs(tag, message, target string) []string {
+	var args []string
+	if cfg.SignCommits == "ssh" {
+		args = append(args, "-c", "gpg.format=ssh")
+	}
+	args = append(args, "tag", "-a")
+	if cfg.SignCommits != "" {
+		sign := "--sign"
+		if cfg.SigningKey != "" {
+			sign = "--local-user=" + cfg.SigningKey
+		}
+		args = append(args, sign)
+	}
+	return append(args, "-m", message, tag, target)
+}
+
+var semverRe = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)$`)
+
+// parseSemver parses a release version like v1.2.3; pre-releases aren't
+// accepted.
+func parseSemver(v string) ([3]int, bool) {
+	m := semverRe.FindStringSubmatch(v)
+	if m == nil {
+		return [3]int{}, false
+	}
+	var parts [3]int
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(m[i+1])
+	}
+	return parts, true
+}
+
+// latestReleaseTag returns the highest vMAJOR.MINOR.PATCH tag in repoDir, or
+// "" if there is none.
+func latestReleaseTag(repoDir string) (string, error) {
+	out, err := gitOutput(repoDir, "tag", "--list", "v*", "--sort=-v:refname")
+	if err != nil {
+		return "", err
+	}
+	for tag := range strings.Lines(out) {
+		tag = strings.TrimSpace(tag)
+		if _, ok := parseSemver(tag); ok {
+			return tag, nil
+		}
+	}
+	return "", nil
+}
+
+// nextVersion bumps the patch, minor or major version of latest, starting at
+// v0.1.0 if there is no release yet.
+func nextVersion(latest, bump string) string {
+	v, ok := parseSemver(latest)
+	if !ok {
+		return "v0.1.0"
+	}
+	switch bump {
+	case "major":
+		v = [3]int{v[0] + 1, 0, 0}
+	case "minor":
+		v = [3]int{v[0], v[1] + 1, 0}
+	default:
+		v[2]++
+	}
+	return fmt.Sprintf("v%d.%d.%d", v[0], v[1], v[2])
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// hostConfig is a machine to run mygithelper on over SSH with --host.
+type hostConfig struct {
+	// SSH is the destination to connect to, e.g. "me@build-server"
+	// (defaults to the host name).
+	SSH string `json:"ssh,omitempty"`
+
+	// Dir is the base directory on the host (defaults to the same path
+	// relative to the home directory as here).
+	Dir string `json:"dir,omitempty"`
+
+	// Command is the mygithelper to run on the host (default "mygithelper").
+	Command string `json:"command,omitempty"`
+}
+
+// runOnHost runs mygithelper with args on host over SSH, in the base
+// directory there, with its output (and prompts) here. The repos, runs and
+// state are the ones on the host.
+func (cfg *config) runOnHost(host, baseDir string, args []string) error {
+	hc := cfg.Hosts[host]
+	dir := hc.Dir
+	if dir == "" {
+		dir = baseDir
+		if home, err := os.UserHomeDir(); err == nil {
+			if rel, err := filepath.Rel(home, baseDir); err == nil && !strings.HasPrefix(rel, "..") {
+				dir = "~/" + filepath.ToSlash(rel)
+			}
+		}
+	}
+
+	remote := []string{shellQuote(cmp.Or(hc.Command, "mygithelper"))}
+	for _, arg := range args {
+		remote = append(remote, shellQuote(arg))
+	}
+	// Leave a leading ~/ unquoted for the remote shell to expand.
+	quotedDir := shellQuote(dir)
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		quotedDir = `"$HOME"/` + shellQuote(rest)
+	}
+	script := "cd " + quotedDir + " && exec " + strings.Join(remote, " ")
+
+	sshArgs := []string{}
+	if stdoutIsTerminal {
+		sshArgs = append(sshArgs, "-t")
+	}
+	sshArgs = append(sshArgs, cmp.Or(hc.SSH, host), script)
+	cmd, done := newCommand(context.Background(), "ssh", sshArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return done(runTraced(cmd))
+}
+
+// withoutFlag returns args without the flag (e.g. "host") and its value, as
+// -host, --host or with =value.
+func withoutFlag(args []string, flag string) []string {
+	for i, arg := range args {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != flag {
+			continue
+		}
+		if hasValue {
+			return slices.Delete(slices.Clone(args), i, i+1)
+		}
+		return slices.Delete(slices.Clone(args), i, min(i+2, len(args)))
+	}
+	return args
+}
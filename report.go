@@ -0,0 +1,110 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// --- Report command ---
+
+// reportCmd summarizes the recorded runs: which files our PRs change most
+// often and which repos and steps fail most often.
+type reportCmd struct {
+	BaseDir string
+	Top     int // Rows per table
+}
+
+func (cmd *reportCmd) Run() error {
+	filenames, err := filepath.Glob(filepath.Join(cmd.BaseDir, stateDirName, "runs", "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(filenames) == 0 {
+		fmt.Println("No recorded runs")
+		return nil
+	}
+
+	files := map[string]int{}
+	fileRepos := map[string]map[string]bool{}
+	prsByRepo := map[string]int{}
+	failuresByRepo := map[string]int{}
+	failuresByStep := map[string]int{}
+	var prs, failures int
+
+	for _, filename := range filenames {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		var rec runRecord
+		if err := json.Unmarshal(b, &rec); err != nil {
+			fmt.Printf("Skipping %s: %v\n", filepath.Base(filename), err)
+			continue
+		}
+		for _, pr := range rec.PRs {
+			prs++
+			prsByRepo[pr.Repo]++
+			for _, f := range pr.Files {
+				files[f]++
+				if fileRepos[f] == nil {
+					fileRepos[f] = map[string]bool{}
+				}
+				fileRepos[f][pr.Repo] = true
+			}
+		}
+		for _, f := range rec.Failures {
+			failures++
+			failuresByRepo[f.Repo]++
+			failuresByStep[cmp.Or(f.Step, "(setup)")]++
+		}
+	}
+
+	fmt.Printf("%d runs, %d PRs, %d failures\n", len(filenames), prs, failures)
+
+	printHeatmap("Files changed most often (PRs, repos)", files, cmd.Top, func(f string) string {
+		return fmt.Sprintf("%d repos", len(fileRepos[f]))
+	})
+	printHeatmap("Repos with most PRs", prsByRepo, cmd.Top, nil)
+	printHeatmap("Repos failing most often", failuresByRepo, cmd.Top, nil)
+	printHeatmap("Steps failing most often", failuresByStep, cmd.Top, nil)
+
+	return nil
+}
+
+// printHeatmap prints the top entries of counts, most frequent first, with a
+// bar scaled to the largest count and an optional note per entry.
+func printHeatmap(title string, counts map[string]int, top int, note func(key string) string) {
+	if len(counts) == 0 {
+		return
+	}
+
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), strings.Compare(a, b))
+	})
+	if top > 0 && len(keys) > top {
+		keys = keys[:top]
+	}
+
+	width := 0
+	for _, k := range keys {
+		width = max(width, len(k))
+	}
+	maxCount := counts[keys[0]]
+
+	fmt.Printf("\n%s:\n", title)
+	const barWidth = 30
+	for _, k := range keys {
+		bar := strings.Repeat("█", max(1, counts[k]*barWidth/maxCount))
+		line := fmt.Sprintf("  %-*s %4d %s", width, k, counts[k], bar)
+		if note != nil {
+			line += " (" + note(k) + ")"
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// runRecord is what we remember about a run of update or fix, stored in
+// .mygithelper/runs/<run-id>.json.
+type runRecord struct {
+	ID       string       `json:"id"`
+	Command  string       `json:"command,omitempty"` // Not set for dry runs
+	PRs      []runPRRef   `json:"prs"`
+	Failures []runFailure `json:"failures,omitempty"`
+}
+
+// runPRRef identifies a PR created in a run by its repo and head branch.
+type runPRRef struct {
+	Repo   string   `json:"repo"`
+	Branch string   `json:"branch"`
+	Title  string   `json:"title"`
+	Files  []string `json:"files,omitempty"` // Changed files
+}
+
+// runFailure is a repo that failed in a run and the step it failed in.
+type runFailure struct {
+	Repo  string `json:"repo"`
+	Step  string `json:"step,omitempty"`
+	Error string `json:"error"`
+}
+
+func runRecordFilename(baseDir, runID string) string {
+	return filepath.Join(baseDir, stateDirName, "runs", runID+".json")
+}
+
+func loadRunRecord(baseDir, runID string) (*runRecord, error) {
+	b, err := os.ReadFile(runRecordFilename(baseDir, runID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no run with ID %q", runID)
+		}
+		return nil, err
+	}
+	var rec runRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", runID, err)
+	}
+	return &rec, nil
+}
+
+// startRunRecord records that command started the run, so lastRunRecord
+// can find it.
+func startRunRecord(baseDir, runID, command string) {
+	if err := updateRunRecord(baseDir, runID, func(rec *runRecord) {
+		rec.Command = command
+	}); err != nil {
+		fmt.Printf("Failed to record run %s: %v\n", runID, err)
+	}
+}
+
+// lastRunRecord returns the record of the latest run of command.
+func lastRunRecord(baseDir, command string) (*runRecord, error) {
+	entries, err := os.ReadDir(filepath.Join(baseDir, stateDirName, "runs"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// Run IDs sort by time.
+	for _, e := range slices.Backward(entries) {
+		runID, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		rec, err := loadRunRecord(baseDir, runID)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Command == command {
+			return rec, nil
+		}
+	}
+	return nil, fmt.Errorf("no recorded %s run", command)
+}
+
+// recordPR adds a created PR to the record of the run. The changed files are
+// read from the commit on branch in repoDir.
+func recordPR(baseDir, runID, repoDir, repoPath, branch, title string) error {
+	var files []string
+	if out, err := gitOutput(repoDir, "diff", "-z", "--name-only", branch+"~1", branch); err == nil {
+		files = strings.FieldsFunc(out, func(r rune) bool { return r == 0 })
+	}
+	return updateRunRecord(baseDir, runID, func(rec *runRecord) {
+		rec.PRs = append(rec.PRs, runPRRef{Repo: repoPath, Branch: branch, Title: title, Files: files})
+	})
+}
+
+// recordFailure adds a failed repo to the record of the run.
+func recordFailure(baseDir, runID, repoPath string, err error) {
+	step := currentStep
+	if err := updateRunRecord(baseDir, runID, func(rec *runRecord) {
+		rec.Failures = append(rec.Failures, runFailure{Repo: repoPath, Step: step, Error: err.Error()})
+	}); err != nil {
+		fmt.Printf("Failed to record failure in run %s: %v\n", runID, err)
+	}
+}
+
+// recordDiff appends the diff of repoPath to the diffs of the run, in
+// .mygithelper/runs/<run-id>.diff, to look back at what the edits did.
+func recordDiff(baseDir, runID, repoPath, diff string) error {
+	filename := filepath.Join(baseDir, stateDirName, "runs", runID+".diff")
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "# %s\n%s", repoPath, diff); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func updateRunRecord(baseDir, runID string, update func(rec *runRecord)) error {
+	rec, err := loadRunRecord(baseDir, runID)
+	if err != nil {
+		rec = &runRecord{ID: runID}
+	}
+	update(rec)
+
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := runRecordFilename(baseDir, runID)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0o644)
+}
+
+// githubPR is the subset of the GitHub API pull request object we use.
+type githubPR struct {
+	Number         int    `json:"number"`
+	State          string `json:"state"`
+	HTMLURL        string `json:"html_url"`
+	Title          string `json:"title"`
+	MergedAt       string `json:"merged_at"`
+	MergeCommitSHA string `json:"merge_commit_sha"`
+	Mergeable      *bool  `json:"mergeable"` // Nil until GitHub has computed it
+	Base           struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	Head struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+// findPR returns the PR in repoPath with the given head branch, or nil.
+func findPR(repoPath, branch string) (*githubPR, error) {
+	owner, _, _ := strings.Cut(repoPath, "/")
+	var prs []githubPR
+	if err := githubAPI(fmt.Sprintf("repos/%s/pulls?state=all&head=%s:%s", repoPath, owner, branch), &prs); err != nil {
+		return nil, err
+	}
+	if len(prs) == 0 {
+		return nil, nil
+	}
+	return &prs[0], nil
+}
+
+// --- Revert run command ---
+
+type revertRunCmd struct {
+	BaseDir      string
+	Config       *config
+	RunID        string
+	RevertMerged bool // Open revert PRs for PRs that were already merged
+	Try          bool
+	Yes          bool
+}
+
+func (cmd *revertRunCmd) Run() error {
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+	if !cmd.Try {
+		if err := cmd.Config.checkSigning(cmd.BaseDir); err != nil {
+			return err
+		}
+	}
+
+	rec, err := loadRunRecord(cmd.BaseDir, cmd.RunID)
+	if err != nil {
+		return err
+	}
+
+	if len(rec.PRs) == 0 {
+		fmt.Printf("Run %s created no PRs\n", rec.ID)
+		return nil
+	}
+
+	fmt.Printf("Run %s created %d PR(s)\n", rec.ID, len(rec.PRs))
+	if !cmd.Try && !cmd.Yes && !confirm(fmt.Sprintf("Revert run %s?", rec.ID)) {
+		return nil
+	}
+
+	// Revert PRs need a local clone.
+	repos, err := listRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	repoByPath := map[string]repo{}
+	for _, r := range repos {
+		repoByPath[r.Path] = r
+	}
+
+	defer restoreDefaultIdentity()
+	for _, ref := range rec.PRs {
+		printSection("Reverting " + ref.Repo)
+
+		if r, ok := repoByPath[ref.Repo]; ok {
+			if err := cmd.Config.useIdentity(cmd.BaseDir, r); err != nil {
+				return fmt.Errorf("%s: %w", ref.Repo, err)
+			}
+		}
+
+		pr, err := findPR(ref.Repo, ref.Branch)
+		if err != nil {
+			return fmt.Errorf("%s: failed to find PR for %s: %w", ref.Repo, ref.Branch, err)
+		}
+		if pr == nil {
+			fmt.Printf("No PR found for branch %s\n", ref.Branch)
+			continue
+		}
+
+		switch {
+		case pr.State == "open":
+			if err := cmd.closePR(ref, pr); err != nil {
+				return fmt.Errorf("%s: %w", ref.Repo, err)
+			}
+		case pr.MergedAt != "":
+			if !cmd.RevertMerged {
+				fmt.Printf("%s was merged, use --revert-merged to open a revert PR\n", pr.HTMLURL)
+				continue
+			}
+			r, ok := repoByPath[ref.Repo]
+			if !ok || !dirExists(r.Dir) {
+				return fmt.Errorf("%s: not cloned, can't revert %s", ref.Repo, pr.HTMLURL)
+			}
+			if err := cmd.revertPR(r, pr); err != nil {
+				return fmt.Errorf("%s: %w", ref.Repo, err)
+			}
+		default:
+			fmt.Printf("%s is already closed\n", pr.HTMLURL)
+		}
+	}
+
+	return nil
+}
+
+func (cmd *revertRunCmd) closePR(ref runPRRef, pr *githubPR) error {
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would close %s and delete branch %s\n", pr.HTMLURL, ref.Branch)
+		return nil
+	}
+
+	fmt.Printf("Closing %s...\n", pr.HTMLURL)
+	if err := githubRequest("PATCH", fmt.Sprintf("repos/%s/pulls/%d", ref.Repo, pr.Number), map[string]string{"state": "closed"}, nil); err != nil {
+		return fmt.Errorf("failed to close PR: %w", err)
+	}
+
+	fmt.Printf("Deleting branch %s...\n", ref.Branch)
+	if err := githubRequest("DELETE", fmt.Sprintf("repos/%s/git/refs/heads/%s", ref.Repo, ref.Branch), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete branch: %w", err)
+	}
+
+	return nil
+}
+
+func (cmd *revertRunCmd) revertPR(repo repo, pr *githubPR) error {
+	branchName := "mygithelper/revert-" + strconv.Itoa(pr.Number)
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would open a PR reverting %s\n", pr.HTMLURL)
+		return nil
+	}
+
+	if branchExistsRemote(repo.Dir, branchName) {
+		fmt.Printf("Branch %s already exists, skipping\n", branchName)
+		return nil
+	}
+
+	defaultBranch := pr.Base.Ref
+	if err := prepareCheckout(repo, defaultBranch, cmd.Config.PullStrategy); err != nil {
+		return err
+	}
+
+	if err := gitRun(repo.Dir, "checkout", "-b", branchName); err != nil {
+		return fmt.Errorf("failed to create branch: %w", err)
+	}
+
+	// Merge commits need to know which parent is the mainline.
+	args := cmd.Config.gitCommitArgs("revert", "--no-edit")
+	if parents, err := gitOutput(repo.Dir, "rev-list", "--parents", "-n", "1", pr.MergeCommitSHA); err == nil && len(strings.Fields(parents)) > 2 {
+		args = append(args, "-m", "1")
+	}
+	if err := gitRun(repo.Dir, append(args, pr.MergeCommitSHA)...); err != nil {
+		gitRun(repo.Dir, "revert", "--abort")
+		gitRun(repo.Dir, "checkout", defaultBranch)
+		gitRun(repo.Dir, "branch", "-D", branchName)
+		return fmt.Errorf("failed to revert %s: %w", pr.MergeCommitSHA, err)
+	}
+
+	fmt.Printf("Pushing branch %s...\n", branchName)
+	if err := gitRun(repo.Dir, "push", "-u", "origin", branchName); err != nil {
+		return fmt.Errorf("failed to push: %w", err)
+	}
+
+	title := fmt.Sprintf("Revert %q", pr.Title)
+	body := fmt.Sprintf("Reverts #%d\n\n---\nCreated by mygithelper", pr.Number)
+	fmt.Println("Creating PR...")
+	if _, err := createPR(repo.Dir, repo.Path, defaultBranch, branchName, title, body, cmd.Config.prOptions(repo.Path)); err != nil {
+		return fmt.Errorf("failed to create PR: %w", err)
+	}
+
+	if err := gitRun(repo.Dir, "checkout", defaultBranch); err != nil {
+		return fmt.Errorf("failed to checkout %s: %w", defaultBranch, err)
+	}
+
+	return nil
+}
+
+// --- PR comment command ---
+
+// prCommentCmd posts the same comment on the open PRs of a run, e.g. to say
+// that CI is being re-run and they shouldn't be merged yet.
+type prCommentCmd struct {
+	BaseDir string
+	Config  *config
+	RunID   string
+	Body    string
+	Try     bool
+}
+
+func (cmd *prCommentCmd) Run() error {
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+	if strings.TrimSpace(cmd.Body) == "" {
+		return errors.New("the comment is empty")
+	}
+
+	rec, err := loadRunRecord(cmd.BaseDir, cmd.RunID)
+	if err != nil {
+		return err
+	}
+	if len(rec.PRs) == 0 {
+		fmt.Printf("Run %s created no PRs\n", rec.ID)
+		return nil
+	}
+
+	repos, err := listRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	repoByPath := map[string]repo{}
+	for _, r := range repos {
+		repoByPath[r.Path] = r
+	}
+
+	defer restoreDefaultIdentity()
+	var commented int
+	for _, ref := range rec.PRs {
+		if r, ok := repoByPath[ref.Repo]; ok {
+			if err := cmd.Config.useIdentity(cmd.BaseDir, r); err != nil {
+				return fmt.Errorf("%s: %w", ref.Repo, err)
+			}
+		}
+
+		pr, err := findPR(ref.Repo, ref.Branch)
+		if err != nil {
+			return fmt.Errorf("%s: failed to find PR for %s: %w", ref.Repo, ref.Branch, err)
+		}
+		switch {
+		case pr == nil:
+			fmt.Printf("%s: no PR found for branch %s\n", ref.Repo, ref.Branch)
+			continue
+		case pr.MergedAt != "":
+			fmt.Printf("%s is merged, skipping\n", pr.HTMLURL)
+			continue
+		case pr.State != "open":
+			fmt.Printf("%s is closed, skipping\n", pr.HTMLURL)
+			continue
+		case cmd.Try:
+			fmt.Printf("[dry-run] Would comment on %s\n", pr.HTMLURL)
+			continue
+		}
+
+		if err := githubRequest("POST", fmt.Sprintf("repos/%s/issues/%d/comments", ref.Repo, pr.Number), map[string]string{"body": cmd.Body}, nil); err != nil {
+			return fmt.Errorf("%s: failed to comment on %s: %w", ref.Repo, pr.HTMLURL, err)
+		}
+		fmt.Printf("Commented on %s\n", pr.HTMLURL)
+		commented++
+	}
+
+	if !cmd.Try {
+		fmt.Printf("Commented on %d of %d PR(s) of run %s\n", commented, len(rec.PRs), rec.ID)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sbomModule is a module from go list -m -json all.
+type sbomModule struct {
+	Path    string
+	Version string
+	Main    bool
+	Replace *sbomModule
+}
+
+func (m sbomModule) purl() string {
+	if m.Version == "" {
+		return "pkg:golang/" + m.Path
+	}
+	return "pkg:golang/" + m.Path + "@" + m.Version
+}
+
+// writeSBOM writes an SBOM in format ("spdx" or "cyclonedx") of the modules
+// repo builds with to .mygithelper/sbom/<run-id>/<owner>/<name>,
+// and returns the filename.
+func writeSBOM(baseDir, runID string, repo repo, format string) (string, error) {
+	modules, err := listModules(repo.Dir)
+	if err != nil {
+		return "", err
+	}
+	var mainModule sbomModule
+	var deps []sbomModule
+	for _, m := range modules {
+		switch {
+		case m.Main:
+			mainModule = m
+		case m.Replace != nil && m.Replace.Version != "":
+			deps = append(deps, *m.Replace)
+		case m.Replace == nil:
+			deps = append(deps, m)
+		}
+		// Left out: modules replaced by a local directory.
+	}
+
+	created := time.Now().UTC().Format(time.RFC3339)
+	var doc any
+	switch format {
+	case "spdx":
+		doc = spdxDocument(repo, runID, created, mainModule, deps)
+	case "cyclonedx":
+		doc = cycloneDXDocument(created, mainModule, deps)
+	default:
+		return "", fmt.Errorf("unknown SBOM format %q", format)
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	filename := filepath.Join(baseDir, stateDirName, "sbom", runID, filepath.FromSlash(repo.Path)+"."+format+".json")
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return "", err
+	}
+	return filename, os.WriteFile(filename, append(b, '\n'), 0o644)
+}
+
+func listModules(dir string) ([]sbomModule, error) {
+	var buf bytes.Buffer
+	cmd, done := newCommand(context.Background(), "go", "list", "-m", "-json", "all")
+	cmd.Dir = dir
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	if err := done(runTraced(cmd)); err != nil {
+		return nil, fmt.Errorf("go list -m all failed: %w", err)
+	}
+
+	var modules []sbomModule
+	dec := json.NewDecoder(&buf)
+	for {
+		var m sbomModule
+		if err := dec.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				return modules, nil
+			}
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+}
+
+// spdxDocument returns an SPDX 2.3 document with the main module depending on
+// each of deps.
+func spdxDocument(repo repo, runID, created string, mainModule sbomModule, deps []sbomModule) map[string]any {
+	pkg := func(id string, m sbomModule) map[string]any {
+		p := map[string]any{
+			"name":             m.Path,
+			"SPDXID":           id,
+			"downloadLocation": "NOASSERTION",
+			"externalRefs": []map[string]string{{
+				"referenceCategory": "PACKAGE-MANAGER",
+				"referenceType":     "purl",
+				"referenceLocator":  m.purl(),
+			}},
+		}
+		if m.Version != "" {
+			p["versionInfo"] = m.Version
+		}
+		return p
+	}
+
+	packages := []map[string]any{pkg("SPDXRef-Package-main", mainModule)}
+	relationships := []map[string]string{{
+		"spdxElementId":      "SPDXRef-DOCUMENT",
+		"relationshipType":   "DESCRIBES",
+		"relatedSpdxElement": "SPDXRef-Package-main",
+	}}
+	for i, m := range deps {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		packages = append(packages, pkg(id, m))
+		relationships = append(relationships, map[string]string{
+			"spdxElementId":      "SPDXRef-Package-main",
+			"relationshipType":   "DEPENDS_ON",
+			"relatedSpdxElement": id,
+		})
+	}
+
+	return map[string]any{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              repo.Path,
+		"documentNamespace": githubWebURL(repo.Path + "/sbom/" + runID),
+		"creationInfo": map[string]any{
+			"created":  created,
+			"creators": []string{"Tool: mygithelper"},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
+
+// cycloneDXDocument returns a CycloneDX 1.5 BOM with the main module depending
+// on each of deps.
+func cycloneDXDocument(created string, mainModule sbomModule, deps []sbomModule) map[string]any {
+	var components []map[string]string
+	var dependsOn []string
+	for _, m := range deps {
+		components = append(components, map[string]string{
+			"type":    "library",
+			"bom-ref": m.purl(),
+			"name":    m.Path,
+			"version": m.Version,
+			"purl":    m.purl(),
+		})
+		dependsOn = append(dependsOn, m.purl())
+	}
+
+	return map[string]any{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.5",
+		"version":     1,
+		"metadata": map[string]any{
+			"timestamp": created,
+			"tools": map[string]any{
+				"components": []map[string]string{{"type": "application", "name": "mygithelper"}},
+			},
+			"component": map[string]string{
+				"type":    "application",
+				"bom-ref": mainModule.purl(),
+				"name":    mainModule.Path,
+				"purl":    mainModule.purl(),
+			},
+		},
+		"components":   components,
+		"dependencies": []map[string]any{{"ref": mainModule.purl(), "dependsOn": dependsOn}},
+	}
+}
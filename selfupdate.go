@@ -0,0 +1,287 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// --- Self-update command ---
+
+const selfRepo = "bep/mygithelper"
+
+type selfUpdateCmd struct {
+	Try bool
+}
+
+type githubRelease struct {
+	TagName string             `json:"tag_name"`
+	Assets  []releaseAssetInfo `json:"assets"`
+}
+
+type releaseAssetInfo struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+func (cmd *selfUpdateCmd) Run() error {
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+
+	var release githubRelease
+	if err := githubAPI("repos/"+selfRepo+"/releases/latest", &release); err != nil {
+		if !isNotFound(err) {
+			return fmt.Errorf("failed to get the latest release: %w", err)
+		}
+		// No releases yet, go install the latest tag or commit.
+		release.TagName = "latest"
+	}
+
+	current := currentVersion()
+	if current == release.TagName {
+		fmt.Printf("mygithelper %s is the latest release\n", current)
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	asset := releaseAsset(release)
+	if cmd.Try {
+		if asset != nil {
+			fmt.Printf("[dry-run] Would replace %s (%s) with %s from %s\n", exe, current, release.TagName, asset.BrowserDownloadURL)
+		} else {
+			fmt.Printf("[dry-run] Would go install %s@%s into %s (%s)\n", selfRepo, release.TagName, filepath.Dir(exe), current)
+		}
+		return nil
+	}
+
+	fmt.Printf("Updating mygithelper %s to %s...\n", current, release.TagName)
+	if asset == nil {
+		return goInstallSelf(exe, release.TagName)
+	}
+
+	archive, err := downloadReleaseAsset(asset.BrowserDownloadURL)
+	if err != nil {
+		return err
+	}
+	if err := verifyReleaseAsset(release, asset.Name, archive); err != nil {
+		return fmt.Errorf("not replacing %s: %w", exe, err)
+	}
+	binary, err := releaseBinary(asset.Name, archive)
+	if err != nil {
+		return err
+	}
+	if err := replaceExecutable(exe, binary); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", exe, err)
+	}
+	fmt.Printf("Updated %s to %s\n", exe, release.TagName)
+	return nil
+}
+
+// currentVersion returns the module version of the running binary, "(devel)"
+// for a local build.
+func currentVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// releaseAsset returns the archive for this OS and architecture, if the
+// release has one.
+func releaseAsset(release githubRelease) *releaseAssetInfo {
+	archNames := map[string][]string{
+		"amd64": {"amd64", "x86_64", "64bit"},
+		"arm64": {"arm64", "aarch64"},
+		"arm":   {"arm", "armv6", "armv7"},
+	}
+	arches := archNames[runtime.GOARCH]
+	if arches == nil {
+		arches = []string{runtime.GOARCH}
+	}
+	oses := []string{runtime.GOOS}
+	if runtime.GOOS == "darwin" {
+		oses = append(oses, "macos")
+	}
+
+	for i, a := range release.Assets {
+		name := strings.ToLower(a.Name)
+		if !strings.HasSuffix(name, ".tar.gz") && !strings.HasSuffix(name, ".zip") {
+			continue
+		}
+		if hasAnyToken(name, oses) && hasAnyToken(name, arches) {
+			return &release.Assets[i]
+		}
+	}
+	return nil
+}
+
+// hasAnyToken reports whether one of tokens is in name as a whole, between
+// the separators of an archive name (-, _ and .), so arm doesn't match arm64.
+func hasAnyToken(name string, tokens []string) bool {
+	isSep := func(c byte) bool { return c == '-' || c == '_' || c == '.' }
+	for _, token := range tokens {
+		for i := 0; i+len(token) <= len(name); i++ {
+			j := i + len(token)
+			if name[i:j] == token && (i == 0 || isSep(name[i-1])) && (j == len(name) || isSep(name[j])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// downloadTimeout limits how long downloading a release asset may take.
+const downloadTimeout = 5 * time.Minute
+
+// downloadReleaseAsset downloads a release asset.
+func downloadReleaseAsset(url string) ([]byte, error) {
+	fmt.Printf("Downloading %s...\n", url)
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyReleaseAsset checks the SHA-256 of the asset name against the
+// checksums file of the release (e.g. checksums.txt, as written by
+// GoReleaser). A release without one fails the check.
+func verifyReleaseAsset(release githubRelease, name string, content []byte) error {
+	var checksumsURL string
+	for _, a := range release.Assets {
+		if lower := strings.ToLower(a.Name); strings.HasSuffix(lower, "checksums.txt") || lower == "sha256sums" {
+			checksumsURL = a.BrowserDownloadURL
+			break
+		}
+	}
+	if checksumsURL == "" {
+		return fmt.Errorf("release %s has no checksums file to verify %s with", release.TagName, name)
+	}
+	checksums, err := downloadReleaseAsset(checksumsURL)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	for line := range strings.Lines(string(checksums)) {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		if !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+		fmt.Printf("Verified the SHA-256 of %s\n", name)
+		return nil
+	}
+	return fmt.Errorf("no checksum for %s in the checksums file of %s", name, release.TagName)
+}
+
+// releaseBinary returns the mygithelper binary in the release archive name.
+func releaseBinary(name string, archive []byte) ([]byte, error) {
+	isBinary := func(filename string) bool {
+		base := filepath.Base(filename)
+		return base == "mygithelper" || base == "mygithelper.exe"
+	}
+
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if !isBinary(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+		return nil, fmt.Errorf("no mygithelper binary in %s", name)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no mygithelper binary in %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && isBinary(hdr.Name) {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// replaceExecutable replaces exe with binary. The running executable is
+// moved aside first, which Windows allows while it runs.
+func replaceExecutable(exe string, binary []byte) error {
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, binary, 0o755); err != nil {
+		return err
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		os.Rename(old, exe)
+		return err
+	}
+	os.Remove(old)
+	return nil
+}
+
+// goInstallSelf builds the release with go install into the directory of
+// exe, for when there is no binary for this platform.
+func goInstallSelf(exe, tag string) error {
+	if filepath.Base(exe) != "mygithelper" && filepath.Base(exe) != "mygithelper.exe" {
+		return fmt.Errorf("no release binary for %s/%s and %s isn't named mygithelper; run go install github.com/%s@%s", runtime.GOOS, runtime.GOARCH, exe, selfRepo, tag)
+	}
+	c, done := newCommand(context.Background(), "go", "install", "github.com/"+selfRepo+"@"+tag)
+	c.Env = append(os.Environ(), "GOBIN="+filepath.Dir(exe))
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := done(runTraced(c)); err != nil {
+		return fmt.Errorf("go install failed: %w", err)
+	}
+	fmt.Printf("Installed %s %s\n", exe, tag)
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// --- Setup command ---
+
+type setupCmd struct {
+	BaseDir string
+	Config  *config
+}
+
+func (cmd *setupCmd) Run() error {
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Setting up mygithelper in %s\n", cmd.BaseDir)
+
+	fmt.Println("Fetching your repos from GitHub...")
+	ghRepos, err := githubAPIList[githubRepo]("user/repos?per_page=100&affiliation=owner,organization_member")
+	if err != nil {
+		return fmt.Errorf("failed to list repos: %w", err)
+	}
+	ghRepos = slices.DeleteFunc(ghRepos, func(r githubRepo) bool { return r.Archived })
+	slices.SortFunc(ghRepos, func(a, b githubRepo) int { return strings.Compare(a.FullName, b.FullName) })
+
+	if len(ghRepos) == 0 {
+		return fmt.Errorf("no repos found on GitHub for the authenticated user")
+	}
+
+	var selected []repo
+	var changed []string // The list files written
+	for {
+		// No answer finishes too.
+		group, _ := prompt("\nGroup name (directory below the base dir, empty to finish):")
+		if group == "" {
+			break
+		}
+		if strings.ContainsAny(group, `/\`) || group == "." || group == ".." {
+			fmt.Println("Group name must be a plain directory name")
+			continue
+		}
+
+		candidates := ghRepos
+		filter, err := prompt("Filter repos by name (empty for all):")
+		if err != nil {
+			return err
+		}
+		if filter != "" {
+			candidates = slices.DeleteFunc(slices.Clone(ghRepos), func(r githubRepo) bool {
+				return !strings.Contains(strings.ToLower(r.FullName), strings.ToLower(filter))
+			})
+		}
+		if len(candidates) == 0 {
+			fmt.Println("No repos match")
+			continue
+		}
+
+		for i, r := range candidates {
+			fmt.Printf("  %3d  %s\n", i+1, r.FullName)
+		}
+
+		answer, err := prompt("Select repos (e.g. 1,3,5-7 or all):")
+		if err != nil {
+			return err
+		}
+		indexes, err := parseSelection(answer, len(candidates))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(indexes) == 0 {
+			continue
+		}
+
+		var repoPaths []string
+		for _, i := range indexes {
+			repoPaths = append(repoPaths, candidates[i].FullName)
+		}
+
+		groupDir := filepath.Join(cmd.BaseDir, group)
+		filename, section := groupListFile(cmd.BaseDir, group)
+		added, err := addToGitjoin(filename, section, repoPaths)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %d repo(s) to %s\n", added, listFileName(cmd.BaseDir, filename, section))
+		changed = append(changed, filename)
+
+		for _, repoPath := range repoPaths {
+			repoName := repoNameFromPath(repoPath)
+			selected = append(selected, repo{Path: repoPath, Name: repoName, Dir: filepath.Join(groupDir, repoName), ListDir: groupDir})
+		}
+	}
+
+	protocol, err := prompt("\nClone over ssh or https? [ssh]")
+	if err != nil {
+		return err
+	}
+	switch protocol = strings.ToLower(protocol); protocol {
+	case "", "ssh":
+		cmd.Config.Protocol = ""
+	case "https":
+		cmd.Config.Protocol = "https"
+	default:
+		return fmt.Errorf("unknown protocol %q", protocol)
+	}
+
+	if err := saveConfig(cmd.BaseDir, cmd.Config); err != nil {
+		return fmt.Errorf("failed to write %s: %w", configFilename, err)
+	}
+	fmt.Printf("Wrote %s\n", configFilename)
+	cmd.Config.commitBaseChanges("Set up mygithelper", append(changed, filepath.Join(cmd.BaseDir, configFilename))...)
+
+	var missing []repo
+	for _, r := range selected {
+		if !dirExists(r.Dir) {
+			missing = append(missing, r)
+		}
+	}
+	if len(missing) == 0 || !confirm(fmt.Sprintf("Clone %d repo(s) now?", len(missing))) {
+		return nil
+	}
+
+	for _, r := range missing {
+		fmt.Printf("Cloning %s...\n", r.Path)
+		opts := cmd.Config.cloneOptions()
+		opts.Branch = cmd.Config.repo(r.Path).Branch
+		opts.Sparse = cmd.Config.repo(r.Path).SparseCheckout
+		if err := cloneRepo(r, cmd.Config.cloneURL(r.Path), opts); err != nil {
+			return fmt.Errorf("%s: failed to clone: %w", r.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// parseSelection parses a selection like "1,3,5-7" or "all" into zero-based
+// indexes into a list of n items.
+func parseSelection(s string, n int) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if s == "all" {
+		indexes := make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	var indexes []int
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		start, err1 := strconv.Atoi(strings.TrimSpace(from))
+		end, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || start < 1 || end > n || start > end {
+			return nil, fmt.Errorf("invalid selection %q", part)
+		}
+		for i := start; i <= end; i++ {
+			if !slices.Contains(indexes, i-1) {
+				indexes = append(indexes, i-1)
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// addToGitjoin adds the repo paths not already listed in section (see
+// groupListFile) to the list file, creating it and its directory if needed.
+// It returns the number of repos added.
+func addToGitjoin(filename, section string, repoPaths []string) (int, error) {
+	existing := map[string]bool{}
+	var excludes []string
+	if fileExists(filename) {
+		entries, err := parseListFile(filename)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		for _, e := range entries {
+			if e.Exclude {
+				// Keep excluded repos out instead of listing them again.
+				excludes = append(excludes, e.Text)
+				continue
+			}
+			if e.Section == section && !e.IncludeGroup {
+				existing[repoPathFromGitjoinLine(e.Text)] = true
+			}
+		}
+	}
+
+	var added []string
+	for _, repoPath := range repoPaths {
+		if existing[repoPath] || excluded(repoPath, excludes) {
+			continue
+		}
+		existing[repoPath] = true
+		added = append(added, "github.com/"+repoPath)
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	// Insert after the last line of the section, or before the first
+	// section for the repos of the file's own directory.
+	lines := strings.Split(strings.TrimSuffix(readFileOrEmpty(filename), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		lines = nil
+	}
+	insert := len(lines)
+	in := section == ""
+	for i, line := range lines {
+		name, ok := listSection(strings.TrimSpace(line))
+		switch {
+		case ok && in:
+			insert = i
+		case ok:
+			in = name == section
+			continue
+		default:
+			continue
+		}
+		break
+	}
+	for insert > 0 && strings.TrimSpace(lines[insert-1]) == "" {
+		insert--
+	}
+	lines = slices.Insert(lines, insert, added...)
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return 0, err
+	}
+	return len(added), os.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
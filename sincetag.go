@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// unreleasedDep is a dependency with commits on its default branch after its
+// latest tag.
+type unreleasedDep struct {
+	Module  string
+	Repo    string // GitHub path, e.g. "bep/firstupdotenv"
+	Tag     string
+	AheadBy int
+}
+
+var majorVersionSuffixRe = regexp.MustCompile(`^v[0-9]+$`)
+
+// unreleasedDeps returns the direct dependencies of the module in repoDir
+// that live in one of managed (GitHub paths of the repos we manage) and
+// have unreleased commits. Results are cached in cache, keyed by module.
+func unreleasedDeps(repoDir string, managed map[string]bool, cache map[string]*unreleasedDep) ([]unreleasedDep, error) {
+	mod, err := readGoMod(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []unreleasedDep
+	for _, req := range mod.Require {
+		if req.Indirect {
+			continue
+		}
+		repoPath, subdir, ok := githubModuleRepo(req.Path)
+		if !ok || !managed[repoPath] {
+			continue
+		}
+
+		dep, cached := cache[req.Path]
+		if !cached {
+			if dep, err = checkUnreleased(repoDir, req.Path, repoPath, subdir); err != nil {
+				return nil, fmt.Errorf("%s: %w", req.Path, err)
+			}
+			cache[req.Path] = dep
+		}
+		if dep != nil {
+			deps = append(deps, *dep)
+		}
+	}
+	return deps, nil
+}
+
+// githubModuleRepo splits a module path like github.com/bep/foo/sub/v2 into
+// the repo (bep/foo) and the module's directory in it (sub).
+func githubModuleRepo(modulePath string) (repoPath, subdir string, ok bool) {
+	rest, ok := strings.CutPrefix(modulePath, "github.com/")
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	subParts := parts[2:]
+	if n := len(subParts); n > 0 && majorVersionSuffixRe.MatchString(subParts[n-1]) {
+		subParts = subParts[:n-1]
+	}
+	return parts[0] + "/" + parts[1], strings.Join(subParts, "/"), true
+}
+
+// checkUnreleased returns the dependency if the default branch of repoPath
+// has commits after the latest version of modulePath, nil if not.
+func checkUnreleased(repoDir, modulePath, repoPath, subdir string) (*unreleasedDep, error) {
+	cmd, done := newCommand(context.Background(), "go", "list", "-m", "-json", modulePath+"@latest")
+	cmd.Dir = repoDir
+	rec := startExec(cmd)
+	out, err := cmd.Output()
+	rec.finish(err)
+	if err := done(err); err != nil {
+		return nil, fmt.Errorf("failed to find latest version: %w", err)
+	}
+	var latest struct {
+		Version string
+	}
+	if err := json.Unmarshal(out, &latest); err != nil {
+		return nil, err
+	}
+	if strings.Contains(latest.Version, "-0.") {
+		// A pseudo-version, the module has no tags.
+		return nil, nil
+	}
+
+	tag := latest.Version
+	if subdir != "" {
+		tag = subdir + "/" + tag
+	}
+
+	var gr struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := githubAPI("repos/"+repoPath, &gr); err != nil {
+		return nil, err
+	}
+	var compare struct {
+		AheadBy int `json:"ahead_by"`
+	}
+	if err := githubAPI(fmt.Sprintf("repos/%s/compare/%s...%s", repoPath, tag, gr.DefaultBranch), &compare); err != nil {
+		return nil, fmt.Errorf("failed to compare %s with %s: %w", tag, gr.DefaultBranch, err)
+	}
+	if compare.AheadBy == 0 {
+		return nil, nil
+	}
+	return &unreleasedDep{Module: modulePath, Repo: repoPath, Tag: tag, AheadBy: compare.AheadBy}, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// repoState is what we know about a clone that rarely changes, kept by repo
+// directory in .mygithelper/state.json so the next run doesn't have to ask
+// git again. Each value is stored with a stamp of the file it was read from
+// and dropped when that file changes.
+type repoState struct {
+	DefaultBranch string `json:"default_branch,omitempty"`
+
+	// OriginHEAD is the stamp of refs/remotes/origin/HEAD when
+	// DefaultBranch was read from it.
+	OriginHEAD string `json:"origin_head,omitempty"`
+}
+
+var state struct {
+	sync.Mutex
+	baseDir string
+	repos   map[string]repoState
+}
+
+func stateFilename(baseDir string) string {
+	return filepath.Join(baseDir, stateDirName, "state.json")
+}
+
+// initState loads the repo state in baseDir. A missing or unreadable file is
+// an empty state, it's only a cache.
+func initState(baseDir string) {
+	state.baseDir = baseDir
+	state.repos = map[string]repoState{}
+	if b, err := os.ReadFile(stateFilename(baseDir)); err == nil {
+		json.Unmarshal(b, &state.repos)
+	}
+}
+
+// stateKey returns the key of repoDir in the state, relative to the base dir
+// so the state survives moving it.
+func stateKey(repoDir string) string {
+	if rel, err := filepath.Rel(state.baseDir, repoDir); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return repoDir
+}
+
+func loadRepoState(repoDir string) repoState {
+	state.Lock()
+	defer state.Unlock()
+	return state.repos[stateKey(repoDir)]
+}
+
+// updateRepoState changes the state of repoDir with update and writes the
+// state file.
+func updateRepoState(repoDir string, update func(s *repoState)) {
+	state.Lock()
+	defer state.Unlock()
+	if state.baseDir == "" {
+		return
+	}
+	key := stateKey(repoDir)
+	s := state.repos[key]
+	update(&s)
+	state.repos[key] = s
+
+	b, err := json.MarshalIndent(state.repos, "", "  ")
+	if err != nil {
+		return
+	}
+	filename := stateFilename(state.baseDir)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return
+	}
+	// Write and rename, so a concurrent run never reads half a file.
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err == nil {
+		os.Rename(tmp, filename)
+	}
+}
+
+// fileStamp returns the modification time and size of filename, "" if it
+// doesn't exist, e.g. in a worktree, where .git is a file.
+func fileStamp(filename string) string {
+	info, err := os.Stat(filename)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// originHEADStamp returns the stamp of the origin/HEAD symbolic ref of the
+// clone in repoDir, which git remote set-head rewrites.
+func originHEADStamp(repoDir string) string {
+	return fileStamp(filepath.Join(repoDir, ".git", "refs", "remotes", "origin", "HEAD"))
+}
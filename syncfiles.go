@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// --- Sync files command ---
+
+// syncFilesCmd keeps shared files (LICENSE, CODEOWNERS, .golangci.yml etc.)
+// identical across repos. The files are rendered from the templates in the
+// templates dir as mapped by sync_files in the config, and changes are
+// submitted as PRs.
+type syncFilesCmd struct {
+	BaseDir   string
+	Config    *config
+	Try       bool
+	KeepGoing bool // Go on with the other repos when one fails
+	Worktree  bool // Work in temporary worktrees instead of the checkouts
+	Pick      bool // Interactively pick the repos to work on
+
+	runID   string
+	summary runSummary
+}
+
+func (cmd *syncFilesCmd) Run() error {
+	if len(cmd.Config.SyncFiles) == 0 {
+		return fmt.Errorf("no sync_files in %s", configFilename)
+	}
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+	if !cmd.Try {
+		if err := cmd.Config.checkSigning(cmd.BaseDir); err != nil {
+			return err
+		}
+	}
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+
+	if len(repos) == 0 {
+		fmt.Println("No repos found in gitjoin.txt files")
+		return nil
+	}
+
+	fmt.Printf("Found %d repos in gitjoin.txt files\n", len(repos))
+
+	if !cmd.Worktree {
+		if err := cmd.Config.checkReadiness(repos, cmd.KeepGoing); err != nil {
+			return err
+		}
+	}
+
+	cmd.runID = newRunID()
+	fmt.Printf("Run ID: %s\n", cmd.runID)
+	if cmd.Worktree {
+		defer removeRunWorkDir(cmd.BaseDir, cmd.runID)
+	}
+
+	err = forEachRepo(repos, cmd.KeepGoing, &cmd.summary, cmd.Config.withQuarantine(cmd.BaseDir, cmd.Try, func(repo repo) error {
+		err := cmd.syncRepo(repo)
+		if err != nil && !isSkipped(err) && !cmd.Try {
+			recordFailure(cmd.BaseDir, cmd.runID, repo.Path, err)
+		}
+		return err
+	}))
+	cmd.Config.trackPRs("sync-files", cmd.runID, cmd.summary.PRs)
+	cmd.Config.notifyRun("sync-files", cmd.runID, cmd.Try, &cmd.summary)
+	return err
+}
+
+func (cmd *syncFilesCmd) syncRepo(repo repo) error {
+	printSection("Syncing files in " + repo.Path)
+
+	if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+
+	if err := cmd.Config.checkArchived(repo, cmd.Try); err != nil {
+		return err
+	}
+
+	group := repoGroup(cmd.BaseDir, repo)
+
+	files := cmd.Config.syncFiles(group)
+	if len(files) == 0 {
+		fmt.Println("No files to sync for group " + group)
+		return nil
+	}
+
+	defaultBranch, err := cmd.Config.defaultBranch(repo)
+	if err != nil {
+		return fmt.Errorf("%s: failed to get default branch: %w", repo.Path, err)
+	}
+
+	if cmd.Worktree {
+		// Work in a throwaway worktree, leaving the user's checkout alone.
+		ws, err := newWorkspace(cmd.BaseDir, cmd.runID, repo, defaultBranch)
+		if err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		}
+		defer ws.Close()
+		repo.Dir = ws.Dir
+	} else {
+		cmd.Config.warnPinned(repo, defaultBranch)
+		if err := prepareCheckout(repo, defaultBranch, cmd.Config.PullStrategy); err != nil {
+			return err
+		}
+	}
+
+	data := newTemplateData(cmd.BaseDir, repo)
+
+	h := xxhash.New()
+	var changed []string
+	for _, target := range slices.Sorted(maps.Keys(files)) {
+		content, err := cmd.renderTemplate(files[target], data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		}
+		h.Write([]byte(target))
+		h.Write(content)
+
+		filename := filepath.Join(repo.Dir, filepath.FromSlash(target))
+		if existing, err := os.ReadFile(filename); err == nil && bytes.Equal(existing, content) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		}
+		if err := os.WriteFile(filename, content, 0o644); err != nil {
+			return fmt.Errorf("%s: failed to write %s: %w", repo.Path, target, err)
+		}
+		changed = append(changed, target)
+	}
+
+	if len(changed) == 0 {
+		fmt.Println("Files already in sync")
+		return nil
+	}
+
+	fmt.Printf("Updated %s\n", strings.Join(changed, ", "))
+
+	commitMsg, prBody, err := cmd.Config.prMessage("sync-files", data, "all: Sync shared files",
+		fmt.Sprintf("Updated files:\n\n- %s\n\n---\nCreated by mygithelper", strings.Join(changed, "\n- ")))
+	if err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+
+	// Dry-run: show what would be done and revert
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would commit: %s\n", commitMsg)
+		fmt.Printf("[dry-run] Would create PR: %s\n", commitMsg)
+		return cmd.revert(repo.Dir, changed)
+	}
+
+	branchName, err := cmd.Config.branchName("sync-files", h.Sum64(), data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	if branchExistsRemote(repo.Dir, branchName) {
+		fmt.Printf("Branch %s already exists, skipping\n", branchName)
+		if err := cmd.revert(repo.Dir, changed); err != nil {
+			return err
+		}
+		return skipRepo("branch %s already exists", branchName)
+	}
+
+	url, err := cmd.Config.commitAndCreatePR(repo, prChange{
+		Base:     defaultBranch,
+		Branch:   branchName,
+		Title:    commitMsg,
+		Body:     prBody,
+		Options:  cmd.Config.prOptions(repo.Path),
+		Worktree: cmd.Worktree,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", repo.Path, err)
+	}
+	cmd.summary.addPR(repo.Path, url)
+	addStepSummary(fmt.Sprintf("- %s: created PR %q", repo.Path, commitMsg))
+	if err := recordPR(cmd.BaseDir, cmd.runID, repo.Dir, repo.Path, branchName, commitMsg); err != nil {
+		fmt.Printf("Failed to record PR in run %s: %v\n", cmd.runID, err)
+	}
+
+	return nil
+}
+
+func (cmd *syncFilesCmd) renderTemplate(name string, data templateData) ([]byte, error) {
+	filename := filepath.Join(cmd.Config.templatesDir(cmd.BaseDir), filepath.FromSlash(name))
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// revert undoes the changes to the synced files, removing the new ones.
+func (cmd *syncFilesCmd) revert(repoDir string, changed []string) error {
+	if err := gitRun(repoDir, "checkout", "."); err != nil {
+		return fmt.Errorf("failed to revert changes: %w", err)
+	}
+	return gitRun(repoDir, append([]string{"clean", "-f", "--"}, changed...)...)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandTimeouts limit how long the git, gh, go and shell commands we start
+// may run, keyed by operation ("git fetch"), program ("gh") or "default".
+// The network operations have a limit by default so a flaky connection or an
+// SSH prompt can't stall a run forever.
+var commandTimeouts = map[string]time.Duration{
+	"git clone":     30 * time.Minute,
+	"git fetch":     10 * time.Minute,
+	"git pull":      10 * time.Minute,
+	"git push":      10 * time.Minute,
+	"git ls-remote": 5 * time.Minute,
+	"gh":            10 * time.Minute,
+}
+
+// applyTimeouts adds the timeouts from the config and the --timeout flag
+// (the default for all commands, "" if not set) to commandTimeouts.
+func (cfg *config) applyTimeouts(flag string) error {
+	for op, s := range cfg.Timeouts {
+		// Validated in loadConfig.
+		d, _ := time.ParseDuration(s)
+		commandTimeouts[op] = d
+	}
+	if flag != "" {
+		d, err := time.ParseDuration(flag)
+		if err != nil {
+			return fmt.Errorf("invalid --timeout: %w", err)
+		}
+		commandTimeouts["default"] = d
+	}
+	return nil
+}
+
+// commandOp returns the operation a command is, e.g. "git fetch" for
+// git -c core.sshCommand=... fetch origin. Commands run with the shell (for
+// the aliases) are classified by the program the shell runs, e.g. "gh pr"
+// for sh -ic 'gh pr create ...'.
+func commandOp(name string, args []string) string {
+	if len(args) == 2 && (args[0] == "-c" || args[0] == "-ic") {
+		if fields := strings.Fields(args[1]); len(fields) > 0 && isTimedProgram(fields[0]) {
+			return commandOp(fields[0], fields[1:])
+		}
+	}
+	if !isTimedProgram(name) {
+		return "shell"
+	}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-c" || arg == "-C":
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			return name + " " + arg
+		}
+	}
+	return name
+}
+
+func isTimedProgram(name string) bool {
+	return name == "git" || name == "gh" || name == "go"
+}
+
+// commandTimeout returns the timeout for the operation, 0 for none.
+func commandTimeout(op string) time.Duration {
+	program, _, _ := strings.Cut(op, " ")
+	for _, key := range []string{op, program, "default"} {
+		if d, ok := commandTimeouts[key]; ok {
+			return d
+		}
+	}
+	return 0
+}
+
+// newCommand returns the command to run name with args, which is killed
+// when it runs longer than its timeout or ctx is done. Pass the error from
+// running it through done, which releases the context and tells a timeout
+// apart from other failures.
+func newCommand(ctx context.Context, name string, args ...string) (cmd *exec.Cmd, done func(error) error) {
+	op := commandOp(name, args)
+	cancel := context.CancelFunc(func() {})
+	if timeout := commandTimeout(op); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	cmd = exec.CommandContext(ctx, name, args...)
+	// Don't wait forever for children (e.g. ssh) holding on to the output.
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	return cmd, func(err error) error {
+		defer cancel()
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s timed out after %s and was killed", op, time.Since(start).Round(time.Second))
+		}
+		return err
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// showTimings is set by --timings to print the slowest repos and steps at the
+// end of a run, to see where parallelism and caching would pay off.
+var showTimings bool
+
+// timingsTop is how many repos and steps --timings lists.
+const timingsTop = 10
+
+// timing is how long a repo, or a step in a repo, took.
+type timing struct {
+	Repo     string
+	Step     string
+	Duration time.Duration
+}
+
+// timings are recorded by forEachRepo for the repos and by printStep for the
+// steps, which last until the next step or section.
+var timings struct {
+	repos []timing
+	steps []timing
+	step  string
+	start time.Time
+}
+
+// startStepTiming ends the timing of the current step, if any, and starts
+// the one of step in the current repo.
+func startStepTiming(step string) {
+	endStepTiming()
+	timings.step, timings.start = step, time.Now()
+}
+
+func endStepTiming() {
+	if timings.step == "" {
+		return
+	}
+	timings.steps = append(timings.steps, timing{Repo: progress.repo, Step: timings.step, Duration: time.Since(timings.start)})
+	timings.step = ""
+}
+
+// printTimings prints the slowest repos and the steps that took the longest
+// in total, with --timings.
+func printTimings() {
+	endStepTiming()
+	if !showTimings || len(timings.repos) == 0 {
+		return
+	}
+
+	printSection("Timings")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	repos := slices.Clone(timings.repos)
+	slices.SortStableFunc(repos, func(a, b timing) int { return cmp.Compare(b.Duration, a.Duration) })
+	var total time.Duration
+	for _, t := range repos {
+		total += t.Duration
+	}
+	fmt.Fprintf(w, "Repos\t%d\t%s in total\n", len(repos), roundDuration(total))
+	for _, t := range repos[:min(len(repos), timingsTop)] {
+		fmt.Fprintf(w, "\t%s\t%s\n", roundDuration(t.Duration), t.Repo)
+	}
+
+	// Steps by name, over all repos.
+	type stepTotal struct {
+		Step    string
+		Total   time.Duration
+		Count   int
+		Slowest timing
+	}
+	var steps []*stepTotal
+	for _, t := range timings.steps {
+		i := slices.IndexFunc(steps, func(s *stepTotal) bool { return s.Step == t.Step })
+		if i < 0 {
+			steps = append(steps, &stepTotal{Step: t.Step})
+			i = len(steps) - 1
+		}
+		s := steps[i]
+		s.Total += t.Duration
+		s.Count++
+		if t.Duration > s.Slowest.Duration {
+			s.Slowest = t
+		}
+	}
+	slices.SortStableFunc(steps, func(a, b *stepTotal) int { return cmp.Compare(b.Total, a.Total) })
+	if len(steps) > 0 {
+		fmt.Fprintf(w, "Steps\t%d\t\n", len(steps))
+	}
+	for _, s := range steps[:min(len(steps), timingsTop)] {
+		fmt.Fprintf(w, "\t%s\t%s (%d repo(s), slowest %s in %s)\n", roundDuration(s.Total), s.Step, s.Count, roundDuration(s.Slowest.Duration), s.Slowest.Repo)
+	}
+	w.Flush()
+}
+
+// roundDuration rounds d for display, e.g. 1m23.4s or 250ms.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracing is turned on by setting OTEL_EXPORTER_OTLP_ENDPOINT (or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT), the same way as with the OpenTelemetry
+// SDKs. We then record a span for the command, one per repo section, one per
+// step and one per subprocess, and send them as OTLP/HTTP JSON when we exit.
+// OTEL_EXPORTER_OTLP_HEADERS (key=value,...) is sent with the request.
+
+// span is a timed operation in the trace.
+type span struct {
+	ID       string
+	ParentID string
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]string
+	Err      string
+}
+
+var tracer struct {
+	sync.Mutex
+	endpoint string
+	headers  map[string]string
+	traceID  string
+	open     []*span // Started spans, innermost last
+	done     []*span
+}
+
+// initTracing enables tracing if an OTLP endpoint is configured.
+func initTracing() {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return
+	}
+
+	tracer.endpoint = endpoint
+	tracer.headers = map[string]string{}
+	for kv := range strings.SplitSeq(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			tracer.headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	tracer.traceID = randomHex(16)
+	onExit(flushTraces)
+}
+
+// startSpan starts a span as a child of the innermost open span. It returns
+// nil if tracing is off; the span methods accept a nil span.
+func startSpan(name string, attrs ...string) *span {
+	tracer.Lock()
+	defer tracer.Unlock()
+	if tracer.endpoint == "" {
+		return nil
+	}
+
+	s := &span{ID: randomHex(8), Name: name, Start: time.Now(), Attrs: map[string]string{}}
+	if len(tracer.open) > 0 {
+		s.ParentID = tracer.open[len(tracer.open)-1].ID
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.Attrs[attrs[i]] = attrs[i+1]
+	}
+	tracer.open = append(tracer.open, s)
+	return s
+}
+
+// finish ends s, marking it failed if err is set, and any spans started
+// inside it that are still open.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	tracer.Lock()
+	defer tracer.Unlock()
+
+	i := slices.Index(tracer.open, s)
+	if i < 0 {
+		return
+	}
+	if err != nil {
+		s.Err = err.Error()
+	}
+	now := time.Now()
+	for _, o := range slices.Backward(tracer.open[i:]) {
+		o.End = now
+		tracer.done = append(tracer.done, o)
+	}
+	tracer.open = tracer.open[:i]
+}
+
+// runTraced runs cmd in a span and logs it.
+func runTraced(cmd *exec.Cmd) error {
+	rec := startExec(cmd)
+	err := cmd.Run()
+	rec.finish(err)
+	return err
+}
+
+// flushTraces ends all open spans and sends the trace to the OTLP endpoint.
+func flushTraces() {
+	tracer.Lock()
+	if len(tracer.open) > 0 {
+		root := tracer.open[0]
+		tracer.Unlock()
+		root.finish(nil)
+		tracer.Lock()
+	}
+	spans := tracer.done
+	tracer.done = nil
+	tracer.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+	if err := exportSpans(spans); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export traces to %s: %v\n", tracer.endpoint, err)
+	}
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpAttributes(attrs map[string]string) []otlpKeyValue {
+	var kvs []otlpKeyValue
+	for _, k := range slices.Sorted(maps.Keys(attrs)) {
+		kv := otlpKeyValue{Key: k}
+		kv.Value.StringValue = attrs[k]
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
+
+// exportSpans sends spans to the OTLP endpoint using the JSON encoding.
+func exportSpans(spans []*span) error {
+	type otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	type otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+
+	var out []otlpSpan
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           tracer.traceID,
+			SpanID:            s.ID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              1, // Internal
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attrs),
+		}
+		if s.Err != "" {
+			o.Status = otlpStatus{Code: 2, Message: s.Err}
+		}
+		out = append(out, o)
+	}
+
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttributes(map[string]string{"service.name": "mygithelper"}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "mygithelper"},
+				"spans": out,
+			}},
+		}},
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", tracer.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range tracer.headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
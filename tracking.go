@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// trackingIssue is the subset of the GitHub API issue object we use.
+type trackingIssue struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+// trackPRs adds the PRs created in a run of command to the open tracking
+// issue for the command in the tracking repo, creating the issue if needed.
+func (cfg *config) trackPRs(command, runID string, prs []summaryEntry) {
+	if cfg.TrackingRepo == "" || len(prs) == 0 {
+		return
+	}
+	if err := cfg.updateTrackingIssue(command, runID, prs); err != nil {
+		fmt.Printf("Failed to update the tracking issue in %s: %v\n", cfg.TrackingRepo, err)
+	}
+}
+
+func (cfg *config) updateTrackingIssue(command, runID string, prs []summaryEntry) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Run %s (%s)\n\n", runID, time.Now().Format(time.DateOnly))
+	for _, pr := range prs {
+		fmt.Fprintf(&b, "- [ ] %s %s\n", pr.Repo, pr.Detail)
+	}
+	section := b.String()
+
+	title := "mygithelper " + command + " rollout"
+	issues, err := githubAPIList[trackingIssue]("repos/" + cfg.TrackingRepo + "/issues?state=open&per_page=100")
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		if issue.Title != title {
+			continue
+		}
+		body := strings.TrimRight(issue.Body, "\n") + "\n\n" + section
+		if err := githubRequest("PATCH", fmt.Sprintf("repos/%s/issues/%d", cfg.TrackingRepo, issue.Number), map[string]string{"body": body}, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Added %d PR(s) to %s\n", len(prs), issue.HTMLURL)
+		return nil
+	}
+
+	body := fmt.Sprintf("PRs created by `mygithelper %s`, checked off as they are merged. Close the issue to start a new one.\n\n%s", command, section)
+	var issue trackingIssue
+	if err := githubRequest("POST", "repos/"+cfg.TrackingRepo+"/issues", map[string]string{"title": title, "body": body}, &issue); err != nil {
+		return err
+	}
+	fmt.Printf("Opened %s with %d PR(s)\n", issue.HTMLURL, len(prs))
+	return nil
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// --- Transaction command ---
+
+// A transaction is a change spanning several repos that must land together,
+// e.g. an API change in a library and the fixes in the repos using it:
+//
+//	mygithelper transaction open <name> --title <title>
+//	mygithelper transaction status <name>
+//	mygithelper transaction merge <name>
+//
+// open commits the uncommitted changes in the repos (or the picked ones) to
+// a branch per repo and opens PRs that link to each other. merge merges them
+// in dependency order, but only once all of them are green.
+
+// txRecord is a transaction, stored in .mygithelper/transactions/<name>.json.
+type txRecord struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	PRs   []txPR `json:"prs"` // In merge order
+}
+
+type txPR struct {
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
+type transactionCmd struct {
+	BaseDir string
+	Config  *config
+	Action  string // open, status or merge
+	Name    string
+	Title   string
+	Pick    bool
+	Try     bool
+}
+
+func (cmd *transactionCmd) Run() error {
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, `/\ `) {
+		return fmt.Errorf("invalid transaction name %q", cmd.Name)
+	}
+
+	switch cmd.Action {
+	case "open":
+		return cmd.open()
+	case "status":
+		rec, err := loadTxRecord(cmd.BaseDir, cmd.Name)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.checkPRs(rec)
+		return err
+	case "merge":
+		return cmd.merge()
+	default:
+		return fmt.Errorf("unknown transaction action %q, must be open, status or merge", cmd.Action)
+	}
+}
+
+func txRecordFilename(baseDir, name string) string {
+	return filepath.Join(baseDir, stateDirName, "transactions", name+".json")
+}
+
+func loadTxRecord(baseDir, name string) (*txRecord, error) {
+	b, err := os.ReadFile(txRecordFilename(baseDir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no transaction named %q", name)
+		}
+		return nil, err
+	}
+	var rec txRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse transaction %s: %w", name, err)
+	}
+	return &rec, nil
+}
+
+func saveTxRecord(baseDir string, rec *txRecord) error {
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := txRecordFilename(baseDir, rec.Name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0o644)
+}
+
+func (cmd *transactionCmd) open() error {
+	if cmd.Title == "" {
+		return errors.New("transaction open needs a --title")
+	}
+	if _, err := loadTxRecord(cmd.BaseDir, cmd.Name); err == nil {
+		return fmt.Errorf("transaction %q already exists", cmd.Name)
+	}
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+
+	var changed []repo
+	for _, r := range repos {
+		if dirty, _, err := checkUncommitted(r.Dir); err != nil {
+			return err
+		} else if dirty {
+			changed = append(changed, r)
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Println("No repos with uncommitted changes")
+		return nil
+	}
+
+	changed, err = sortByDependencies(changed)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Merge order:\n")
+	for i, r := range changed {
+		fmt.Printf("  %d. %s\n", i+1, r.Path)
+	}
+	if cmd.Try {
+		fmt.Printf("[dry-run] Would open %d PRs: %s\n", len(changed), cmd.Title)
+		return nil
+	}
+
+	rec := &txRecord{Name: cmd.Name, Title: cmd.Title}
+	defer restoreDefaultIdentity()
+	for _, r := range changed {
+		printSection("Opening PR in " + r.Path)
+
+		if err := cmd.Config.useIdentity(cmd.BaseDir, r); err != nil {
+			return fmt.Errorf("%s: %w", r.Path, err)
+		}
+		defaultBranch, err := cmd.Config.defaultBranch(r)
+		if err != nil {
+			return fmt.Errorf("%s: failed to get default branch: %w", r.Path, err)
+		}
+		branchName, err := cmd.Config.branchName("transaction", xxhash.Sum64String(cmd.Name), newTemplateData(cmd.BaseDir, r))
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Path, err)
+		}
+		opts := cmd.Config.prOptions(r.Path)
+		opts.AutoMerge = false // The PRs are merged together by transaction merge.
+		if _, err := cmd.Config.commitAndCreatePR(r, prChange{
+			Base:    defaultBranch,
+			Branch:  branchName,
+			Title:   cmd.Title,
+			Body:    "Created by mygithelper",
+			Options: opts,
+		}); err != nil {
+			return fmt.Errorf("%s: %w", r.Path, err)
+		}
+		pr, err := findPR(r.Path, branchName)
+		if err != nil || pr == nil {
+			return fmt.Errorf("%s: failed to find the created PR: %v", r.Path, err)
+		}
+		rec.PRs = append(rec.PRs, txPR{Repo: r.Path, Branch: branchName, Number: pr.Number, URL: pr.HTMLURL})
+
+		// Save as we go, so a failure halfway leaves a record of the PRs.
+		if err := saveTxRecord(cmd.BaseDir, rec); err != nil {
+			return err
+		}
+	}
+	endSection()
+
+	// Now that we know all of them, link the PRs to each other.
+	fmt.Println("Linking the PRs...")
+	body := txBody(rec)
+	for _, pr := range rec.PRs {
+		if err := githubRequest("PATCH", fmt.Sprintf("repos/%s/pulls/%d", pr.Repo, pr.Number), map[string]string{"body": body}, nil); err != nil {
+			return fmt.Errorf("%s: failed to update PR description: %w", pr.Repo, err)
+		}
+	}
+
+	fmt.Printf("Opened %d PRs, merge them with: mygithelper transaction merge %s\n", len(rec.PRs), rec.Name)
+	return nil
+}
+
+// txBody returns the PR description listing all the PRs of rec.
+func txBody(rec *txRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Part of the transaction %q, which must land together. Merge order:\n\n", rec.Name)
+	for i, pr := range rec.PRs {
+		fmt.Fprintf(&b, "%d. %s#%d\n", i+1, pr.Repo, pr.Number)
+	}
+	b.WriteString("\n---\nCreated by mygithelper")
+	return b.String()
+}
+
+// checkPRs prints the status of the PRs in rec and reports whether all of
+// them are open, mergeable and have passing checks.
+func (cmd *transactionCmd) checkPRs(rec *txRecord) (green bool, err error) {
+	green = true
+	for _, tp := range rec.PRs {
+		var pr githubPR
+		if err := githubAPI(fmt.Sprintf("repos/%s/pulls/%d", tp.Repo, tp.Number), &pr); err != nil {
+			return false, fmt.Errorf("%s: %w", tp.Repo, err)
+		}
+
+		status := "ready"
+		switch {
+		case pr.MergedAt != "":
+			status = "merged"
+		case pr.State != "open":
+			status = "closed"
+			green = false
+		case pr.Mergeable != nil && !*pr.Mergeable:
+			status = "has conflicts"
+			green = false
+		default:
+			checks, err := checksStatus(tp.Repo, pr.Head.SHA)
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", tp.Repo, err)
+			}
+			if checks != "success" {
+				status = "checks " + checks
+				green = false
+			}
+		}
+		fmt.Printf("  %-40s %s\n", fmt.Sprintf("%s#%d", tp.Repo, tp.Number), status)
+	}
+	return green, nil
+}
+
+// checksStatus returns "success", "pending" or "failure" for the check runs
+// and commit statuses of sha.
+func checksStatus(repoPath, sha string) (string, error) {
+	var runs struct {
+		CheckRuns []struct {
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_runs"`
+	}
+	if err := githubAPI(fmt.Sprintf("repos/%s/commits/%s/check-runs?per_page=100", repoPath, sha), &runs); err != nil {
+		return "", err
+	}
+	var combined struct {
+		State      string `json:"state"`
+		TotalCount int    `json:"total_count"`
+	}
+	if err := githubAPI(fmt.Sprintf("repos/%s/commits/%s/status", repoPath, sha), &combined); err != nil {
+		return "", err
+	}
+
+	status := "success"
+	for _, r := range runs.CheckRuns {
+		switch {
+		case r.Status != "completed":
+			status = "pending"
+		case !slices.Contains([]string{"success", "neutral", "skipped"}, r.Conclusion):
+			return "failure", nil
+		}
+	}
+	if combined.TotalCount > 0 {
+		switch combined.State {
+		case "failure", "error":
+			return "failure", nil
+		case "pending":
+			status = "pending"
+		}
+	}
+	return status, nil
+}
+
+func (cmd *transactionCmd) merge() error {
+	rec, err := loadTxRecord(cmd.BaseDir, cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	green, err := cmd.checkPRs(rec)
+	if err != nil {
+		return err
+	}
+	if !green {
+		return fmt.Errorf("not all PRs in %s are ready, nothing merged", rec.Name)
+	}
+
+	for _, tp := range rec.PRs {
+		var pr githubPR
+		if err := githubAPI(fmt.Sprintf("repos/%s/pulls/%d", tp.Repo, tp.Number), &pr); err != nil {
+			return fmt.Errorf("%s: %w", tp.Repo, err)
+		}
+		if pr.MergedAt != "" {
+			continue
+		}
+		if cmd.Try {
+			fmt.Printf("[dry-run] Would merge %s\n", tp.URL)
+			continue
+		}
+		fmt.Printf("Merging %s...\n", tp.URL)
+		req := map[string]string{"merge_method": "squash", "sha": pr.Head.SHA}
+		if err := githubRequest("PUT", fmt.Sprintf("repos/%s/pulls/%d/merge", tp.Repo, tp.Number), req, nil); err != nil {
+			return fmt.Errorf("%s: failed to merge, the PRs before it in the merge order are merged: %w", tp.Repo, err)
+		}
+	}
+
+	return nil
+}
+
+// sortByDependencies sorts repos so that every repo comes after the repos
+// whose Go modules it requires.
+func sortByDependencies(repos []repo) ([]repo, error) {
+	modules := map[string]int{} // module path -> index in repos
+	requires := make([][]string, len(repos))
+	for i, r := range repos {
+		if !hasGoMod(r.Dir) {
+			continue
+		}
+		mi, err := readGoMod(r.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Path, err)
+		}
+		modules[mi.Module.Path] = i
+		for _, req := range mi.Require {
+			requires[i] = append(requires[i], req.Path)
+		}
+	}
+
+	var sorted []repo
+	state := make([]int, len(repos)) // 0: new, 1: visiting, 2: done
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("dependency cycle involving %s", repos[i].Path)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, req := range requires[i] {
+			if j, ok := modules[req]; ok && j != i {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = 2
+		sorted = append(sorted, repos[i])
+		return nil
+	}
+	for i := range repos {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// --- Validate command ---
+
+type validateCmd struct {
+	BaseDir string
+}
+
+func (cmd *validateCmd) Run() error {
+	files, err := findGitjoinFiles(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No gitjoin.txt files found")
+		return nil
+	}
+
+	var problems []string
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	seen := map[string]string{} // repo path -> first location
+	listed := map[string]bool{} // location and section
+	var repoPaths []string
+	for _, filename := range files {
+		entries, err := parseListFile(filename)
+		if err != nil {
+			problemf("%v", err)
+			continue
+		}
+		for _, e := range entries {
+			if e.Exclude || e.IncludeGroup {
+				continue
+			}
+			location := e.Pos.String()
+			repoPath := repoPathFromGitjoinLine(e.Text)
+			if repoPath == "" || repoNameFromPath(repoPath) == "" || strings.HasPrefix(repoPath, "/") || strings.HasSuffix(repoPath, "/") {
+				problemf("%s: malformed entry %q, expected github.com/owner/name", location, e.Text)
+				continue
+			}
+			if listed[location+"\n"+e.Section] {
+				// The same line included more than once into the same group.
+				continue
+			}
+			listed[location+"\n"+e.Section] = true
+			if first, ok := seen[repoPath]; ok {
+				problemf("%s: duplicate entry %s, first listed at %s", location, repoPath, first)
+				continue
+			}
+			seen[repoPath] = location
+			repoPaths = append(repoPaths, repoPath)
+		}
+	}
+
+	fmt.Printf("Checked %d entries in %d gitjoin.txt files\n", len(repoPaths), len(files))
+
+	if repos, err := listRepos(cmd.BaseDir); err == nil {
+		for _, c := range dirCollisions(repos) {
+			problemf("%s", c)
+		}
+		stale, err := unlistedClones(files, repos)
+		if err != nil {
+			return err
+		}
+		for _, dir := range stale {
+			rel, _ := filepath.Rel(cmd.BaseDir, dir)
+			problemf("%s: stale clone, not listed in a gitjoin.txt", filepath.ToSlash(rel))
+		}
+	}
+
+	if err := requireGitHub(); err != nil {
+		fmt.Printf("Skipping check for repos missing on GitHub: %v\n", err)
+	} else {
+		fmt.Println("Checking that all repos exist on GitHub...")
+		for _, repoPath := range repoPaths {
+			var r githubRepo
+			if err := githubAPI("repos/"+repoPath, &r); err != nil {
+				problemf("%s: %s not found on GitHub: %v", seen[repoPath], repoPath, err)
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	return fmt.Errorf("found %d problem(s)", len(problems))
+}
+
+// unlistedClones returns the git repos below the directories of the
+// gitjoin.txt files that none of them list. It looks into nested directories
+// (e.g. tools/foo), but not into repos or the directories of other
+// gitjoin.txt files.
+func unlistedClones(files []string, repos []repo) ([]string, error) {
+	listed := map[string]bool{}
+	for _, r := range repos {
+		listed[r.Dir] = true
+	}
+	groups := map[string]bool{}
+	for _, filename := range files {
+		groups[filepath.Dir(filename)] = true
+	}
+
+	var stale []string
+	for groupDir := range groups {
+		err := filepath.WalkDir(groupDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() || path == groupDir {
+				return nil
+			}
+			if d.Name() == ".git" || d.Name() == stateDirName || groups[path] {
+				return filepath.SkipDir
+			}
+			if !isCheckout(path) {
+				return nil
+			}
+			if !listed[path] {
+				stale = append(stale, path)
+			}
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(stale)
+	return stale, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// --- Verify actions command ---
+
+// verifyActionsCmd checks that the actions used in the workflows of all repos
+// still resolve on GitHub: the action repo exists and isn't archived, the
+// pinned ref exists, and a SHA pinned with a "# tag" comment is still what
+// the tag points to.
+type verifyActionsCmd struct {
+	BaseDir string
+	Config  *config
+	Pick    bool // Interactively pick the repos to work on
+
+	repos map[string]actionRepoStatus
+	refs  map[string]actionRefStatus // Keyed by repo@ref
+}
+
+type actionRepoStatus struct {
+	Missing  bool
+	Archived bool
+	Err      error
+}
+
+type actionRefStatus struct {
+	SHA string // Empty if the ref doesn't exist
+	Err error
+}
+
+var shaRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func (cmd *verifyActionsCmd) Run() error {
+	if err := requireGitHub(); err != nil {
+		return err
+	}
+
+	repos, err := findRepos(cmd.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Pick {
+		if repos, err = pickRepos(repos); err != nil {
+			return err
+		}
+	}
+
+	cmd.repos = map[string]actionRepoStatus{}
+	cmd.refs = map[string]actionRefStatus{}
+
+	var problems []string
+	var checked int
+	defer restoreDefaultIdentity()
+	for _, repo := range repos {
+		if err := cmd.Config.useIdentity(cmd.BaseDir, repo); err != nil {
+			return fmt.Errorf("%s: %w", repo.Path, err)
+		}
+		for _, name := range workflowFiles(repo.Dir) {
+			content, err := os.ReadFile(filepath.Join(repo.Dir, ".github", "workflows", name))
+			if err != nil {
+				return err
+			}
+			for i, line := range strings.Split(string(content), "\n") {
+				m := usesRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+				if m == nil {
+					continue
+				}
+				checked++
+				location := fmt.Sprintf("%s: .github/workflows/%s:%d", repo.Path, name, i+1)
+				if problem := cmd.verify(m[3], m[5], m[7]); problem != "" {
+					problems = append(problems, location+": "+problem)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Checked %d action references in %d repos\n", checked, len(repos))
+
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	return fmt.Errorf("found %d problem(s)", len(problems))
+}
+
+// verify checks a single action reference and returns a description of the
+// problem, if any. comment is the rest of the uses: line, e.g. " # v4.2.2".
+func (cmd *verifyActionsCmd) verify(repo, ref, comment string) string {
+	rs, ok := cmd.repos[repo]
+	if !ok {
+		var r githubRepo
+		err := githubAPI("repos/"+repo, &r)
+		switch {
+		case isNotFound(err):
+			rs.Missing = true
+		case err != nil:
+			rs.Err = err
+		default:
+			rs.Archived = r.Archived
+		}
+		cmd.repos[repo] = rs
+	}
+	switch {
+	case rs.Err != nil:
+		return fmt.Sprintf("failed to look up %s: %v", repo, rs.Err)
+	case rs.Missing:
+		return fmt.Sprintf("action %s not found", repo)
+	}
+
+	var problems []string
+	if rs.Archived {
+		problems = append(problems, fmt.Sprintf("action %s is archived", repo))
+	}
+
+	target := cmd.resolve(repo, ref)
+	switch {
+	case target.Err != nil:
+		problems = append(problems, fmt.Sprintf("failed to resolve %s@%s: %v", repo, ref, target.Err))
+	case target.SHA == "" && shaRe.MatchString(ref):
+		problems = append(problems, fmt.Sprintf("commit %s not found in %s", ref, repo))
+	case target.SHA == "":
+		problems = append(problems, fmt.Sprintf("%s not found in %s (deleted?)", ref, repo))
+	}
+
+	// The tag in a "<sha> # <tag>" pin should still point to the SHA.
+	if tag := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(comment), "#")); shaRe.MatchString(ref) && tag != "" {
+		tag = strings.Fields(tag)[0]
+		tagTarget := cmd.resolve(repo, tag)
+		switch {
+		case tagTarget.Err != nil:
+			problems = append(problems, fmt.Sprintf("failed to resolve %s@%s: %v", repo, tag, tagTarget.Err))
+		case tagTarget.SHA == "":
+			problems = append(problems, fmt.Sprintf("pinned tag %s no longer exists in %s", tag, repo))
+		case tagTarget.SHA != ref:
+			problems = append(problems, fmt.Sprintf("tag %s in %s now points to %s, not the pinned %s (moved or force-pushed)", tag, repo, tagTarget.SHA, ref))
+		}
+	}
+
+	return strings.Join(problems, "; ")
+}
+
+// resolve returns the commit ref (a SHA, tag or branch) refers to in repo.
+func (cmd *verifyActionsCmd) resolve(repo, ref string) actionRefStatus {
+	key := repo + "@" + ref
+	if s, ok := cmd.refs[key]; ok {
+		return s
+	}
+	var s actionRefStatus
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	err := githubAPI(fmt.Sprintf("repos/%s/commits/%s", repo, ref), &commit)
+	switch {
+	case isNotFound(err):
+	case err != nil:
+		s.Err = err
+	default:
+		s.SHA = commit.SHA
+	}
+	cmd.refs[key] = s
+	return s
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setGoVersionMatrix sets every go-version list in the workflow to versions
+// (matrix entries, e.g. "1.26.x"). The YAML is parsed to find the lists, but
+// only their text is replaced, leaving the rest of the file, including
+// comments and formatting, as is. Lists that already hold versions, scalar
+// go-version values (e.g. ${{ matrix.go-version }}) and go-version-file are
+// left alone.
+func setGoVersionMatrix(content []byte, versions []string) ([]byte, bool, error) {
+	lists, err := goVersionListNodes(content)
+	if err != nil {
+		return nil, false, err
+	}
+
+	text := string(content)
+	idx := newLineIndex(text)
+
+	var edits []textEdit
+
+	for _, list := range lists {
+		var current []string
+		for _, item := range list.Content {
+			current = append(current, item.Value)
+		}
+		if slices.Equal(current, versions) {
+			continue
+		}
+
+		quoted := make([]string, len(versions))
+		for i, v := range versions {
+			switch list.Content[0].Style {
+			case yaml.DoubleQuotedStyle:
+				quoted[i] = `"` + v + `"`
+			case yaml.SingleQuotedStyle:
+				quoted[i] = `'` + v + `'`
+			default:
+				quoted[i] = v
+			}
+		}
+
+		// Replace the items in place and add or drop the ones at the end,
+		// so comments between and after the items stay.
+		items := list.Content
+		ends := make([]int, len(items))
+		for i, item := range items {
+			start := idx.offset(item.Line, item.Column)
+			end, err := scalarEnd(text, start, item)
+			if err != nil {
+				return nil, false, fmt.Errorf("line %d: %w", item.Line, err)
+			}
+			ends[i] = end
+			if i < len(quoted) {
+				edits = append(edits, textEdit{start, end, quoted[i]})
+			}
+		}
+		last := items[len(items)-1]
+		switch {
+		case len(quoted) > len(items) && list.Style&yaml.FlowStyle != 0:
+			// [1.25.x, 1.26.x], possibly spanning lines.
+			at := ends[len(items)-1]
+			edits = append(edits, textEdit{at, at, ", " + strings.Join(quoted[len(items):], ", ")})
+		case len(quoted) > len(items):
+			// One "- version" line per item, indented like the last.
+			lineStart := idx.starts[last.Line-1]
+			line := text[lineStart:idx.lineEnd(last.Line)]
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			at, newline := idx.lineEnd(last.Line), "\n"
+			if strings.HasSuffix(line, "\r") {
+				at, newline = at-1, "\r\n"
+			}
+			var added strings.Builder
+			for _, q := range quoted[len(items):] {
+				added.WriteString(newline + indent + "- " + q)
+			}
+			edits = append(edits, textEdit{at, at, added.String()})
+		case len(quoted) < len(items) && list.Style&yaml.FlowStyle != 0:
+			edits = append(edits, textEdit{ends[len(quoted)-1], ends[len(items)-1], ""})
+		case len(quoted) < len(items):
+			keep := items[len(quoted)-1]
+			at, end := idx.lineEnd(keep.Line), idx.lineEnd(last.Line)
+			if strings.HasSuffix(text[:at], "\r") {
+				at--
+			}
+			if strings.HasSuffix(text[:end], "\r") {
+				end--
+			}
+			edits = append(edits, textEdit{at, end, ""})
+		}
+	}
+
+	if len(edits) == 0 {
+		return content, false, nil
+	}
+	return []byte(applyEdits(text, edits)), true, nil
+}
+
+// scalarEnd returns the offset where the scalar item starting at start ends.
+func scalarEnd(text string, start int, item *yaml.Node) (int, error) {
+	var token string
+	switch item.Style {
+	case yaml.DoubleQuotedStyle:
+		token = `"` + item.Value + `"`
+	case yaml.SingleQuotedStyle:
+		token = `'` + item.Value + `'`
+	default:
+		token = item.Value
+	}
+	if !strings.HasPrefix(text[start:], token) {
+		return 0, fmt.Errorf("unexpected go-version entry %q", item.Value)
+	}
+	return start + len(token), nil
+}
+
+// lineIndex maps the 1-based lines and columns yaml.Node reports to byte
+// offsets in the text it was parsed from.
+type lineIndex struct {
+	text   string
+	starts []int
+}
+
+func newLineIndex(text string) lineIndex {
+	starts := []int{0}
+	for i, c := range text {
+		if c == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return lineIndex{text: text, starts: starts}
+}
+
+// offset returns the byte offset of a 1-based line and (rune) column.
+func (idx lineIndex) offset(line, col int) int {
+	start := idx.starts[line-1]
+	rest := idx.text[start:]
+	for i := range rest {
+		if col == 1 {
+			return start + i
+		}
+		col--
+	}
+	return len(idx.text)
+}
+
+// lineEnd returns the offset of the newline ending a 1-based line.
+func (idx lineIndex) lineEnd(line int) int {
+	if line < len(idx.starts) {
+		return idx.starts[line] - 1
+	}
+	return len(idx.text)
+}
+
+// textEdit replaces text[start:end].
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// applyEdits applies non-overlapping edits to text.
+func applyEdits(text string, edits []textEdit) string {
+	// Apply from the end so earlier offsets stay valid.
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		text = text[:e.start] + e.text + text[e.end:]
+	}
+	return text
+}
+
+// goVersionListNodes returns the non-empty go-version lists in the workflow.
+func goVersionListNodes(content []byte) ([]*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	var lists []*yaml.Node
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				if key.Value == "go-version" && value.Kind == yaml.SequenceNode && len(value.Content) > 0 {
+					lists = append(lists, value)
+				}
+			}
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(&doc)
+	return lists, nil
+}
+
+// goVersionLists returns the values of the go-version lists in the workflow.
+func goVersionLists(content []byte) [][]string {
+	lists, err := goVersionListNodes(content)
+	if err != nil {
+		return nil
+	}
+	var values [][]string
+	for _, list := range lists {
+		var versions []string
+		for _, item := range list.Content {
+			versions = append(versions, item.Value)
+		}
+		values = append(values, versions)
+	}
+	return values
+}
+
+// setRunnerLabels renames the runner labels the jobs in the workflow run on,
+// by labels (old label to new, e.g. "linux-x64" to "linux-x64-v2"). All the
+// forms of runs-on are understood:
+//
+//	runs-on: ubuntu-latest
+//	runs-on: [self-hosted, linux]
+//	runs-on:
+//	  group: build-pool
+//	  labels: [self-hosted, linux]
+//
+// where a runner group is renamed like a label. As with the go-version lists,
+// only the text of the labels is replaced. Expressions (e.g. ${{ matrix.os }})
+// and labels not in labels are left alone.
+func setRunnerLabels(content []byte, labels map[string]string) ([]byte, bool, error) {
+	nodes, err := runnerLabelNodes(content)
+	if err != nil {
+		return nil, false, err
+	}
+
+	text := string(content)
+	idx := newLineIndex(text)
+	var edits []textEdit
+	for _, n := range nodes {
+		to, ok := labels[n.Value]
+		if !ok || to == n.Value {
+			continue
+		}
+		var quote string
+		switch n.Style {
+		case yaml.DoubleQuotedStyle:
+			quote = `"`
+		case yaml.SingleQuotedStyle:
+			quote = `'`
+		case 0, yaml.FlowStyle:
+		default:
+			continue
+		}
+		// Leave labels written with escapes or folded alone.
+		start := idx.offset(n.Line, n.Column)
+		raw := quote + n.Value + quote
+		if !strings.HasPrefix(text[start:], raw) {
+			continue
+		}
+		edits = append(edits, textEdit{start, start + len(raw), quote + to + quote})
+	}
+
+	if len(edits) == 0 {
+		return content, false, nil
+	}
+	return []byte(applyEdits(text, edits)), true, nil
+}
+
+// runnerLabelNodes returns the scalar nodes of the runner labels and groups
+// in the runs-on of the jobs in the workflow.
+func runnerLabelNodes(content []byte) ([]*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	var nodes []*yaml.Node
+	var collect func(n *yaml.Node)
+	collect = func(n *yaml.Node) {
+		switch n.Kind {
+		case yaml.ScalarNode:
+			if !strings.Contains(n.Value, "${{") {
+				nodes = append(nodes, n)
+			}
+		case yaml.SequenceNode:
+			for _, item := range n.Content {
+				if item.Kind == yaml.ScalarNode {
+					collect(item)
+				}
+			}
+		case yaml.MappingNode:
+			if group := mappingValue(n, "group"); group != nil && group.Kind == yaml.ScalarNode {
+				collect(group)
+			}
+			if labels := mappingValue(n, "labels"); labels != nil {
+				collect(labels)
+			}
+		}
+	}
+
+	jobs := mappingValue(doc.Content[0], "jobs")
+	if jobs == nil || jobs.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 1; i < len(jobs.Content); i += 2 {
+		if runsOn := mappingValue(jobs.Content[i], "runs-on"); runsOn != nil {
+			collect(runsOn)
+		}
+	}
+	return nodes, nil
+}
+
+// mappingValue returns the value of key in the mapping n, nil if n isn't a
+// mapping or has no such key.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// actionStableDays is how old a release must be before we pin an action to it.
+const actionStableDays = 7
+
+// actionPin is the commit an action is pinned to and the release tag it
+// belongs to.
+type actionPin struct {
+	SHA string
+	Tag string
+}
+
+// usesRe matches a uses: line referring to an action on GitHub, e.g.
+// "- uses: actions/checkout@v4 # optional comment".
+var usesRe = regexp.MustCompile(`^(\s*(?:-\s+)?uses:\s*)(["']?)([\w.-]+/[\w.-]+)((?:/[^@\s"']*)?)@([^\s"'#]+)(["']?)(\s*#.*)?$`)
+
+// pinActions pins every GitHub action used in the workflow to the commit of
+// its latest stable release, using resolve to look up the pin for a repo
+// (e.g. "actions/checkout"). The pinned lines look like
+//
+//   - uses: actions/checkout@11bd71901bbe5b1630ceea73d27597364c9af683 # v4.2.2
+//
+// Local actions and docker:// references are left alone, and so are actions
+// resolve returns no pin for.
+func pinActions(content []byte, resolve func(repo string) (actionPin, bool, error)) ([]byte, bool, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+	var updated bool
+	for i, line := range lines {
+		body := strings.TrimRight(line, "\r\n")
+		m := usesRe.FindStringSubmatch(body)
+		if m == nil {
+			continue
+		}
+		prefix, quote, repo, subpath, ref := m[1], m[2], m[3], m[4], m[5]
+
+		pin, ok, err := resolve(repo)
+		if err != nil {
+			return nil, false, fmt.Errorf("line %d: %s: %w", i+1, repo, err)
+		}
+		if !ok || ref == pin.SHA {
+			continue
+		}
+
+		lines[i] = prefix + quote + repo + subpath + "@" + pin.SHA + quote + " # " + pin.Tag + line[len(body):]
+		updated = true
+	}
+	if !updated {
+		return content, false, nil
+	}
+	return []byte(strings.Join(lines, "")), true, nil
+}
+
+// actionResolver looks up and caches action pins on GitHub.
+type actionResolver struct {
+	pins map[string]actionPin
+}
+
+func newActionResolver() *actionResolver {
+	return &actionResolver{pins: map[string]actionPin{}}
+}
+
+// resolve returns the pin for the release of repo picked by
+// stableActionRelease. Repos without such a release get no pin.
+func (r *actionResolver) resolve(repo string) (actionPin, bool, error) {
+	if pin, ok := r.pins[repo]; ok {
+		return pin, pin.SHA != "", nil
+	}
+
+	var releases []actionRelease
+	if err := githubAPI(fmt.Sprintf("repos/%s/releases?per_page=30", repo), &releases); err != nil {
+		return actionPin{}, false, fmt.Errorf("failed to list releases: %w", err)
+	}
+	tag := stableActionRelease(releases, time.Now())
+
+	var pin actionPin
+	if tag != "" {
+		var commit struct {
+			SHA string `json:"sha"`
+		}
+		if err := githubAPI(fmt.Sprintf("repos/%s/commits/%s", repo, url.PathEscape(tag)), &commit); err != nil {
+			return actionPin{}, false, fmt.Errorf("failed to resolve %s: %w", tag, err)
+		}
+		pin = actionPin{SHA: commit.SHA, Tag: tag}
+	}
+
+	r.pins[repo] = pin
+	return pin, pin.SHA != "", nil
+}
+
+// actionRelease is a release of an action as listed by the GitHub API.
+type actionRelease struct {
+	TagName     string    `json:"tag_name"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// stableActionRelease returns the tag of the highest vMAJOR.MINOR.PATCH
+// release published at least actionStableDays before now, as a fix for an
+// older major version may be published after the latest release. Repos
+// tagging otherwise get their newest release, listed first by GitHub.
+// Drafts and prereleases are skipped, and it returns "" if none is left.
+func stableActionRelease(releases []actionRelease, now time.Time) string {
+	var (
+		tag     string
+		version [3]int
+		semver  bool
+	)
+	cutoff := now.AddDate(0, 0, -actionStableDays)
+	for _, rel := range releases {
+		if rel.Draft || rel.Prerelease || rel.PublishedAt.After(cutoff) {
+			continue
+		}
+		v, ok := parseSemver(rel.TagName)
+		switch {
+		case ok && (!semver || slices.Compare(v[:], version[:]) > 0):
+			tag, version, semver = rel.TagName, v, true
+		case !ok && tag == "":
+			tag = rel.TagName
+		}
+	}
+	return tag
+}
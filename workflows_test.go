@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update the .golden files in testdata")
+
+// testGolden runs edit on each .yml file in dir and compares the result with
+// the .golden file next to it. Files edit should leave alone have no .golden
+// file and must come back unchanged, with updated false.
+func testGolden(t *testing.T, dir string, edit func(content []byte) ([]byte, bool, error)) {
+	t.Helper()
+	inputs, err := filepath.Glob(filepath.Join("testdata", dir, "*.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no test files in testdata/%s", dir)
+	}
+	for _, input := range inputs {
+		t.Run(strings.TrimSuffix(filepath.Base(input), ".yml"), func(t *testing.T) {
+			content, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, updated, err := edit(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenFile := strings.TrimSuffix(input, ".yml") + ".golden"
+			if *updateGolden {
+				if updated {
+					err = os.WriteFile(goldenFile, got, 0o644)
+				} else {
+					err = os.Remove(goldenFile)
+				}
+				if err != nil && !os.IsNotExist(err) {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenFile)
+			switch {
+			case os.IsNotExist(err):
+				if updated || !bytes.Equal(got, content) {
+					t.Errorf("expected no change, got\n%s", got)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !updated:
+				t.Errorf("expected a change to\n%s", want)
+			case !bytes.Equal(got, want):
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSetGoVersionMatrix(t *testing.T) {
+	testGolden(t, "gomatrix", func(content []byte) ([]byte, bool, error) {
+		return setGoVersionMatrix(content, []string{"1.25.x", "1.26.x"})
+	})
+}
+
+func TestSetRunnerLabels(t *testing.T) {
+	testGolden(t, "runnerlabels", func(content []byte) ([]byte, bool, error) {
+		return setRunnerLabels(content, map[string]string{
+			"linux-x64":  "linux-x64-v2",
+			"build-pool": "build-pool-2",
+		})
+	})
+}
+
+func TestPinActions(t *testing.T) {
+	pins := map[string]actionPin{
+		"actions/checkout":     {SHA: strings.Repeat("1", 40), Tag: "v4.2.2"},
+		"actions/setup-go":     {SHA: strings.Repeat("3", 40), Tag: "v5.1.0"},
+		"actions/cache":        {SHA: strings.Repeat("5", 40), Tag: "v4.1.2"},
+		"github/codeql-action": {SHA: strings.Repeat("4", 40), Tag: "v3.27.0"},
+	}
+	testGolden(t, "pinactions", func(content []byte) ([]byte, bool, error) {
+		return pinActions(content, func(repo string) (actionPin, bool, error) {
+			pin, ok := pins[repo]
+			return pin, ok, nil
+		})
+	})
+}
+
+func TestStableActionRelease(t *testing.T) {
+	now := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	for _, test := range []struct {
+		name     string
+		releases []actionRelease
+		want     string
+	}{
+		{name: "no releases", want: ""},
+		{
+			name: "newest stable",
+			releases: []actionRelease{
+				{TagName: "v4.2.2", PublishedAt: daysAgo(30)},
+				{TagName: "v4.2.1", PublishedAt: daysAgo(60)},
+			},
+			want: "v4.2.2",
+		},
+		{
+			name: "too new",
+			releases: []actionRelease{
+				{TagName: "v4.3.0", PublishedAt: daysAgo(6)},
+				{TagName: "v4.2.2", PublishedAt: daysAgo(7)},
+			},
+			want: "v4.2.2",
+		},
+		{
+			name: "drafts and prereleases",
+			releases: []actionRelease{
+				{TagName: "v5.0.0", Draft: true, PublishedAt: daysAgo(30)},
+				{TagName: "v5.0.0-rc.1", Prerelease: true, PublishedAt: daysAgo(30)},
+				{TagName: "v4.2.2", PublishedAt: daysAgo(30)},
+			},
+			want: "v4.2.2",
+		},
+		{
+			name: "fix of an older major published last",
+			releases: []actionRelease{
+				{TagName: "v3.6.1", PublishedAt: daysAgo(10)},
+				{TagName: "v4.10.0", PublishedAt: daysAgo(20)},
+				{TagName: "v4.9.0", PublishedAt: daysAgo(40)},
+			},
+			want: "v4.10.0",
+		},
+		{
+			name: "semver over other tags",
+			releases: []actionRelease{
+				{TagName: "latest", PublishedAt: daysAgo(10)},
+				{TagName: "v1.0.0", PublishedAt: daysAgo(20)},
+			},
+			want: "v1.0.0",
+		},
+		{
+			name: "no semver tags",
+			releases: []actionRelease{
+				{TagName: "release-2", PublishedAt: daysAgo(10)},
+				{TagName: "release-1", PublishedAt: daysAgo(20)},
+			},
+			want: "release-2",
+		},
+		{
+			name:     "all too new",
+			releases: []actionRelease{{TagName: "v1.0.0", PublishedAt: daysAgo(1)}},
+			want:     "",
+		},
+	} {
+		if got := stableActionRelease(test.releases, now); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateDirName is the directory below the base dir where mygithelper keeps
+// its own files.
+const stateDirName = ".mygithelper"
+
+// newRunID returns an ID for a run of a command, unique enough for one user.
+func newRunID() string {
+	return time.Now().Format("20060102-150405")
+}
+
+func runWorkDir(baseDir, runID string) string {
+	return filepath.Join(baseDir, stateDirName, "work", runID)
+}
+
+// removeRunWorkDir removes the work dir of a run once its workspaces are gone.
+func removeRunWorkDir(baseDir, runID string) {
+	os.RemoveAll(runWorkDir(baseDir, runID))
+	os.Remove(filepath.Join(baseDir, stateDirName, "work"))
+	os.Remove(filepath.Join(baseDir, stateDirName))
+}
+
+// workspace is a temporary git worktree of a repo at the tip of a remote
+// branch, so update steps never touch the user's checkout.
+type workspace struct {
+	Dir string
+
+	repoDir    string
+	unregister func()
+	closeOnce  sync.Once
+}
+
+func newWorkspace(baseDir, runID string, repo repo, branch string) (*workspace, error) {
+	dir := filepath.Join(runWorkDir(baseDir, runID), repo.Path)
+
+	if err := gitRun(repo.Dir, "fetch", "origin", branch); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", branch, err)
+	}
+	if err := gitRun(repo.Dir, "worktree", "add", "--detach", dir, "origin/"+branch); err != nil {
+		return nil, fmt.Errorf("failed to create worktree: %w", err)
+	}
+
+	ws := &workspace{Dir: dir, repoDir: repo.Dir}
+	ws.unregister = onExit(ws.remove)
+	return ws, nil
+}
+
+// Close removes the worktree. It is safe to call more than once.
+func (ws *workspace) Close() {
+	ws.unregister()
+	ws.remove()
+}
+
+func (ws *workspace) remove() {
+	ws.closeOnce.Do(func() {
+		if err := gitRun(ws.repoDir, "worktree", "remove", "--force", ws.Dir); err != nil {
+			// Fall back to removing the files and let git forget about them.
+			os.RemoveAll(ws.Dir)
+			gitRun(ws.repoDir, "worktree", "prune")
+		}
+	})
+}